@@ -1,3 +1,8 @@
 module github.com/fizzbee-io/fizzbee
 
 go 1.22
+
+require (
+	github.com/golang/glog v1.2.5
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,77 @@
+package lib
+
+import (
+    "sync"
+)
+
+// GuidedQueue removes the element chosen by the pick function, instead of a uniformly
+// random element like RandomQueue. The simulation uses it to bias the random walk.
+type GuidedQueue[T any] struct {
+    lock sync.Mutex
+    arr  []T
+    // pick returns the index of the element to remove. It is only called with a non-empty slice.
+    pick func(items []T) int
+}
+
+func (g *GuidedQueue[T]) Add(t T) {
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    g.arr = append(g.arr, t)
+}
+
+func (g *GuidedQueue[T]) Remove() (T, bool) {
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    var v T
+    if len(g.arr) == 0 {
+        return v, false
+    }
+    idx := g.pick(g.arr)
+    v = g.arr[idx]
+    g.arr = append(g.arr[:idx], g.arr[idx+1:]...)
+    return v, true
+}
+
+func (g *GuidedQueue[T]) Clear(n int) {
+    // Remove the first n elements
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    if n > len(g.arr) {
+        n = len(g.arr)
+    }
+    g.arr = g.arr[n:]
+}
+
+func (g *GuidedQueue[T]) ClearAll() {
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    g.arr = g.arr[:0]
+}
+
+func (g *GuidedQueue[T]) Retain(n int) {
+    // Retain the first n elements and remove all others
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    if n < len(g.arr) {
+        g.arr = g.arr[:n]
+    }
+}
+
+func (g *GuidedQueue[T]) Len() int {
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    return len(g.arr)
+}
+
+func (g *GuidedQueue[T]) Empty() bool {
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    return len(g.arr) == 0
+}
+
+func NewGuidedQueue[T any](pick func(items []T) int) *GuidedQueue[T] {
+    return &GuidedQueue[T]{pick: pick, arr: make([]T, 0)}
+}
+
+// Ensures GuidedQueue implements LinearCollection
+var _ LinearCollection[interface{}] = (*(GuidedQueue[interface{}]))(nil)
@@ -55,7 +55,7 @@ func MarshalJSONStarlarkValue(m starlark.Value) ([]byte, error) {
         return json.Marshal(string(m.(starlark.Bytes)))
     case "int", "float":
         return []byte(m.String()), nil
-    case "list", "set", "range", "tuple", "genericset", "bag":
+    case "list", "set", "range", "tuple", "genericset", "bag", "channel":
         iter := m.(starlark.Iterable).Iterate()
         defer iter.Done()
         var x starlark.Value
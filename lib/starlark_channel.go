@@ -0,0 +1,236 @@
+package lib
+
+import (
+	"fmt"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"strings"
+)
+
+const (
+	// ChannelOrderingFifo delivers the messages in the order they were sent.
+	ChannelOrderingFifo = "fifo"
+	// ChannelOrderingUnordered allows the messages to be received in any order.
+	ChannelOrderingUnordered = "unordered"
+)
+
+var (
+	channelMethods = map[string]*starlark.Builtin{
+		"send":       starlark.NewBuiltin("send", channel_send),
+		"recv":       starlark.NewBuiltin("recv", channel_recv),
+		"receivable": starlark.NewBuiltin("receivable", channel_receivable),
+	}
+)
+
+// Channel models a network link between roles. The model checker explores the
+// faults allowed by the channel (message loss and duplication) as separate transitions.
+// For unordered channels, the messages are kept sorted like a bag, so the same set
+// of in-flight messages always has the same hash.
+type Channel struct {
+	Ordering    string
+	Lossy       bool
+	Duplicating bool
+	elems       []starlark.Value
+
+	// sent contains the messages sent since the last DrainSent. These are only
+	// used to record the messages for the communication graph, and are not part of the state.
+	sent []starlark.Value
+}
+
+func MakeChannel(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	ordering := ChannelOrderingFifo
+	lossy := false
+	duplicating := false
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+		"ordering?", &ordering, "lossy?", &lossy, "duplicating?", &duplicating); err != nil {
+		return nil, err
+	}
+	if ordering != ChannelOrderingFifo && ordering != ChannelOrderingUnordered {
+		return nil, fmt.Errorf("%s: ordering must be %q or %q, got %q", b.Name(),
+			ChannelOrderingFifo, ChannelOrderingUnordered, ordering)
+	}
+	return NewChannel(ordering, lossy, duplicating), nil
+}
+
+func NewChannel(ordering string, lossy bool, duplicating bool) *Channel {
+	return &Channel{Ordering: ordering, Lossy: lossy, Duplicating: duplicating}
+}
+
+// Messages returns the in-flight messages in the delivery order.
+func (c *Channel) Messages() []starlark.Value {
+	return c.elems
+}
+
+// Insert adds the message to the channel, without recording it as sent.
+func (c *Channel) Insert(msg starlark.Value) {
+	if c.Ordering == ChannelOrderingFifo {
+		c.elems = append(c.elems, msg)
+		return
+	}
+	c.elems = sortAsString(append(c.elems, msg))
+}
+
+// Drop removes the message at the index, used to simulate message loss.
+func (c *Channel) Drop(index int) {
+	c.elems = append(c.elems[:index:index], c.elems[index+1:]...)
+}
+
+// Duplicate inserts another copy of the message at the index.
+func (c *Channel) Duplicate(index int) {
+	c.Insert(c.elems[index])
+}
+
+// DrainSent returns the messages sent since the previous call, and clears them.
+func (c *Channel) DrainSent() []starlark.Value {
+	sent := c.sent
+	c.sent = nil
+	return sent
+}
+
+func (c *Channel) Attr(name string) (starlark.Value, error) {
+	return BuiltinAttr(c, name, channelMethods)
+}
+
+func (c *Channel) AttrNames() []string {
+	return BuiltinAttrNames(channelMethods)
+}
+
+func (c *Channel) Iterate() starlark.Iterator {
+	return &listIterator{entries: c.elems}
+}
+
+func (c *Channel) Len() int {
+	return len(c.elems)
+}
+
+func (c *Channel) String() string {
+	buf := new(strings.Builder)
+	buf.WriteString("channel(")
+	buf.WriteString(c.Ordering)
+	if c.Lossy {
+		buf.WriteString(",lossy")
+	}
+	if c.Duplicating {
+		buf.WriteString(",duplicating")
+	}
+	buf.WriteString(")[")
+	for i, elem := range c.elems {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(elem.String())
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+func (c *Channel) Type() string {
+	return "channel"
+}
+
+func (c *Channel) Freeze() {
+
+}
+
+func (c *Channel) Truth() starlark.Bool {
+	return c.Len() > 0
+}
+
+func (c *Channel) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: channel")
+}
+
+func (c *Channel) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*Channel)
+	switch op {
+	case syntax.EQL:
+		return c.equal(y, depth)
+	case syntax.NEQ:
+		eq, err := c.equal(y, depth)
+		return !eq, err
+	default:
+		return false, fmt.Errorf("%s %s %s not implemented", c.Type(), op, y.Type())
+	}
+}
+
+// equal compares the in-flight messages. The messages of a fifo channel are
+// compared in the order they were sent, and those of an unordered channel as a bag.
+func (c *Channel) equal(y *Channel, depth int) (bool, error) {
+	if c.Ordering != y.Ordering || c.Lossy != y.Lossy || c.Duplicating != y.Duplicating {
+		return false, nil
+	}
+	if c.Ordering == ChannelOrderingUnordered {
+		return bagEqual(c.elems, y.elems, depth)
+	}
+	if len(c.elems) != len(y.elems) {
+		return false, nil
+	}
+	for i, elem := range c.elems {
+		if eq, err := starlark.EqualDepth(elem, y.elems[i], depth); err != nil || !eq {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func channel_send(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &msg); err != nil {
+		return nil, err
+	}
+	c := b.Receiver().(*Channel)
+	c.Insert(msg)
+	c.sent = append(c.sent, msg)
+	return starlark.None, nil
+}
+
+// channel_recv removes and returns the next message. With an argument, the given
+// message is removed instead, which is the typical usage for unordered channels
+// along with `any msg in ch.receivable()`.
+func channel_recv(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0, &msg); err != nil {
+		return nil, err
+	}
+	c := b.Receiver().(*Channel)
+	if len(c.elems) == 0 {
+		return nil, nameErr(b, "channel is empty")
+	}
+	if msg == nil {
+		msg = c.elems[0]
+		c.elems = c.elems[1:]
+		return msg, nil
+	}
+	receivable := c.receivable()
+	for i, elem := range c.elems {
+		if eq, err := starlark.Equal(elem, msg); err != nil {
+			return nil, nameErr(b, err)
+		} else if eq && i < len(receivable) {
+			c.Drop(i)
+			return elem, nil
+		}
+	}
+	return nil, nameErr(b, fmt.Sprintf("message %s cannot be received", msg.String()))
+}
+
+func channel_receivable(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.NewList(b.Receiver().(*Channel).receivable()), nil
+}
+
+// receivable returns the messages that can be received next. For fifo channels,
+// it is only the first message, for unordered channels it is every message.
+func (c *Channel) receivable() []starlark.Value {
+	if c.Ordering == ChannelOrderingFifo {
+		return c.elems[:min(1, len(c.elems))]
+	}
+	return c.elems
+}
+
+var _ starlark.Comparable = (*Channel)(nil)
+var _ starlark.HasAttrs = (*Channel)(nil)
+var _ starlark.Iterable = (*Channel)(nil)
+var _ starlark.Sequence = (*Channel)(nil)
+var _ starlark.Value = (*Channel)(nil)
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestChannel_Equal(t *testing.T) {
+	newChannel := func(ordering string, msgs ...string) *Channel {
+		c := NewChannel(ordering, false, false)
+		for _, msg := range msgs {
+			c.Insert(starlark.String(msg))
+		}
+		return c
+	}
+	tests := []struct {
+		name string
+		x    *Channel
+		y    *Channel
+		want bool
+	}{
+		{
+			name: "fifo same order",
+			x:    newChannel(ChannelOrderingFifo, "a", "b"),
+			y:    newChannel(ChannelOrderingFifo, "a", "b"),
+			want: true,
+		},
+		{
+			name: "fifo different order",
+			x:    newChannel(ChannelOrderingFifo, "a", "b"),
+			y:    newChannel(ChannelOrderingFifo, "b", "a"),
+			want: false,
+		},
+		{
+			name: "unordered different order",
+			x:    newChannel(ChannelOrderingUnordered, "a", "b"),
+			y:    newChannel(ChannelOrderingUnordered, "b", "a"),
+			want: true,
+		},
+		{
+			name: "different ordering",
+			x:    newChannel(ChannelOrderingFifo, "a"),
+			y:    newChannel(ChannelOrderingUnordered, "a"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globals := starlark.StringDict{"x": tt.x, "y": tt.y}
+			eq, err := starlark.Eval(&starlark.Thread{}, "eq", "x == y", globals)
+			require.NoError(t, err)
+			assert.Equal(t, starlark.Bool(tt.want), eq)
+			ne, err := starlark.Eval(&starlark.Thread{}, "ne", "x != y", globals)
+			require.NoError(t, err)
+			assert.Equal(t, starlark.Bool(!tt.want), ne)
+		})
+	}
+}
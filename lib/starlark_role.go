@@ -1,23 +1,58 @@
 package lib
 
 import (
+	"encoding/json"
 	"fmt"
 	"go.starlark.net/starlark"
+	"sort"
 	"strings"
+	"sync"
 )
 
 var (
 	roleMethods = map[string]*starlark.Builtin{
 		//"clear": starlark.NewBuiltin("clear", dict_clear),
+		"arm_timer":    starlark.NewBuiltin("arm_timer", role_arm_timer),
+		"cancel_timer": starlark.NewBuiltin("cancel_timer", role_cancel_timer),
 	}
 )
 
+const (
+	// DefaultTimerName is the name of the timer, when not specified. The timer
+	// guards the role's action with the same name.
+	DefaultTimerName = "Timeout"
+	// TimerDisarmed is the value of a timer that is cancelled or already fired.
+	TimerDisarmed = -1
+)
+
+// RoleRefs assigns the ref numbers to the role instances, counting separately for each role.
+// Each model checker run has its own RoleRefs, so the concurrent runs number the roles independently.
+type RoleRefs struct {
+	lock sync.Mutex
+	refs map[string]int
+}
+
+func NewRoleRefs() *RoleRefs {
+	return &RoleRefs{refs: map[string]int{}}
+}
+
+func (r *RoleRefs) next(name string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	nextRef := r.refs[name]
+	r.refs[name]++
+	return nextRef
+}
+
 var (
-	roleRefs = map[string]int{}
+	// roleRefs numbers the roles created without RoleRefs of their own.
+	roleRefs = NewRoleRefs()
 )
 
 func ClearRoleRefs()  {
-	roleRefs = map[string]int{}
+	roleRefs.lock.Lock()
+	defer roleRefs.lock.Unlock()
+	roleRefs.refs = map[string]int{}
 }
 type Role struct {
 	Ref  int
@@ -26,6 +61,18 @@ type Role struct {
 	Params *Struct
 	Fields *Struct
 	Methods map[string]*starlark.Function
+
+	// InitFields is the snapshot of the Fields at the end of the Init action.
+	// On crash, the ephemeral fields are reset to these values. This is never
+	// modified after the snapshot is taken, so it is shared across the clones.
+	InitFields *Struct
+	// Crashed is set when the role instance crashed, and is waiting for Recover.
+	Crashed bool
+
+	// Timers maps the timer name to the number of time ticks remaining for it to fire,
+	// or TimerDisarmed. Once a timer is used, the role action with the same name
+	// is only scheduled when the timer is due.
+	Timers map[string]int
 }
 
 func (r *Role) AddMethod(name string, val starlark.Value) error {
@@ -95,6 +142,19 @@ func (r *Role) String() string {
 		b.WriteString(",")
 	}
 	b.WriteString(r.Fields.String())
+	if r.Crashed {
+		b.WriteString(",crashed")
+	}
+	if len(r.Timers) > 0 {
+		b.WriteString(",timers(")
+		for i, name := range r.TimerNames() {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(fmt.Sprintf("%s=%d", name, r.Timers[name]))
+		}
+		b.WriteString(")")
+	}
 	b.WriteString(")")
 	return b.String()
 }
@@ -118,11 +178,73 @@ func (r *Role) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 	b.Write(fields)
+	if r.Crashed {
+		b.WriteString(",\"crashed\": true")
+	}
+	if len(r.Timers) > 0 {
+		timers, err := json.Marshal(r.Timers)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(",\"timers\": ")
+		b.Write(timers)
+	}
 	b.WriteString("}")
 	s := b.String()
 	return []byte(s), nil
 }
 
+// TimerNames returns the names of the timers used by the role, in sorted order.
+func (r *Role) TimerNames() []string {
+	names := make([]string, 0, len(r.Timers))
+	for name := range r.Timers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsTimerDue returns true if the timer is armed, and has no time remaining.
+func (r *Role) IsTimerDue(name string) bool {
+	return r.Timers[name] == 0
+}
+
+// IsTimerGated returns true if the action with the given name is guarded by a timer.
+func (r *Role) IsTimerGated(name string) bool {
+	_, ok := r.Timers[name]
+	return ok
+}
+
+func role_arm_timer(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	name := DefaultTimerName
+	delay := 0
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name?", &name, "delay?", &delay); err != nil {
+		return nil, err
+	}
+	if delay < 0 {
+		return nil, nameErr(b, fmt.Sprintf("delay must not be negative, got %d", delay))
+	}
+	r := b.Receiver().(*Role)
+	if r.Timers == nil {
+		r.Timers = map[string]int{}
+	}
+	r.Timers[name] = delay
+	return starlark.None, nil
+}
+
+func role_cancel_timer(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	name := DefaultTimerName
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name?", &name); err != nil {
+		return nil, err
+	}
+	r := b.Receiver().(*Role)
+	if r.Timers == nil {
+		r.Timers = map[string]int{}
+	}
+	r.Timers[name] = TimerDisarmed
+	return starlark.None, nil
+}
+
 func (r *Role) RefString() string {
 	return GenerateRefString(r.Name, r.Ref)
 }
@@ -159,16 +281,16 @@ var _ starlark.HasAttrs = (*Role)(nil)
 var _ starlark.HasSetField = (*Role)(nil)
 var _ starlark.Value = (*Role)(nil)
 
-func CreateRoleBuiltin(name string, symmetric bool, roles *[]*Role) *starlark.Builtin {
+// CreateRoleBuiltin returns the constructor for the role. The instances are numbered
+// with the refs, or with the shared numbering if refs is nil.
+func CreateRoleBuiltin(name string, symmetric bool, roles *[]*Role, refs *RoleRefs) *starlark.Builtin {
+	if refs == nil {
+		refs = roleRefs
+	}
 	return starlark.NewBuiltin(name, func(t *starlark.Thread, b *starlark.Builtin,
 		args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		params := FromKeywords(starlark.String("params"), kwargs)
-		nextRef := roleRefs[name]
-		if roleRefs[name] > 0 {
-			roleRefs[name]++
-		} else {
-			roleRefs[name] = 1
-		}
+		nextRef := refs.next(name)
 		fields := FromStringDict(starlark.String("fields"), starlark.StringDict{})
 		r := &Role{Ref: nextRef, Name: name, Symmetric: symmetric, Params: params, Fields: fields, Methods: map[string]*starlark.Function{}}
 		*roles = append(*roles, r)
@@ -36,6 +36,7 @@ var (
         "genericset": starlark.NewBuiltin("genericset", MakeGenericSet),
         "symmetric_values": starlark.NewBuiltin("symmetric_values", MakeSymmetricValues),
         "bag": starlark.NewBuiltin("bag", MakeBag),
+        "channel": starlark.NewBuiltin("channel", MakeChannel),
         "math": math.Module,
     }
 
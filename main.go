@@ -15,6 +15,7 @@ import (
     "os"
     "os/signal"
     "path/filepath"
+    "runtime"
     "runtime/pprof"
     "slices"
     "strings"
@@ -28,6 +29,16 @@ var internalProfile bool
 var saveStates bool
 var seed int64
 var maxRuns int
+var swarm bool
+var swarmReplay bool
+var workers int
+var strategy string
+var exploration string
+var perf bool
+var perfModelFile string
+var precision float64
+var sweep string
+var sweepComplement string
 func main() {
     flag.BoolVar(&isPlayground, "playground", false, "is for playground")
     flag.BoolVar(&simulation, "simulation", false, "Runs in simulation mode (DFS). Default=false for no simulation (BFS)")
@@ -35,7 +46,25 @@ func main() {
     flag.BoolVar(&saveStates, "save_states", false, "Save states to disk")
     flag.Int64Var(&seed, "seed", 0, "Seed for random number generator used in simulation mode")
     flag.IntVar(&maxRuns, "max_runs", 0, "Maximum number of simulation runs/paths to explore. Default=0 for unlimited")
+    flag.BoolVar(&swarm, "swarm", false, "Runs many simulations concurrently, each with a different seed and randomized options")
+    flag.BoolVar(&swarmReplay, "swarm_replay", false, "With --swarm, replays only the run with the --seed, like the one reproducing a swarm failure")
+    flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of concurrent simulations in the swarm mode")
+    flag.StringVar(&strategy, "strategy", modelchecker.SimulationUniform,
+        "Simulation strategy: uniform, weighted (by the perf model probabilities), novelty (prefers the rarely executed statements) or fuzz (mutates the runs reaching new coverage)")
+    flag.StringVar(&perfModelFile, "perf_model", "", "Performance model yaml, used by the perf analysis and the weighted simulation strategy. With --perf, comma separated models are compared")
+    flag.BoolVar(&perf, "perf", false, "Runs the Markov chain performance analysis with the perf_model after the model checking, or estimates it from the simulation runs with --simulation")
+    flag.StringVar(&sweep, "sweep", "", "With --perf, compares the perf analysis with the probability of a label over a range, like Client.retry=0.1:0.9:0.1")
+    flag.StringVar(&sweepComplement, "sweep_complement", "", "With --sweep, the label taking the rest of the probability, like the other branch of a oneof")
+    flag.Float64Var(&precision, "precision", 0.01, "With --perf --simulation, the runs stop when the 95% confidence intervals are within this fraction of the means")
+    flag.StringVar(&exploration, "exploration", "", "Exhaustive search order: bfs (default), dfs or iterative_deepening. Overrides the exploration in fizz.yaml")
     flag.Parse()
+    if swarm {
+        simulation = true
+    }
+    if swarmReplay && (!swarm || seed == 0) {
+        fmt.Println("The --swarm_replay requires --swarm and the --seed of the run")
+        os.Exit(1)
+    }
 
     args := flag.Args()
     // Check if the correct number of arguments is provided
@@ -110,21 +139,101 @@ func main() {
         crashOnYield := true
         stateConfig.Options.CrashOnYield = &crashOnYield
     }
+    if exploration != "" {
+        stateConfig.Exploration = exploration
+    }
+    switch stateConfig.GetExploration() {
+    case "", modelchecker.ExplorationBfs, modelchecker.ExplorationDfs, modelchecker.ExplorationIterativeDeepening:
+    default:
+        fmt.Println("Unknown exploration:", stateConfig.GetExploration())
+        os.Exit(1)
+    }
     outDir, err := createOutputDir(dirPath)
     if err != nil {
         return
     }
 
     //maxRuns := 10000
-    if !simulation || seed != 0 {
+    // The perf estimation and the swarm derive the seed of each run from the seed.
+    if !simulation || (seed != 0 && !perf && !swarm) || swarmReplay {
         maxRuns = 1
     }
     if simulation && seed != 0 {
         fmt.Println("Seed:", seed)
     }
-    if simulation && maxRuns == 0 {
+    if simulation && maxRuns == 0 && !perf {
         fmt.Println("MaxRuns: unlimited")
     }
+    // The coverage is aggregated over all the simulation runs, and reported at the end.
+    coverage := modelchecker.NewCoverage()
+    defer func() {
+        printCoverage(coverage.Report([]*ast.File{f}), outDir)
+    }()
+    var perfModel *ast.PerformanceModel
+    // perfModels are the models compared on the same state space, with --perf and several models or a sweep.
+    perfModels := make([]*ast.PerformanceModel, 0)
+    perfModelNames := make([]string, 0)
+    if perfModelFile != "" {
+        for _, perfModelFileName := range strings.Split(perfModelFile, ",") {
+            model := &ast.PerformanceModel{}
+            err = lib.ReadProtoFromFile(perfModelFileName, model)
+            if err != nil {
+                fmt.Println("Error reading performance model:", err)
+                os.Exit(1)
+            }
+            for _, query := range model.Queries {
+                if _, err := modelchecker.ParsePerfQuery(query); err != nil {
+                    fmt.Println("Error in performance model:", err)
+                    os.Exit(1)
+                }
+            }
+            if err := modelchecker.ValidatePerfModel(model); err != nil {
+                fmt.Println("Error in performance model:", err)
+                os.Exit(1)
+            }
+            perfModels = append(perfModels, model)
+            perfModelNames = append(perfModelNames, filepath.Base(perfModelFileName))
+        }
+        perfModel = perfModels[0]
+    }
+    if sweep != "" {
+        if len(perfModels) > 1 {
+            fmt.Println("The sweep varies a single performance model")
+            os.Exit(1)
+        }
+        s, err := modelchecker.ParsePerfSweep(sweep, sweepComplement)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        perfModels, perfModelNames = s.Models(perfModel)
+        // A sweep with a single step is analyzed like a single model, with the swept value.
+        perfModel = perfModels[0]
+    }
+    if len(perfModels) > 1 && (!perf || simulation) {
+        fmt.Println("Comparing the performance models requires --perf, without the simulation")
+        os.Exit(1)
+    }
+    if perf && swarm {
+        fmt.Println("The perf estimation runs the simulations sequentially, use --perf --simulation instead of --swarm")
+        os.Exit(1)
+    }
+    if perf && simulation {
+        startPerfEstimation(f, stateConfig, dirPath, outDir, perfModel)
+        return
+    }
+    var guide *modelchecker.SimulationGuide
+    if simulation {
+        guide, err = modelchecker.NewSimulationGuide(strategy, perfModel)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+    }
+    if swarm {
+        startSwarm(f, stateConfig, dirPath, outDir, coverage, guide)
+        return
+    }
     stopped := false
     runs := 0
     var p1 *modelchecker.Processor
@@ -145,6 +254,9 @@ func main() {
         i++
 
         p1 = modelchecker.NewProcessor([]*ast.File{f}, stateConfig, simulation, seed, dirPath)
+        if simulation {
+            p1.SetSimulationGuide(guide)
+        }
         if !simulation {
             c := make(chan os.Signal)
             signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -157,6 +269,7 @@ func main() {
 
         rootNode, failedNode, endTime := startModelChecker(err, p1)
         runs++
+        coverage.Merge(p1.Coverage())
 
         if p1.GetVisitedNodesCount() < 250 {
             dotString := modelchecker.GenerateDotFile(rootNode, make(map[*modelchecker.Node]bool))
@@ -227,6 +340,25 @@ func main() {
                     return
                 }
             }
+            if perf && !p1.Stopped() {
+                // The probabilistic analysis runs before the liveness checks, as the behaviors
+                // violating the liveness under fairness can still have probability zero.
+                if len(perfModels) > 1 {
+                    comparison, err := modelchecker.ComparePerformance(rootNode, perfModels, perfModelNames)
+                    if err != nil {
+                        fmt.Println("Error in performance model:", err)
+                        os.Exit(1)
+                    }
+                    printPerfComparison(comparison, outDir)
+                } else {
+                    report, err := modelchecker.AnalyzePerformance(rootNode, perfModel)
+                    if err != nil {
+                        fmt.Println("Error in performance model:", err)
+                        os.Exit(1)
+                    }
+                    printPerfReport(report, outDir)
+                }
+            }
             if !simulation && !p1.Stopped() {
                 if stateConfig.GetLiveness() == "" || stateConfig.GetLiveness() == "enabled" || stateConfig.GetLiveness() == "true"  || stateConfig.GetLiveness() == "strict" || stateConfig.GetLiveness() == "strict/bfs" {
                     failurePath, failedInvariant = modelchecker.CheckStrictLiveness(rootNode)
@@ -236,8 +368,31 @@ func main() {
                fmt.Printf("IsLive: %t\n", failedInvariant == nil)
                fmt.Printf("Time taken to check liveness: %v\n", time.Now().Sub(endTime))
             }
+            var failedProperty *modelchecker.TemporalProperty
+            var failedInstance string
+            if failedInvariant == nil && !simulation && !p1.Stopped() {
+                properties, err := modelchecker.TemporalProperties([]*ast.File{f}, stateConfig)
+                if err != nil {
+                    fmt.Println("Error parsing temporal properties:", err)
+                    os.Exit(1)
+                }
+                for _, property := range properties {
+                    fmt.Println("Checking temporal property", property.Name, property.Formula)
+                    path, instance, holds, err := modelchecker.CheckTemporalProperty(rootNode, property)
+                    if err != nil {
+                        fmt.Println("Error checking temporal property:", err)
+                        os.Exit(1)
+                    }
+                    if !holds {
+                        failurePath = path
+                        failedProperty = property
+                        failedInstance = instance
+                        break
+                    }
+                }
+            }
 
-            if failedInvariant == nil && !simulation {
+            if failedInvariant == nil && failedProperty == nil && !simulation {
                 fmt.Println("PASSED: Model checker completed successfully")
                 //nodes, _, _ := modelchecker.GetAllNodes(rootNode)
                 if saveStates || !isPlayground {
@@ -258,12 +413,54 @@ func main() {
                 }
                 GenerateFailurePath(failurePath, failedInvariant, outDir)
                 return
+            } else if failedProperty != nil {
+                fmt.Println("FAILED: Liveness check failed")
+                fmt.Printf("Property: %s\n", failedProperty.Name)
+                if failedInstance != "" {
+                    fmt.Printf("Instance: %s\n", failedInstance)
+                }
+                GenerateFailurePath(failurePath, failedProperty.Position, outDir)
+                return
             }
 
 
         } else if failedNode != nil {
+            if lasso := p1.LassoFailure(); lasso != nil {
+                // The simulation or the dfs found a lasso, a fair behavior looping forever violating the property.
+                fmt.Println("FAILED: Liveness check failed")
+                fmt.Printf("Property: %s\n", lasso.Property.Name)
+                if lasso.Instance != "" {
+                    fmt.Printf("Instance: %s\n", lasso.Instance)
+                }
+                if simulation {
+                    fmt.Println("seed:", p1.Seed)
+                }
+                GenerateFailurePath(lasso.Path, lasso.Property.Position, outDir)
+                return
+            }
+            if failures := p1.Failures(); len(failures) > 1 {
+                // With continue_on_invariant_failures, report every violated invariant
+                // with its own trace in a directory named after the invariant.
+                fmt.Printf("FAILED: Model checker failed. %d invariants violated\n", len(failures))
+                for _, failure := range failures {
+                    invariant := f.Invariants[failure.Position.InvariantIndex]
+                    fmt.Println("\nInvariant: ", invariant.Name)
+                    printTransition(invariant, failure.Node)
+                    invariantDir := filepath.Join(outDir, invariant.Name)
+                    err := os.MkdirAll(invariantDir, 0755)
+                    if err != nil {
+                        fmt.Println("Error creating directory:", err)
+                        return
+                    }
+                    dumpFailedNode(failure.Node, rootNode, invariantDir)
+                    dumpMinimizedPath(p1, failure.Node, failure.Position.InvariantIndex, invariantDir)
+                }
+                return
+            }
             if failedNode.FailedInvariants != nil && len(failedNode.FailedInvariants) > 0 && len(failedNode.FailedInvariants[0]) > 0 {
-                fmt.Println("FAILED: Model checker failed. Invariant: ", f.Invariants[failedNode.FailedInvariants[0][0]].Name)
+                invariant := f.Invariants[failedNode.FailedInvariants[0][0]]
+                fmt.Println("FAILED: Model checker failed. Invariant: ", invariant.Name)
+                printTransition(invariant, failedNode)
             } else if simulation {
                 fmt.Println("FAILED: Model checker failed. Deadlock/stuttering detected")
             }
@@ -271,6 +468,9 @@ func main() {
                 fmt.Println("seed:", p1.Seed)
             }
             dumpFailedNode(failedNode, rootNode, outDir)
+            if failedNode.HasFailedInvariants() {
+                dumpMinimizedPath(p1, failedNode, failedNode.FailedInvariants[0][0], outDir)
+            }
             return
         }
     }
@@ -280,7 +480,8 @@ func main() {
 
 func startModelChecker(err error, p1 *modelchecker.Processor) (*modelchecker.Node, *modelchecker.Node, time.Time) {
     if simulation {
-        rootNode, failedNode, _ := p1.Start()
+        rootNode, failedNode, err := p1.Start()
+        exitOnStartError(err, p1)
         return rootNode, failedNode, time.Now()
     }
     if internalProfile {
@@ -291,12 +492,126 @@ func startModelChecker(err error, p1 *modelchecker.Processor) (*modelchecker.Nod
     rootNode, failedNode, err := p1.Start()
     endTime := time.Now()
     fmt.Printf("Time taken for model checking: %v\n", endTime.Sub(startTime))
+    exitOnStartError(err, p1)
     if internalProfile {
         startHeapProfile()
     }
     return rootNode, failedNode, endTime
 }
 
+// exitOnStartError reports the error of the model checking, like an LTL atom that fails to evaluate.
+func exitOnStartError(err error, p1 *modelchecker.Processor) {
+    if err == nil {
+        return
+    }
+    var modelErr *modelchecker.ModelError
+    if errors.As(err, &modelErr) {
+        fmt.Println("Stack Trace:")
+        fmt.Println(modelErr.SprintStackTrace())
+    } else {
+        fmt.Println("Error:", err)
+    }
+    if simulation {
+        fmt.Println("seed:", p1.Seed)
+    }
+    os.Exit(1)
+}
+
+// startPerfEstimation estimates the performance metrics from the simulation runs weighted by the
+// perf_model, for the models too large for the Markov chain analysis of the whole state space.
+func startPerfEstimation(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPath string, outDir string, perfModel *ast.PerformanceModel) {
+    if perfModel == nil {
+        fmt.Println("The perf estimation requires a --perf_model")
+        os.Exit(1)
+    }
+    if len(perfModel.Queries) > 0 {
+        fmt.Println("The queries require the exhaustive model checking, they are ignored by the perf estimation")
+    }
+    e := modelchecker.NewPerfEstimator([]*ast.File{f}, stateConfig, dirPath, perfModel, seed, precision, maxRuns)
+    c := make(chan os.Signal)
+    signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-c
+        fmt.Println("\nInterrupted. Stopping the perf estimation")
+        e.Stop()
+    }()
+    startTime := time.Now()
+    report, err := e.Estimate()
+    if err != nil {
+        var modelErr *modelchecker.ModelError
+        if errors.As(err, &modelErr) {
+            fmt.Println("Stack Trace:")
+            fmt.Println(modelErr.SprintStackTrace())
+        } else {
+            fmt.Println("Error:", err)
+        }
+        os.Exit(1)
+    }
+    fmt.Printf("Runs: %d, Time taken: %v\n", report.Runs, time.Now().Sub(startTime))
+    printPerfReport(report, outDir)
+}
+
+// startSwarm runs the simulations concurrently until max_runs or the first failure,
+// and reports the seed and the options reproducing the failure.
+func startSwarm(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPath string, outDir string, coverage *modelchecker.Coverage, guide *modelchecker.SimulationGuide) {
+    s := modelchecker.NewSwarm([]*ast.File{f}, stateConfig, dirPath, workers, maxRuns, seed)
+    s.SetSimulationGuide(guide)
+    c := make(chan os.Signal)
+    signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-c
+        fmt.Println("\nInterrupted. Stopping state exploration")
+        s.Stop()
+    }()
+    fmt.Println("Swarm workers:", workers)
+    startTime := time.Now()
+    failure := s.Start()
+    coverage.Merge(s.Coverage())
+    fmt.Printf("Runs: %d, Distinct states: %d, Time taken: %v\n", s.Runs(), s.DistinctStates(), time.Now().Sub(startTime))
+    if failure == nil {
+        fmt.Println("Stopped after", s.Runs(), "runs at ", time.Now())
+        return
+    }
+    if failure.Err != nil {
+        var modelErr *modelchecker.ModelError
+        if errors.As(failure.Err, &modelErr) {
+            fmt.Println("Stack Trace:")
+            fmt.Println(modelErr.SprintStackTrace())
+        } else {
+            fmt.Println("Error:", failure.Err)
+        }
+        fmt.Println("seed:", failure.Seed)
+        os.Exit(1)
+    }
+    p1, failedNode := failure.Processor, failure.FailedNode
+    if lasso := p1.LassoFailure(); lasso != nil {
+        fmt.Println("FAILED: Liveness check failed")
+        fmt.Printf("Property: %s\n", lasso.Property.Name)
+        if lasso.Instance != "" {
+            fmt.Printf("Instance: %s\n", lasso.Instance)
+        }
+    } else if failedNode.HasFailedInvariants() {
+        invariant := f.Invariants[failedNode.FailedInvariants[0][0]]
+        fmt.Println("FAILED: Model checker failed. Invariant: ", invariant.Name)
+        printTransition(invariant, failedNode)
+    } else {
+        fmt.Println("FAILED: Model checker failed. Deadlock/stuttering detected")
+    }
+    fmt.Println("seed:", failure.Seed)
+    fmt.Printf("Options: max_actions=%d, max_concurrent_actions=%d, crash_on_yield=%t\n",
+        failure.Options.GetOptions().GetMaxActions(), failure.Options.GetOptions().GetMaxConcurrentActions(),
+        failure.Options.GetOptions().GetCrashOnYield())
+    fmt.Printf("To reproduce, run with: --swarm --swarm_replay --seed %d\n", failure.Seed)
+    if lasso := p1.LassoFailure(); lasso != nil {
+        GenerateFailurePath(lasso.Path, lasso.Property.Position, outDir)
+        return
+    }
+    dumpFailedNode(failedNode, failure.Root, outDir)
+    if failedNode.HasFailedInvariants() {
+        dumpMinimizedPath(p1, failedNode, failedNode.FailedInvariants[0][0], outDir)
+    }
+}
+
 func startCpuProfile() {
     // Start CPU profiling
     f, err := os.Create("cpu.pprof")
@@ -340,6 +655,92 @@ func dumpFailedNode(failedNode *modelchecker.Node, rootNode *modelchecker.Node,
     GenerateFailurePath(failurePath, nil, outDir)
 }
 
+// printCoverage prints the parts of the spec never exercised, and writes the
+// full report to coverage.json in the output directory.
+func printCoverage(report *modelchecker.CoverageReport, outDir string) {
+    fmt.Print(report)
+    bytes, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        fmt.Println("Error creating coverage json:", err)
+        return
+    }
+    err = os.WriteFile(filepath.Join(outDir, "coverage.json"), bytes, 0644)
+    if err != nil {
+        fmt.Println("Error writing coverage json:", err)
+    }
+}
+
+// printPerfReport prints the performance analysis, and writes it to perf.json
+// in the output directory, with the CDF of each counter in perf_distributions.csv.
+func printPerfReport(report *modelchecker.PerfReport, outDir string) {
+    fmt.Print(report)
+    bytes, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        fmt.Println("Error creating perf json:", err)
+        return
+    }
+    err = os.WriteFile(filepath.Join(outDir, "perf.json"), bytes, 0644)
+    if err != nil {
+        fmt.Println("Error writing perf json:", err)
+    }
+    csvFile, err := os.Create(filepath.Join(outDir, "perf_distributions.csv"))
+    if err != nil {
+        fmt.Println("Error creating perf csv:", err)
+        return
+    }
+    defer csvFile.Close()
+    err = modelchecker.WriteDistributionsCSV(csvFile, report.Distributions)
+    if err != nil {
+        fmt.Println("Error writing perf csv:", err)
+    }
+}
+
+// printPerfComparison prints the comparison of the performance models, and writes it to
+// perf_comparison.csv in the output directory.
+func printPerfComparison(comparison *modelchecker.PerfComparison, outDir string) {
+    fmt.Print(comparison)
+    csvFile, err := os.Create(filepath.Join(outDir, "perf_comparison.csv"))
+    if err != nil {
+        fmt.Println("Error creating perf comparison csv:", err)
+        return
+    }
+    defer csvFile.Close()
+    err = comparison.WriteCSV(csvFile)
+    if err != nil {
+        fmt.Println("Error writing perf comparison csv:", err)
+    }
+}
+
+// printTransition prints the offending transition for the transition assertions.
+func printTransition(invariant *ast.Invariant, failedNode *modelchecker.Node) {
+    if !invariant.Transition {
+        return
+    }
+    names := make([]string, 0)
+    for _, link := range modelchecker.TransitionPath(failedNode) {
+        names = append(names, link.Name)
+    }
+    fmt.Println("Transition: ", strings.Join(names, " -> "))
+}
+
+// dumpMinimizedPath writes the minimized failure path to the `minimized` directory
+// in the output directory, alongside the original.
+func dumpMinimizedPath(p1 *modelchecker.Processor, failedNode *modelchecker.Node, invariantIndex int, outDir string) {
+    minimized := p1.MinimizeFailurePath(failedNode, invariantIndex)
+    if minimized == nil {
+        fmt.Println("Failure path could not be minimized further")
+        return
+    }
+    fmt.Printf("\nMinimized failure path: %d steps\n", len(minimized))
+    minimizedDir := filepath.Join(outDir, "minimized")
+    err := os.MkdirAll(minimizedDir, 0755)
+    if err != nil {
+        fmt.Println("Error creating directory:", err)
+        return
+    }
+    GenerateFailurePath(minimized, nil, minimizedDir)
+}
+
 func GenerateFailurePath(failurePath []*modelchecker.Link, invariant *modelchecker.InvariantPosition, outDir string) {
     for _, link := range failurePath {
         node := link.Node
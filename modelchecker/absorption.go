@@ -0,0 +1,323 @@
+package modelchecker
+
+import (
+	"container/heap"
+	"fizz/proto"
+	"sort"
+	"strings"
+)
+
+// AbsorbingClass is a bottom strongly connected component of the Markov chain, that the chain
+// never leaves once reached. A terminal state is an absorbing class with a single state.
+type AbsorbingClass struct {
+	// States are the distinct states in the class, named by perfStateName.
+	States []string `json:"states"`
+	// Probability is the probability of the chain eventually reaching the class.
+	Probability float64 `json:"probability"`
+	// ExpectedCounters are the expected counters until the class is reached, given it is reached.
+	// That is, PRISM's R=? [F class] for the runs reaching the class.
+	ExpectedCounters map[string]float64 `json:"expectedCounters"`
+}
+
+// name names the class in the reports, by its states, within brackets if there are several.
+func (c *AbsorbingClass) name() string {
+	states := strings.Join(c.States, ", ")
+	if len(c.States) > 1 {
+		states = "[" + states + "]"
+	}
+	return states
+}
+
+// AbsorptionReport is the exact absorption analysis of the Markov chain, from the solution
+// of the linear systems of the fundamental matrix N = (I-Q)^-1, where Q are the transition
+// probabilities between the transient states.
+type AbsorptionReport struct {
+	// Classes are the absorbing classes reachable from the init node, from the most probable.
+	Classes []*AbsorbingClass `json:"classes"`
+	// ExpectedCounters are the expected counters until an absorbing class is reached.
+	ExpectedCounters map[string]float64 `json:"expectedCounters"`
+}
+
+// AnalyzeAbsorption computes the absorption probabilities and the expected counters exactly.
+func AnalyzeAbsorption(root *Node, perfModel *proto.PerformanceModel) (*AbsorptionReport, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeAbsorption(root, configs), nil
+}
+
+func analyzeAbsorption(root *Node, configs *perfConfigs) *AbsorptionReport {
+	nodes, _, _, _ := getAllNodes(root, 0)
+	transitionMatrix := genTransitionMatrix(nodes, configs)
+	counterMatrices := genCounterMatrices(nodes, configs)
+
+	system := newTransientSystem(transitionMatrix)
+	transientIndex, transient := system.index, system.states
+	component := system.component
+
+	report := &AbsorptionReport{ExpectedCounters: make(map[string]float64)}
+	if transientIndex[0] < 0 {
+		report.Classes = append(report.Classes, &AbsorbingClass{
+			States:           classStates(nodes, system.classes[component[0]]),
+			Probability:      1.0,
+			ExpectedCounters: zeroCounters(counterMatrices),
+		})
+		report.ExpectedCounters = zeroCounters(counterMatrices)
+		return report
+	}
+	visits := system.visits(0)
+
+	// The expected counter increment of a step from each transient state.
+	rewards := make(map[string][]float64)
+	for counter, matrix := range counterMatrices {
+		rewards[counter] = transitionMatrix.rowProducts(matrix)
+		total := 0.0
+		for t, i := range transient {
+			total += visits[t] * rewards[counter][i]
+		}
+		report.ExpectedCounters[counter] = total
+	}
+
+	for id, step := range system.steps {
+		// absorption[t] is the probability of reaching the class from the transient state t.
+		absorption := system.lu.solve(step)
+		class := &AbsorbingClass{
+			States:           classStates(nodes, system.classes[id]),
+			Probability:      absorption[transientIndex[0]],
+			ExpectedCounters: make(map[string]float64),
+		}
+		if class.Probability <= 0 {
+			continue
+		}
+		reached := func(j int) float64 {
+			if transientIndex[j] >= 0 {
+				return absorption[transientIndex[j]]
+			}
+			if component[j] == id {
+				return 1.0
+			}
+			return 0.0
+		}
+		for counter, matrix := range counterMatrices {
+			// The counters of the transitions from which the class is still reachable,
+			// weighted by the probability of reaching it.
+			total := 0.0
+			for t, i := range transient {
+				cols, values := transitionMatrix.row(i)
+				for k, j := range cols {
+					total += visits[t] * values[k] * matrix.get(i, j) * reached(j)
+				}
+			}
+			class.ExpectedCounters[counter] = total / class.Probability
+		}
+		report.Classes = append(report.Classes, class)
+	}
+	sort.SliceStable(report.Classes, func(i, j int) bool {
+		if report.Classes[i].Probability != report.Classes[j].Probability {
+			return report.Classes[i].Probability > report.Classes[j].Probability
+		}
+		return lessStrings(report.Classes[i].States, report.Classes[j].States)
+	})
+	return report
+}
+
+// transientSystem is the linear system of the fundamental matrix N = (I-Q)^-1 of a Markov chain,
+// where Q are the transition probabilities between the transient states.
+type transientSystem struct {
+	component []int
+	// index is the index of each transient state in the system, or -1 for the recurrent states.
+	index []int
+	// states are the transient states, in the order of the states in the chain.
+	states []int
+	// classes are the states of each bottom component.
+	classes map[int][]int
+	// steps are the probabilities of moving to each bottom component in one step from each transient state.
+	steps map[int][]float64
+	lu    *sparseLU
+}
+
+func newTransientSystem(transitionMatrix *sparseMatrix) *transientSystem {
+	component, bottom := transitionMatrix.bottomComponents()
+	system := &transientSystem{
+		component: component,
+		index:     make([]int, transitionMatrix.n),
+		states:    make([]int, 0),
+		classes:   make(map[int][]int),
+		steps:     make(map[int][]float64),
+	}
+	for j := range system.index {
+		if bottom[component[j]] {
+			system.index[j] = -1
+			system.classes[component[j]] = append(system.classes[component[j]], j)
+			continue
+		}
+		system.index[j] = len(system.states)
+		system.states = append(system.states, j)
+	}
+
+	rows := make([]map[int]float64, len(system.states))
+	for t, i := range system.states {
+		rows[t] = map[int]float64{t: 1.0}
+		cols, values := transitionMatrix.row(i)
+		for k, j := range cols {
+			if system.index[j] >= 0 {
+				rows[t][system.index[j]] -= values[k]
+				continue
+			}
+			if system.steps[component[j]] == nil {
+				system.steps[component[j]] = make([]float64, len(system.states))
+			}
+			system.steps[component[j]][t] += values[k]
+		}
+	}
+	system.lu = newSparseLU(rows)
+	return system
+}
+
+// visits returns the expected number of visits to each transient state from the transient
+// state start, by the index in the system. That is the row of N, from N^T e_start.
+func (s *transientSystem) visits(start int) []float64 {
+	init := make([]float64, len(s.states))
+	init[s.index[start]] = 1.0
+	return s.lu.solveTransposed(init)
+}
+
+func classStates(nodes []*Node, members []int) []string {
+	seen := make(map[string]bool)
+	states := make([]string, 0)
+	for _, j := range members {
+		if nodes[j].Process == nil || seen[perfStateName(nodes[j])] {
+			continue
+		}
+		seen[perfStateName(nodes[j])] = true
+		states = append(states, perfStateName(nodes[j]))
+	}
+	sort.Strings(states)
+	return states
+}
+
+func zeroCounters(counterMatrices map[string]*sparseMatrix) map[string]float64 {
+	counters := make(map[string]float64)
+	for counter := range counterMatrices {
+		counters[counter] = 0.0
+	}
+	return counters
+}
+
+func lessStrings(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// sparseLU is the LU factorization of a sparse matrix, without pivoting. I-Q is a
+// nonsingular M-matrix, diagonally dominant, so the factorization is stable without pivoting.
+type sparseLU struct {
+	// lower are the entries of L below the diagonal, the diagonal of L is 1.
+	lower []map[int]float64
+	// upper are the entries of U on and above the diagonal.
+	upper []map[int]float64
+}
+
+func newSparseLU(rows []map[int]float64) *sparseLU {
+	lu := &sparseLU{
+		lower: make([]map[int]float64, len(rows)),
+		upper: make([]map[int]float64, len(rows)),
+	}
+	for i, original := range rows {
+		row := make(map[int]float64, len(original))
+		pending := &intHeap{}
+		for k, v := range original {
+			row[k] = v
+			if k < i {
+				heap.Push(pending, k)
+			}
+		}
+		lu.lower[i] = make(map[int]float64)
+		// Eliminate the entries below the diagonal in the increasing order of the columns,
+		// as the elimination of a column can fill in the columns after it.
+		for pending.Len() > 0 {
+			k := heap.Pop(pending).(int)
+			if _, ok := lu.lower[i][k]; ok {
+				continue
+			}
+			factor := row[k] / lu.upper[k][k]
+			lu.lower[i][k] = factor
+			delete(row, k)
+			for j, u := range lu.upper[k] {
+				if j == k {
+					continue
+				}
+				if _, ok := row[j]; !ok && j < i {
+					heap.Push(pending, j)
+				}
+				row[j] -= factor * u
+			}
+		}
+		lu.upper[i] = row
+	}
+	return lu
+}
+
+// solve returns x with A x = b.
+func (lu *sparseLU) solve(b []float64) []float64 {
+	n := len(b)
+	y := make([]float64, n)
+	for i := 0; i < n; i++ {
+		y[i] = b[i]
+		for k, l := range lu.lower[i] {
+			y[i] -= l * y[k]
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		x[i] = y[i]
+		for j, u := range lu.upper[i] {
+			if j != i {
+				x[i] -= u * x[j]
+			}
+		}
+		x[i] /= lu.upper[i][i]
+	}
+	return x
+}
+
+// solveTransposed returns x with A^T x = b, that is U^T L^T x = b.
+func (lu *sparseLU) solveTransposed(b []float64) []float64 {
+	n := len(b)
+	z := make([]float64, n)
+	copy(z, b)
+	for k := 0; k < n; k++ {
+		z[k] /= lu.upper[k][k]
+		for j, u := range lu.upper[k] {
+			if j != k {
+				z[j] -= u * z[k]
+			}
+		}
+	}
+	x := z
+	for i := n - 1; i >= 0; i-- {
+		for k, l := range lu.lower[i] {
+			x[k] -= l * x[i]
+		}
+	}
+	return x
+}
+
+// intHeap is a min-heap of ints, for container/heap.
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,159 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"go.starlark.net/starlark"
+	"strings"
+)
+
+// ActionArgWildcard matches any value of the argument in the action options
+// for the parameterized actions, like `Send(n1,*)`.
+const ActionArgWildcard = "*"
+
+// actionBinding is the values bound to the parameters of an action
+// like `action Send(src in NODES, dst in NODES)`.
+type actionBinding struct {
+	names  []string
+	values []starlark.Value
+}
+
+// with returns a new binding with the additional parameter bound to the value.
+func (b *actionBinding) with(name string, value starlark.Value) *actionBinding {
+	return &actionBinding{
+		names:  append(b.names[:len(b.names):len(b.names)], name),
+		values: append(b.values[:len(b.values):len(b.values)], value),
+	}
+}
+
+// addTo adds the bound values to the variables.
+func (b *actionBinding) addTo(vars starlark.StringDict) {
+	for i, name := range b.names {
+		vars[name] = b.values[i]
+	}
+}
+
+// args returns the display strings of the bound values.
+func (b *actionBinding) args() []string {
+	args := make([]string, len(b.values))
+	for i, value := range b.values {
+		args[i] = actionArgString(value)
+	}
+	return args
+}
+
+// labeledName returns the transition name for the binding like `Send(n1,n2)`.
+func (b *actionBinding) labeledName(actionName string) string {
+	if b == nil {
+		return actionName
+	}
+	return fmt.Sprintf("%s(%s)", actionName, strings.Join(b.args(), ","))
+}
+
+// patterns returns the names used for the per-argument limits, that is, the labeled
+// name with every combination of the arguments replaced by the wildcard. The pattern
+// with only the wildcards is excluded, as it is the same as the action name.
+func (b *actionBinding) patterns(actionName string) []string {
+	args := b.args()
+	n := len(args)
+	patterns := make([]string, 0, 1<<n)
+	for mask := 0; mask < (1<<n)-1; mask++ {
+		pattern := make([]string, n)
+		for i := range args {
+			if mask&(1<<i) != 0 {
+				pattern[i] = ActionArgWildcard
+			} else {
+				pattern[i] = args[i]
+			}
+		}
+		patterns = append(patterns, fmt.Sprintf("%s(%s)", actionName, strings.Join(pattern, ",")))
+	}
+	return patterns
+}
+
+func actionArgString(value starlark.Value) string {
+	switch v := value.(type) {
+	case starlark.String:
+		return v.GoString()
+	case *lib.Role:
+		return v.RefStringShort()
+	default:
+		return strings.ReplaceAll(value.String(), lib.SymmetryPrefix, "")
+	}
+}
+
+// expandActionParams returns every binding of the action parameters to the values
+// in their domains. The domain of a parameter can refer to the previous parameters.
+func (p *Processor) expandActionParams(statProcess *Process, role *lib.Role, action *ast.Action) []*actionBinding {
+	var self *lib.Role
+	if role != nil {
+		self = findRole(statProcess.Roles, role)
+		if self == nil {
+			return nil
+		}
+	}
+	filename := p.Files[0].GetSourceInfo().GetFileName()
+	vars := statProcess.getGuardVariables(self)
+	bindings := []*actionBinding{{}}
+	for _, param := range action.Params {
+		next := make([]*actionBinding, 0, len(bindings))
+		for _, binding := range bindings {
+			binding.addTo(vars)
+			val, err := statProcess.Evaluator.EvalExpr(filename, param.DomainExpr, vars)
+			statProcess.PanicOnError(param.GetSourceInfo(), fmt.Sprintf("Error evaluating domain: %s", param.DomainExpr.GetPyExpr()), err)
+			domain, ok := val.(starlark.Iterable)
+			statProcess.PanicIfFalse(ok, param.GetSourceInfo(), fmt.Sprintf("Domain %s of parameter %s must be iterable, got %s", param.DomainExpr.GetPyExpr(), param.Name, val.Type()))
+			iter := domain.Iterate()
+			var x starlark.Value
+			for iter.Next(&x) {
+				next = append(next, binding.with(param.Name, x))
+			}
+			iter.Done()
+		}
+		bindings = next
+	}
+	return bindings
+}
+
+// exceedsBindingLimits checks the action options for the binding, like `Send(n1,n2)`
+// or with wildcards like `Send(n1,*)`. For roles, the keys can be prefixed like the
+// other action options, `Server#0.Send(n1,*)`, `Server#.Send(n1,*)` or `Server.Send(n1,*)`
+func (p *Processor) exceedsBindingLimits(statProcess *Process, role *lib.Role, action *ast.Action, binding *actionBinding) bool {
+	if binding == nil || len(p.config.ActionOptions) == 0 {
+		return false
+	}
+	for _, pattern := range binding.patterns(action.Name) {
+		if p.ExceedsActionCountLimits(&ast.Action{Name: pattern}, statProcess, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordBinding names the transition with the bound values, and binds the
+// values as the arguments in the root frame of the action.
+func (n *Node) recordBinding(role *lib.Role, action *ast.Action, binding *actionBinding, frame *CallFrame) {
+	prefix := ""
+	if role != nil {
+		prefix = role.RefStringShort() + "."
+	}
+	name := prefix + binding.labeledName(action.Name)
+	n.Process.Name = name
+	n.Inbound[0].Name = name
+	for _, pattern := range binding.patterns(action.Name) {
+		n.Process.Stats.Counts[prefix+pattern]++
+	}
+
+	roleRefs := make(map[string]*lib.Role)
+	for i, r := range n.Process.Roles {
+		roleRefs[r.RefString()] = n.Process.Roles[i]
+	}
+	frame.vars = starlark.StringDict{}
+	frame.params = true
+	for i, name := range binding.names {
+		value, err := deepCloneStarlarkValue(binding.values[i], roleRefs)
+		n.Process.PanicOnError(action.Params[i].GetSourceInfo(), fmt.Sprintf("Error binding parameter %s", name), err)
+		frame.vars[name] = value
+	}
+}
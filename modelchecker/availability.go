@@ -0,0 +1,91 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"sort"
+)
+
+// Availability is the long run fraction of the actions after which a state predicate holds,
+// like the fraction of the time a leader is elected.
+type Availability struct {
+	Name      string  `json:"name"`
+	Predicate string  `json:"predicate"`
+	Fraction  float64 `json:"fraction"`
+	// Components are the bottom strongly connected components of the chain, where the chain
+	// stays in the long run. A reducible chain can end in any of them, with its probability.
+	Components []*ComponentAvailability `json:"components"`
+}
+
+type ComponentAvailability struct {
+	// States are the distinct states in the component, named by perfStateName.
+	States []string `json:"states"`
+	// Probability is the probability of the chain ending in the component.
+	Probability float64 `json:"probability"`
+	// Fraction is the long run fraction of the actions after which the predicate holds, once in the component.
+	Fraction float64 `json:"fraction"`
+}
+
+// AnalyzeAvailability computes the long run fraction of each state predicate in the PerformanceModel,
+// over the chain between the yield points like the S=? queries, sorted by the name of the predicate.
+func AnalyzeAvailability(root *Node, perfModel *proto.PerformanceModel) ([]*Availability, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeAvailability(root, configs, newSolverOptions(perfModel))
+}
+
+func analyzeAvailability(root *Node, configs *perfConfigs, options *solverOptions) ([]*Availability, error) {
+	result := make([]*Availability, 0, len(configs.model.GetStatePredicates()))
+	if len(configs.model.GetStatePredicates()) == 0 {
+		return result, nil
+	}
+	chain := newYieldChain(root, configs, options)
+	init := make([]float64, len(chain.nodes))
+	init[chain.init] = 1.0
+	distribution, _ := options.longRunDistribution(chain.matrix, init)
+	component, bottom := chain.matrix.bottomComponents()
+	members := make(map[int][]int)
+	for i := range chain.nodes {
+		if bottom[component[i]] && distribution[i] > 0 {
+			members[component[i]] = append(members[component[i]], i)
+		}
+	}
+
+	for name, predicate := range configs.model.GetStatePredicates() {
+		holds, err := chain.satisfying(predicate)
+		if err != nil {
+			return nil, fmt.Errorf("state predicate %s: %w", name, err)
+		}
+		availability := &Availability{
+			Name:       name,
+			Predicate:  predicate,
+			Components: make([]*ComponentAvailability, 0, len(members)),
+		}
+		for _, states := range members {
+			c := &ComponentAvailability{States: classStates(chain.nodes, states)}
+			held := 0.0
+			for _, i := range states {
+				c.Probability += distribution[i]
+				if holds[i] {
+					held += distribution[i]
+				}
+			}
+			c.Fraction = held / c.Probability
+			availability.Fraction += held
+			availability.Components = append(availability.Components, c)
+		}
+		sort.Slice(availability.Components, func(i, j int) bool {
+			if availability.Components[i].Probability != availability.Components[j].Probability {
+				return availability.Components[i].Probability > availability.Components[j].Probability
+			}
+			return lessStrings(availability.Components[i].States, availability.Components[j].States)
+		})
+		result = append(result, availability)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
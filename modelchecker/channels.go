@@ -0,0 +1,130 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"go.starlark.net/starlark"
+)
+
+// ChannelFaultLinkType is the link type for the scheduler injected channel faults,
+// like message loss and duplication.
+const ChannelFaultLinkType = "fault"
+
+// channelRef locates a channel in the process, either as a state variable
+// or as a field of a role instance.
+type channelRef struct {
+	// name is the state variable name or the role field name like `inbox`
+	name    string
+	role    *lib.Role
+	channel *lib.Channel
+}
+
+// String returns the qualified name of the channel, like `net` or `Server#0.inbox`
+func (c *channelRef) String() string {
+	if c.role != nil {
+		return c.role.RefStringShort() + "." + c.name
+	}
+	return c.name
+}
+
+// receiver returns the receiver of the messages in the channel for the communication graph.
+func (c *channelRef) receiver() string {
+	if c.role != nil {
+		return c.role.RefStringShort()
+	}
+	return c.name
+}
+
+// findChannels returns the channels in the state variables and the role fields.
+// Channels nested within other values are not included.
+func (p *Process) findChannels() []*channelRef {
+	channels := make([]*channelRef, 0)
+	for _, name := range p.Heap.state.Keys() {
+		if ch, ok := p.Heap.state[name].(*lib.Channel); ok {
+			channels = append(channels, &channelRef{name: name, channel: ch})
+		}
+	}
+	for _, role := range p.Roles {
+		fields := starlark.StringDict{}
+		role.Fields.ToStringDict(fields)
+		for _, name := range fields.Keys() {
+			if ch, ok := fields[name].(*lib.Channel); ok {
+				channels = append(channels, &channelRef{name: name, role: role, channel: ch})
+			}
+		}
+	}
+	return channels
+}
+
+// recordChannelMessages records the messages sent on the channels by the frame,
+// so they show up in the communication graph.
+func (p *Process) recordChannelMessages(frame *CallFrame) {
+	for _, ref := range p.findChannels() {
+		for _, msg := range ref.channel.DrainSent() {
+			message := &ast.Message{
+				Receivers: []string{ref.receiver()},
+				Name:      ref.name,
+				Values:    []*ast.NameValue{{Value: msg.String()}},
+				Lossy:     ref.channel.Lossy,
+			}
+			if frame.obj != nil {
+				message.Sender = frame.obj.RefStringShort()
+			}
+			p.Messages = append(p.Messages, message)
+		}
+	}
+}
+
+// scheduleChannelFaults schedules a transition for each message that can be lost
+// or duplicated by the channels. These count as actions, so the limits can be set
+// in the action options with names like `net.drop` or `Server#.inbox.duplicate`.
+func (p *Processor) scheduleChannelFaults(node *Node, process *Process) {
+	statProcess := process
+	if process == nil {
+		statProcess = node.Process
+	}
+	for _, ref := range statProcess.findChannels() {
+		seen := make(map[string]bool)
+		for i, msg := range ref.channel.Messages() {
+			// Identical messages lead to the identical states, so skip them.
+			if seen[msg.String()] {
+				continue
+			}
+			seen[msg.String()] = true
+			if ref.channel.Lossy {
+				p.scheduleChannelFault(node, process, statProcess, ref, i, "drop")
+			}
+			if ref.channel.Duplicating {
+				p.scheduleChannelFault(node, process, statProcess, ref, i, "duplicate")
+			}
+		}
+	}
+}
+
+func (p *Processor) scheduleChannelFault(node *Node, process *Process, statProcess *Process,
+	ref *channelRef, index int, fault string) {
+
+	faultAction := &ast.Action{Name: ref.name + "." + fault}
+	if p.ExceedsActionCountLimits(faultAction, statProcess, ref.role) {
+		return
+	}
+	msg := ref.channel.Messages()[index]
+	newNode := node.ForkForAction(process, ref.role, faultAction)
+	newNode.Inbound[0].Type = ChannelFaultLinkType
+	newNode.Inbound[0].Labels = append(newNode.Inbound[0].Labels, fmt.Sprintf("%s(%s)", fault, msg.String()))
+
+	for _, other := range newNode.Process.findChannels() {
+		if other.String() != ref.String() {
+			continue
+		}
+		if fault == "drop" {
+			other.channel.Drop(index)
+		} else {
+			other.channel.Duplicate(index)
+		}
+		newNode.Process.Enable()
+		p.queue.Add(newNode)
+		return
+	}
+}
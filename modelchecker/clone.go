@@ -2,6 +2,7 @@ package modelchecker
 
 import (
     "fmt"
+    "maps"
     "github.com/fizzbee-io/fizzbee/lib"
     "go.starlark.net/starlark"
 )
@@ -127,6 +128,17 @@ func deepCloneStarlarkValueWithPermutations(value starlark.Value, refs map[strin
             newBag.Insert(clonedElem)
         }
         return newBag, nil
+    case "channel":
+        c := value.(*lib.Channel)
+        newChannel := lib.NewChannel(c.Ordering, c.Lossy, c.Duplicating)
+        for _, msg := range c.Messages() {
+            clonedMsg, err := deepCloneStarlarkValueWithPermutations(msg, refs, permutations, alt)
+            if err != nil {
+                return nil, err
+            }
+            newChannel.Insert(clonedMsg)
+        }
+        return newChannel, nil
     case "role":
         r := value.(*lib.Role)
         prefix := r.Name
@@ -156,12 +168,15 @@ func deepCloneStarlarkValueWithPermutations(value starlark.Value, refs map[strin
                 return nil, err
             }
             newRole := &lib.Role{
-                Ref:       id,
-                Name:      prefix,
-                Symmetric: r.IsSymmetric(),
-                Params:    params.(*lib.Struct),
-                Fields:    fields.(*lib.Struct),
-                Methods:   r.Methods,
+                Ref:        id,
+                Name:       prefix,
+                Symmetric:  r.IsSymmetric(),
+                Params:     params.(*lib.Struct),
+                Fields:     fields.(*lib.Struct),
+                Methods:    r.Methods,
+                InitFields: r.InitFields,
+                Crashed:    r.Crashed,
+                Timers:     maps.Clone(r.Timers),
             }
             refs[newRole.RefString()] = newRole
             return newRole, nil
@@ -0,0 +1,159 @@
+package modelchecker
+
+import (
+	"encoding/csv"
+	"fizz/proto"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CounterDistribution is the distribution of a counter until termination, that is until the
+// chain reaches an absorbing class, like the time to completion in the LatencyReport.
+type CounterDistribution struct {
+	Counter  string  `json:"counter"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	StdDev   float64 `json:"stdDev"`
+	// Percentiles are the smallest values with the cumulative probability at the percentiles.
+	Percentiles []CounterPercentile `json:"percentiles"`
+	// CDF is the cumulative probability of each value of the counter, in the increasing order.
+	CDF []CDFPoint `json:"cdf"`
+}
+
+type CounterPercentile struct {
+	Percentile float64 `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+type CDFPoint struct {
+	Value       float64 `json:"value"`
+	Probability float64 `json:"probability"`
+}
+
+// AnalyzeCounterDistributions computes the distribution of each counter until termination. The mean
+// and the variance are from the histogram, and the CDF from moving the probability of each state and
+// value of the counter forward, until the probability not terminated is below the tolerance.
+func AnalyzeCounterDistributions(root *Node, perfModel *proto.PerformanceModel, histogram *Histogram) ([]*CounterDistribution, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeCounterDistributions(root, configs, histogram), nil
+}
+
+func analyzeCounterDistributions(root *Node, configs *perfConfigs, histogram *Histogram) []*CounterDistribution {
+	options := newSolverOptions(configs.model)
+	nodes, _, _, _ := getAllNodes(root, 0)
+	transitionMatrix := genTransitionMatrix(nodes, configs)
+	counterMatrices := genCounterMatrices(nodes, configs)
+	component, bottom := transitionMatrix.bottomComponents()
+
+	distributions := make([]*CounterDistribution, 0, len(counterMatrices))
+	for counter, matrix := range counterMatrices {
+		probabilities := counterProbabilities(transitionMatrix, matrix, component, bottom, options)
+		distribution := newCounterDistribution(counter, histogram.GetMean(counter), histogram.GetVariance(counter), probabilities)
+		distributions = append(distributions, distribution)
+	}
+	sort.Slice(distributions, func(i, j int) bool {
+		return distributions[i].Counter < distributions[j].Counter
+	})
+	return distributions
+}
+
+// counterProbabilities returns the probability of terminating with each value of the counter.
+func counterProbabilities(transitionMatrix *sparseMatrix, counterMatrix *sparseMatrix, component []int, bottom []bool, options *solverOptions) map[float64]float64 {
+	terminated := make(map[float64]float64)
+	if bottom[component[0]] {
+		terminated[0] = 1.0
+		return terminated
+	}
+	// frontier is the probability of being at each transient state with each value of the counter.
+	frontier := map[int]map[float64]float64{0: {0: 1.0}}
+	for iteration := 0; iteration < options.maxIterations && len(frontier) > 0; iteration++ {
+		next := make(map[int]map[float64]float64)
+		remaining := 0.0
+		for i, values := range frontier {
+			cols, probabilities := transitionMatrix.row(i)
+			for k, j := range cols {
+				increment := counterMatrix.get(i, j)
+				for value, mass := range values {
+					// The values are rounded, so the fractional increments adding up to the same value merge.
+					total := math.Round((value+increment)*1e9) / 1e9
+					if bottom[component[j]] {
+						terminated[total] += mass * probabilities[k]
+						continue
+					}
+					if next[j] == nil {
+						next[j] = make(map[float64]float64)
+					}
+					next[j][total] += mass * probabilities[k]
+					remaining += mass * probabilities[k]
+				}
+			}
+		}
+		frontier = next
+		if remaining < options.tolerance {
+			break
+		}
+	}
+	return terminated
+}
+
+// newCounterDistribution returns the distribution with the CDF and the percentiles from
+// the probability of each value. The probabilities may add up to less than 1, when
+// the probability not terminated is dropped.
+func newCounterDistribution(counter string, mean float64, variance float64, probabilities map[float64]float64) *CounterDistribution {
+	distribution := &CounterDistribution{
+		Counter:     counter,
+		Mean:        mean,
+		Variance:    variance,
+		StdDev:      math.Sqrt(variance),
+		Percentiles: make([]CounterPercentile, 0, len(reportedPercentiles)),
+		CDF:         make([]CDFPoint, 0, len(probabilities)),
+	}
+	values := make([]float64, 0, len(probabilities))
+	for value := range probabilities {
+		values = append(values, value)
+	}
+	sort.Float64s(values)
+	cumulative := 0.0
+	next := 0
+	for _, value := range values {
+		cumulative += probabilities[value]
+		distribution.CDF = append(distribution.CDF, CDFPoint{Value: value, Probability: cumulative})
+		for next < len(reportedPercentiles) && cumulative >= reportedPercentiles[next] {
+			distribution.Percentiles = append(distribution.Percentiles, CounterPercentile{
+				Percentile: reportedPercentiles[next],
+				Value:      value,
+			})
+			next++
+		}
+	}
+	return distribution
+}
+
+// WriteDistributionsCSV writes the CDF of each counter as the rows counter,value,probability,
+// so the distributions of different performance models can be compared side by side.
+func WriteDistributionsCSV(w io.Writer, distributions []*CounterDistribution) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"counter", "value", "probability"})
+	if err != nil {
+		return err
+	}
+	for _, distribution := range distributions {
+		for _, point := range distribution.CDF {
+			err = writer.Write([]string{
+				distribution.Counter,
+				strconv.FormatFloat(point.Value, 'g', -1, 64),
+				strconv.FormatFloat(point.Probability, 'g', -1, 64),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,302 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"strings"
+)
+
+// coveragePc is the program counter of a statement in one of the files.
+type coveragePc struct {
+	file int
+	pc   string
+}
+
+// Coverage records the parts of the spec exercised during the model checking.
+// It is shared by all the processes forked from the same init process.
+type Coverage struct {
+	// statements are the statements executed.
+	statements map[coveragePc]bool
+	// branches are the if/elif/else branches taken, by the pc of the branch.
+	branches map[coveragePc]bool
+	// actions are the actions enabled at least once, like `Commit` or `Server.Commit`.
+	actions map[string]bool
+	// invariants are the expression invariants evaluated in a non-trivial state.
+	invariants map[InvariantPosition]bool
+	// antecedents caches the antecedent of the expression invariants, nil if the
+	// invariant is not an implication.
+	antecedents map[InvariantPosition]syntax.Expr
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		statements:  make(map[coveragePc]bool),
+		branches:    make(map[coveragePc]bool),
+		actions:     make(map[string]bool),
+		invariants:  make(map[InvariantPosition]bool),
+		antecedents: make(map[InvariantPosition]syntax.Expr),
+	}
+}
+
+// Merge adds the coverage from another run, like the other simulation runs.
+func (c *Coverage) Merge(other *Coverage) {
+	for pc := range other.statements {
+		c.statements[pc] = true
+	}
+	for pc := range other.branches {
+		c.branches[pc] = true
+	}
+	for action := range other.actions {
+		c.actions[action] = true
+	}
+	for position := range other.invariants {
+		c.invariants[position] = true
+	}
+}
+
+func (c *Coverage) recordStatement(file int, pc string) {
+	if c == nil {
+		return
+	}
+	c.statements[coveragePc{file: file, pc: pc}] = true
+}
+
+func (c *Coverage) recordBranch(file int, pc string, branch int) {
+	if c == nil {
+		return
+	}
+	c.branches[coveragePc{file: file, pc: fmt.Sprintf("%s.IfStmt.Branches[%d]", pc, branch)}] = true
+}
+
+func (c *Coverage) recordAction(name string) {
+	if c == nil || name == "" {
+		return
+	}
+	c.actions[name] = true
+}
+
+// recordInvariant records whether the expression invariant was evaluated in a non-trivial
+// state. For implications, written as `not A or B` or `B if A else True`, the state is
+// non-trivial only if the antecedent A holds. Any state is non-trivial for the other invariants.
+// The coverage never aborts the model checking, so if the antecedent cannot be parsed or
+// evaluated, the invariant is left as not evaluated in this state.
+func (c *Coverage) recordInvariant(process *Process, fileIndex int, index int, invariant *ast.Invariant) {
+	position := InvariantPosition{FileIndex: fileIndex, InvariantIndex: index}
+	if c == nil || c.invariants[position] {
+		return
+	}
+	antecedent, ok := c.antecedents[position]
+	if !ok {
+		pyExpr := invariant.PyExpr
+		if invariant.Nested != nil {
+			pyExpr = invariant.Nested.PyExpr
+		}
+		var err error
+		antecedent, err = implicationAntecedent(process.Evaluator, pyExpr)
+		if err != nil {
+			return
+		}
+		c.antecedents[position] = antecedent
+	}
+	if antecedent == nil {
+		c.invariants[position] = true
+		return
+	}
+	thread := &starlark.Thread{Name: "coverage"}
+	cond, err := starlark.EvalExprOptions(process.Evaluator.options, thread, antecedent, process.getGuardVariables(nil))
+	if err != nil {
+		return
+	}
+	c.invariants[position] = bool(cond.Truth())
+}
+
+// implicationAntecedent returns the antecedent of the implication, or nil if the
+// expression is not an implication.
+func implicationAntecedent(e *Evaluator, pyExpr string) (syntax.Expr, error) {
+	parsed, err := e.options.ParseExpr("", pyExpr, 0)
+	if err != nil {
+		return nil, err
+	}
+	expr := unparen(parsed)
+	switch expr := expr.(type) {
+	case *syntax.BinaryExpr:
+		if not, ok := unparen(expr.X).(*syntax.UnaryExpr); ok && expr.Op == syntax.OR && not.Op == syntax.NOT {
+			return not.X, nil
+		}
+	case *syntax.CondExpr:
+		if ident, ok := unparen(expr.False).(*syntax.Ident); ok && ident.Name == "True" {
+			return expr.Cond, nil
+		}
+	}
+	return nil, nil
+}
+
+func unparen(expr syntax.Expr) syntax.Expr {
+	for {
+		paren, ok := expr.(*syntax.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+// CoverageReport lists the parts of the spec never exercised. A passing model check
+// says little about the statements it never executed.
+type CoverageReport struct {
+	Statements         int `json:"statements"`
+	ExecutedStatements int `json:"executedStatements"`
+	Branches           int `json:"branches"`
+	TakenBranches      int `json:"takenBranches"`
+
+	// UnexecutedStatements are the locations of the statements never executed,
+	// as file:line, or the program counter if the source info is not available.
+	UnexecutedStatements []string `json:"unexecutedStatements"`
+	// UntakenBranches are the locations of the if/elif/else branches never taken.
+	UntakenBranches []string `json:"untakenBranches"`
+	// NeverEnabledActions are the actions never enabled, excluding the Init actions.
+	NeverEnabledActions []string `json:"neverEnabledActions"`
+	// VacuousInvariants are the invariants never evaluated in a non-trivial state.
+	// That is, the implications whose antecedent never held, and the assertions that
+	// never executed a return statement other than `return True`.
+	VacuousInvariants []string `json:"vacuousInvariants"`
+}
+
+// Report returns the coverage of the files.
+func (c *Coverage) Report(files []*ast.File) *CoverageReport {
+	report := &CoverageReport{
+		UnexecutedStatements: make([]string, 0),
+		UntakenBranches:      make([]string, 0),
+		NeverEnabledActions:  make([]string, 0),
+		VacuousInvariants:    make([]string, 0),
+	}
+	for i, file := range files {
+		fileName := file.GetSourceInfo().GetFileName()
+		visit := func(pc string, stmt *ast.Statement) {
+			report.Statements++
+			if c.statements[coveragePc{file: i, pc: pc}] {
+				report.ExecutedStatements++
+			} else {
+				report.UnexecutedStatements = append(report.UnexecutedStatements, coverageLocation(fileName, stmt.GetSourceInfo(), pc))
+			}
+			for j, branch := range stmt.GetIfStmt().GetBranches() {
+				branchPc := fmt.Sprintf("%s.IfStmt.Branches[%d]", pc, j)
+				report.Branches++
+				if c.branches[coveragePc{file: i, pc: branchPc}] {
+					report.TakenBranches++
+				} else {
+					report.UntakenBranches = append(report.UntakenBranches, coverageLocation(fileName, branch.GetSourceInfo(), branchPc))
+				}
+			}
+		}
+		for j, action := range file.Actions {
+			walkStatements(fmt.Sprintf("Actions[%d].Block", j), action.Block, visit)
+			if action.Name != "Init" && !c.actions[action.Name] {
+				report.NeverEnabledActions = append(report.NeverEnabledActions, action.Name)
+			}
+		}
+		for j, function := range file.Functions {
+			walkStatements(fmt.Sprintf("Functions[%d].Block", j), function.Block, visit)
+		}
+		for r, role := range file.Roles {
+			for j, action := range role.Actions {
+				walkStatements(fmt.Sprintf("Roles[%d].Actions[%d].Block", r, j), action.Block, visit)
+				name := role.Name + "." + action.Name
+				if action.Name != "Init" && !c.actions[name] {
+					report.NeverEnabledActions = append(report.NeverEnabledActions, name)
+				}
+			}
+			for j, function := range role.Functions {
+				walkStatements(fmt.Sprintf("Roles[%d].Functions[%d].Block", r, j), function.Block, visit)
+			}
+		}
+		for j, invariant := range file.Invariants {
+			invariantPc := fmt.Sprintf("Invariants[%d].Block", j)
+			walkStatements(invariantPc, invariant.Block, visit)
+			if !c.isInvariantExercised(i, j, invariant) {
+				report.VacuousInvariants = append(report.VacuousInvariants, invariant.Name)
+			}
+		}
+	}
+	return report
+}
+
+func (c *Coverage) isInvariantExercised(fileIndex int, index int, invariant *ast.Invariant) bool {
+	if invariant.Block == nil {
+		return c.invariants[InvariantPosition{FileIndex: fileIndex, InvariantIndex: index}]
+	}
+	exercised := false
+	walkStatements(fmt.Sprintf("Invariants[%d].Block", index), invariant.Block, func(pc string, stmt *ast.Statement) {
+		returnStmt := stmt.GetReturnStmt()
+		if returnStmt != nil && strings.TrimSpace(returnStmt.PyExpr) != "True" && c.statements[coveragePc{file: fileIndex, pc: pc}] {
+			exercised = true
+		}
+	})
+	return exercised
+}
+
+// walkStatements calls the visit function for every statement in the block, including
+// the nested statements, with the program counter the thread uses for the statement.
+func walkStatements(pc string, block *ast.Block, visit func(pc string, stmt *ast.Statement)) {
+	if block == nil {
+		return
+	}
+	for i, stmt := range block.Stmts {
+		stmtPc := fmt.Sprintf("%s.Stmts[%d]", pc, i)
+		visit(stmtPc, stmt)
+		walkStatements(stmtPc+".Block", stmt.Block, visit)
+		for j, branch := range stmt.GetIfStmt().GetBranches() {
+			walkStatements(fmt.Sprintf("%s.IfStmt.Branches[%d].Block", stmtPc, j), branch.Block, visit)
+		}
+		walkStatements(stmtPc+".ForStmt.Block", stmt.GetForStmt().GetBlock(), visit)
+		walkStatements(stmtPc+".AnyStmt.Block", stmt.GetAnyStmt().GetBlock(), visit)
+		walkStatements(stmtPc+".WhileStmt.Block", stmt.GetWhileStmt().GetBlock(), visit)
+	}
+}
+
+func coverageLocation(fileName string, sourceInfo *ast.SourceInfo, pc string) string {
+	if sourceInfo.GetStart().GetLine() == 0 {
+		return pc
+	}
+	if sourceInfo.GetFileName() != "" {
+		fileName = sourceInfo.GetFileName()
+	}
+	return fmt.Sprintf("%s:%d", fileName, sourceInfo.GetStart().GetLine())
+}
+
+func (r *CoverageReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Coverage: %d/%d statements executed, %d/%d branches taken\n",
+		r.ExecutedStatements, r.Statements, r.TakenBranches, r.Branches)
+	sections := []struct {
+		title string
+		items []string
+	}{
+		{"Statements never executed", r.UnexecutedStatements},
+		{"Branches never taken", r.UntakenBranches},
+		{"Actions never enabled", r.NeverEnabledActions},
+		{"Invariants never exercised in a non-trivial state", r.VacuousInvariants},
+	}
+	for _, section := range sections {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", section.title, strings.Join(unique(section.items), ", "))
+	}
+	return b.String()
+}
+
+// unique removes the duplicates, like the statements on the same line, keeping the order.
+func unique(items []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,289 @@
+package modelchecker
+
+import (
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"slices"
+	"time"
+)
+
+const (
+	// ExplorationBfs explores the state space breadth first, the default.
+	ExplorationBfs = "bfs"
+	// ExplorationDfs explores the state space depth first, checking the liveness on the fly.
+	ExplorationDfs = "dfs"
+	// ExplorationIterativeDeepening repeats the depth first search with increasing max_actions.
+	ExplorationIterativeDeepening = "iterative_deepening"
+)
+
+// dfsFrame is a node on the current path of the depth first search, with the
+// successors not explored yet.
+type dfsFrame struct {
+	node     *Node
+	children []*Node
+	// truncated is true if a successor was not explored because of max_actions.
+	truncated bool
+}
+
+// dfsSearch is the state of the depth first search.
+type dfsSearch struct {
+	stack *lib.Stack[*dfsFrame]
+	// open are the nodes on the current path, whose successors are not all explored yet.
+	open map[*Node]bool
+	// lassos are the loops closed by a back edge, by the first node of the loop on the
+	// current path. The loop is checked once the node is backtracked, as the fairness
+	// of the loop depends on all the outbound links of its nodes.
+	lassos map[*Node][][]*Link
+	// partial are the nodes with successors not explored because of max_actions. The loops
+	// through them are not checked, as their fairness cannot be determined.
+	partial map[*Node]bool
+	// properties are the liveness properties checked on the lassos.
+	properties []*TemporalProperty
+	// truncated is true if a node was not explored because of max_actions.
+	truncated bool
+}
+
+// startDfs explores the state space depth first. The frontier is only the current path,
+// and the liveness properties are checked on the loops as soon as they are explored.
+func (p *Processor) startDfs() (init *Node, failedNode *Node, err error) {
+	startTime := time.Now()
+	init, failedNode, truncated, err := p.depthFirstSearch()
+	if truncated {
+		fmt.Println("Reached max_actions, the state space is explored partially")
+	}
+	fmt.Printf("Nodes: %d, elapsed: %s\n", len(p.visited), time.Since(startTime))
+	return init, failedNode, err
+}
+
+// startIterativeDeepening repeats the depth first search with max_actions from 1 up to the
+// configured max_actions, until a failure is found or the whole state space is explored.
+// Like BFS, the failure is found with the fewest actions to reach the failing state, but the
+// path reported is the first one explored, which can be longer.
+func (p *Processor) startIterativeDeepening() (init *Node, failedNode *Node, err error) {
+	startTime := time.Now()
+	maxActions := p.config.Options.MaxActions
+	defer func() {
+		p.config.Options.MaxActions = maxActions
+	}()
+	for depth := int64(1); ; depth++ {
+		if depth > 1 {
+			p.resetSearch()
+		}
+		p.config.Options.MaxActions = depth
+		var truncated bool
+		init, failedNode, truncated, err = p.depthFirstSearch()
+		fmt.Printf("Depth: %d, Nodes: %d, elapsed: %s\n", depth, len(p.visited), time.Since(startTime))
+		if err != nil || failedNode != nil || p.stopped || !truncated || depth >= maxActions {
+			return init, failedNode, err
+		}
+	}
+}
+
+// resetSearch discards the explored state space, to restart the search from the init node.
+func (p *Processor) resetSearch() {
+	p.Init = nil
+	p.visited = make(map[string]*Node)
+	p.failures = make(map[InvariantPosition]*Node)
+	p.roleRefs = lib.NewRoleRefs()
+	p.lassoFailure = nil
+	p.queue = lib.NewQueue[*Node]()
+	p.intermediate_states = lib.NewQueue[*Node]()
+}
+
+func (p *Processor) depthFirstSearch() (init *Node, failedNode *Node, truncated bool, err error) {
+	if p.Init != nil {
+		panic("processor already started")
+	}
+	init, failedNode, err = p.InitializeNode()
+	if err != nil {
+		return init, failedNode, false, err
+	}
+	if failedNode != nil {
+		p.recordFailure(failedNode)
+	}
+	properties, err := p.simulationProperties()
+	if err != nil {
+		return init, nil, false, err
+	}
+	p.deferred = make(map[*Node][]*Process)
+	search := &dfsSearch{
+		stack:      lib.NewStack[*dfsFrame](),
+		open:       make(map[*Node]bool),
+		lassos:     make(map[*Node][][]*Link),
+		partial:    make(map[*Node]bool),
+		properties: properties,
+	}
+	failed, err := p.dfs(search)
+	if err != nil {
+		return p.Init, nil, search.truncated, err
+	}
+	if failedNode == nil {
+		failedNode = failed
+	}
+	return p.Init, failedNode, search.truncated, nil
+}
+
+func (p *Processor) dfs(search *dfsSearch) (*Node, error) {
+	var failedNode *Node
+	search.stack.Push(&dfsFrame{children: []*Node{p.Init}})
+	for search.stack.Len() > 0 && !p.stopped {
+		frame, _ := search.stack.Peek()
+		if len(frame.children) == 0 {
+			search.stack.Pop()
+			failure, err := p.backtrack(search, frame)
+			if err != nil {
+				return nil, err
+			}
+			if failure != nil {
+				p.lassoFailure = failure
+				return failure.Path[len(failure.Path)-1].Node, nil
+			}
+			continue
+		}
+		node := frame.children[len(frame.children)-1]
+		frame.children = frame.children[:len(frame.children)-1]
+		if len(node.Inbound) > 0 {
+			// The parent can be reached again through a shorter path, after the node was scheduled.
+			node.actionDepth = node.Inbound[0].Node.actionDepth + linkActions(node.Inbound[0])
+		}
+		if node.actionDepth > int(p.config.Options.MaxActions) {
+			search.truncated = true
+			frame.truncated = true
+			continue
+		}
+
+		for {
+			invariantFailure, _ := p.processNode(node)
+			// The successors scheduled by the node are explored before its siblings.
+			children := p.scheduled()
+			yield := node.Process != nil && node.Name == "yield"
+			// No new actions are scheduled at max_actions.
+			truncated := yield && node.actionDepth >= int(p.config.Options.MaxActions)
+			search.truncated = search.truncated || truncated
+			// The yield points without successors are backtracked right away, to check the stuttering.
+			if len(children) > 0 || yield {
+				search.stack.Push(&dfsFrame{node: node, children: children, truncated: truncated})
+				search.open[node] = true
+			}
+			if node.DuplicateOf != nil {
+				p.deepen(search, node.DuplicateOf, node.actionDepth)
+			}
+			for _, link := range node.Outbound {
+				p.deepen(search, link.Node, node.actionDepth+linkActions(link))
+			}
+			if len(search.properties) > 0 && node.Process == nil {
+				if loop := lassoLoop(node); loop != nil {
+					key := frame.node
+					for _, link := range loop {
+						if search.open[link.Node] {
+							key = link.Node
+							break
+						}
+					}
+					search.lassos[key] = append(search.lassos[key], loop)
+				}
+			}
+			if invariantFailure {
+				if failedNode == nil {
+					failedNode = node
+				}
+				p.recordFailure(node)
+				if !p.config.ContinueOnInvariantFailures {
+					return failedNode, nil
+				}
+			}
+			if p.intermediate_states.Len() == 0 {
+				break
+			}
+			node, _ = p.intermediate_states.Remove()
+		}
+	}
+	return failedNode, nil
+}
+
+// scheduled removes the nodes scheduled in the queue, in the order they are explored.
+func (p *Processor) scheduled() []*Node {
+	children := make([]*Node, 0, p.queue.Len())
+	for p.queue.Len() > 0 {
+		child, _ := p.queue.Remove()
+		children = append(children, child)
+	}
+	slices.Reverse(children)
+	return children
+}
+
+// deepen lowers the action depth of the explored node reached again through a shorter path,
+// and of the explored nodes reachable from it. Otherwise, the successors of a state first
+// reached through a longer path would never be explored beyond max_actions of that path.
+// The yield points with actions deferred because of max_actions are expanded once below it.
+func (p *Processor) deepen(search *dfsSearch, node *Node, depth int) {
+	if depth >= node.actionDepth {
+		return
+	}
+	node.actionDepth = depth
+	queue := []*Node{node}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, link := range n.Outbound {
+			if d := n.actionDepth + linkActions(link); d < link.Node.actionDepth {
+				link.Node.actionDepth = d
+				queue = append(queue, link.Node)
+			}
+		}
+		processes, ok := p.deferred[n]
+		if !ok || n.actionDepth >= int(p.config.Options.MaxActions) {
+			continue
+		}
+		delete(p.deferred, n)
+		for _, process := range processes {
+			p.scheduleActions(n, process)
+		}
+		children := p.scheduled()
+		if i := slices.IndexFunc(search.stack.RawArray(), func(f *dfsFrame) bool { return f.node == n }); i >= 0 {
+			frame := search.stack.RawArray()[i]
+			frame.children = append(children, frame.children...)
+			frame.truncated = false
+			continue
+		}
+		search.stack.Push(&dfsFrame{node: n, children: children})
+		search.open[n] = true
+	}
+}
+
+// linkActions returns the number of actions taken by the link, 0 for the continuation of
+// an action in progress.
+func linkActions(link *Link) int {
+	if link.Type == "" {
+		return 0
+	}
+	return 1
+}
+
+// backtrack is called once all the successors of the node in the frame are explored.
+// It checks the loops that start at the node, and the behaviors stuttering at the node.
+func (p *Processor) backtrack(search *dfsSearch, frame *dfsFrame) (*LassoFailure, error) {
+	delete(search.open, frame.node)
+	if frame.truncated {
+		search.partial[frame.node] = true
+	}
+	if len(search.properties) == 0 {
+		return nil, nil
+	}
+	for _, loop := range search.lassos[frame.node] {
+		if slices.ContainsFunc(loop, func(link *Link) bool { return search.partial[link.Node] }) {
+			continue
+		}
+		if failure, err := p.checkLasso(loop, search.properties); failure != nil || err != nil {
+			return failure, err
+		}
+	}
+	delete(search.lassos, frame.node)
+	node := frame.node
+	if node == nil || frame.truncated || (node.Name != "init" && node.Name != "yield") || !canStutter(node) {
+		return nil, nil
+	}
+	path := pathToInit([]*Node{p.Init}, node)
+	stutter := append(path, &Link{Node: node, Name: "stutter"})
+	return p.checkProperties(stutter, len(path)-1, search.properties)
+}
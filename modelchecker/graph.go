@@ -247,6 +247,10 @@ func GenerateDotFile(node *Node, visited map[*Node]bool) string {
 					edgewidth = 3
 				}
 			}
+			if len(child.FailedInvariants[0]) > 0 {
+				// The transition violates a transition assertion.
+				edgecolor = "red"
+			}
 			//if color != "green" {
 			dotGraph += fmt.Sprintf("  %s -> %s [label=\"%s\", color=\"%s\" penwidth=\"%d\" ];\n", nodeID, childID, label, edgecolor, edgewidth)
 			//}
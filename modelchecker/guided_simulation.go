@@ -0,0 +1,311 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"math/rand"
+	"sync"
+)
+
+const (
+	// SimulationUniform picks uniformly among the successors, the default.
+	SimulationUniform = "uniform"
+	// SimulationWeighted picks the successors with the probabilities in the PerformanceModel.
+	SimulationWeighted = "weighted"
+	// SimulationNovelty prefers the successors executing the statements and labels
+	// executed the least in the previous runs.
+	SimulationNovelty = "novelty"
+	// SimulationFuzz replays mutated prefixes of the runs that reached new coverage,
+	// and continues them like SimulationNovelty.
+	SimulationFuzz = "fuzz"
+)
+
+const (
+	// maxCorpusSize is the number of prefixes kept by the fuzzing.
+	maxCorpusSize = 1000
+	// freshRunProbability is the probability of a fuzzing run not replaying any prefix.
+	freshRunProbability = 0.1
+)
+
+// SimulationGuide biases the random walks of the simulation. It is shared by all the runs,
+// so the coverage of the previous runs guides the next ones. With the novelty and fuzz
+// strategies, the runs depend on the previous runs, so the seed alone does not reproduce them.
+type SimulationGuide struct {
+	strategy string
+	// configs are the configs of the PerformanceModel, for the weighted strategy.
+	configs *perfConfigs
+
+	// lock guards the fields below, as the swarm runs the simulations concurrently.
+	lock sync.Mutex
+	// statements is the number of runs that executed each statement.
+	statements map[coveragePc]int
+	// labels is the number of runs that took each label.
+	labels map[string]int
+	// corpus are the choices of the runs that reached new coverage.
+	corpus [][]int
+}
+
+func NewSimulationGuide(strategy string, perfModel *ast.PerformanceModel) (*SimulationGuide, error) {
+	switch strategy {
+	case "":
+		strategy = SimulationUniform
+	case SimulationUniform, SimulationNovelty, SimulationFuzz:
+	case SimulationWeighted:
+		if perfModel == nil {
+			return nil, fmt.Errorf("the %s simulation strategy requires a performance model", strategy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown simulation strategy: %s", strategy)
+	}
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	return &SimulationGuide{
+		strategy:   strategy,
+		configs:    configs,
+		statements: make(map[coveragePc]int),
+		labels:     make(map[string]int),
+	}, nil
+}
+
+// SetSimulationGuide makes the simulation pick the successors with the guide.
+// It must be called before the processor is started.
+func (p *Processor) SetSimulationGuide(guide *SimulationGuide) {
+	if p.Init != nil {
+		panic("processor already started")
+	}
+	if !p.simulation || guide == nil || guide.strategy == SimulationUniform {
+		return
+	}
+	p.guide = guide
+	p.queue = lib.NewGuidedQueue[*Node](p.pickSuccessor)
+	p.intermediate_states = lib.NewGuidedQueue[*Node](p.pickSuccessor)
+	if guide.strategy == SimulationFuzz {
+		p.replay = guide.nextPrefix(&p.random)
+	}
+}
+
+// Choices returns the index of the successor picked at each step of the guided simulation.
+func (p *Processor) Choices() []int {
+	return p.choices
+}
+
+// pickSuccessor picks the next node to explore. The choices are recorded, so the
+// fuzzing can replay the prefix of the run.
+func (p *Processor) pickSuccessor(nodes []*Node) int {
+	var choice int
+	if len(p.choices) < len(p.replay) {
+		choice = p.replay[len(p.choices)] % len(nodes)
+	} else {
+		choice = p.guide.pick(p, nodes)
+	}
+	p.choices = append(p.choices, choice)
+	return choice
+}
+
+func (g *SimulationGuide) pick(p *Processor, nodes []*Node) int {
+	var weights []float64
+	switch g.strategy {
+	case SimulationWeighted:
+		weights = g.probabilities(nodes)
+	case SimulationNovelty, SimulationFuzz:
+		weights = make([]float64, len(nodes))
+		g.lock.Lock()
+		for i, node := range nodes {
+			// The less a statement or a label was executed, the more likely it is picked.
+			count := 0
+			if pc, label := pendingStep(node); pc != nil {
+				count = g.statements[*pc]
+				if p.coverage.statements[*pc] {
+					count++
+				}
+				if label != "" {
+					count += g.labels[label]
+				}
+			}
+			weights[i] = 1 / float64(1+count)
+		}
+		g.lock.Unlock()
+	default:
+		return p.random.Intn(len(nodes))
+	}
+	return pickWeighted(&p.random, weights)
+}
+
+// probabilities returns the probability of each node, from the labels of the transition
+// to the node like genTransitionMatrix does. The nodes without a probability share the rest.
+// If the transitions have rates, the probabilities are proportional to the rates.
+func (g *SimulationGuide) probabilities(nodes []*Node) []float64 {
+	probabilities := make([]float64, len(nodes))
+	nodeLabels := make([][]string, len(nodes))
+	totalRate := 0.0
+	for i, node := range nodes {
+		if len(node.Inbound) > 0 {
+			nodeLabels[i] = append(nodeLabels[i], node.Inbound[0].Labels...)
+		}
+		if _, label := pendingStep(node); label != "" {
+			nodeLabels[i] = append(nodeLabels[i], label)
+		}
+		for _, label := range nodeLabels[i] {
+			probabilities[i] += g.configs.transitionConfig(label).GetRate()
+		}
+		totalRate += probabilities[i]
+	}
+	if totalRate > 0 {
+		return probabilities
+	}
+	total := 0.0
+	missing := 0
+	for i := range nodes {
+		labels := nodeLabels[i]
+		found := false
+		for _, label := range labels {
+			if config := g.configs.transitionConfig(label); config.GetProbability() > 0 {
+				probabilities[i] += config.Probability
+				found = true
+			}
+		}
+		if !found {
+			missing++
+		}
+		total += probabilities[i]
+	}
+	if missing > 0 && total < 1 {
+		for i := range probabilities {
+			if probabilities[i] == 0 {
+				probabilities[i] = (1 - total) / float64(missing)
+			}
+		}
+	}
+	return probabilities
+}
+
+// pickWeighted returns a random index with the probability proportional to its weight,
+// or a uniformly random index if all the weights are zero.
+func pickWeighted(random *rand.Rand, weights []float64) int {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return random.Intn(len(weights))
+	}
+	r := random.Float64() * total
+	for i, weight := range weights {
+		r -= weight
+		if r < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// pendingStep returns the statement the node executes next, and its label if the statement
+// is labeled. For a node starting an action, it is the first statement of the action.
+func pendingStep(node *Node) (*coveragePc, string) {
+	if node.Process == nil || len(node.Threads) == 0 || node.isInjectedFault() {
+		return nil, ""
+	}
+	thread := node.currentThread()
+	frame := thread.currentFrame()
+	pc := frame.pc
+	if pc == "" {
+		return nil, ""
+	}
+	var stmt *ast.Statement
+	switch msg := GetProtoFieldByPath(thread.currentFileAst(), pc).(type) {
+	case *ast.Statement:
+		stmt = msg
+	case *ast.Action:
+		if len(msg.GetBlock().GetStmts()) == 0 {
+			return nil, ""
+		}
+		pc, stmt = pc+".Block.Stmts[0]", msg.Block.Stmts[0]
+	case *ast.Block:
+		if len(msg.GetStmts()) == 0 {
+			return nil, ""
+		}
+		pc, stmt = pc+".Stmts[0]", msg.Stmts[0]
+	default:
+		return nil, ""
+	}
+	label := ""
+	if stmt.Label != "" {
+		label = frame.Name + "." + stmt.Label
+	}
+	return &coveragePc{file: frame.FileIndex, pc: pc}, label
+}
+
+// nextPrefix returns the choices to replay in the next fuzzing run. That is, a prefix of
+// a run in the corpus, with the last choice changed half of the time.
+func (g *SimulationGuide) nextPrefix(random *rand.Rand) []int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.corpus) == 0 || random.Float64() < freshRunProbability {
+		return nil
+	}
+	choices := g.corpus[random.Intn(len(g.corpus))]
+	prefix := make([]int, random.Intn(len(choices)+1))
+	copy(prefix, choices)
+	if len(prefix) > 0 && random.Intn(2) == 0 {
+		prefix[len(prefix)-1] = random.Int()
+	}
+	return prefix
+}
+
+// record updates the guide with the coverage of the completed run. With fuzzing, the
+// choices of the run are added to the corpus if the run reached new coverage.
+func (g *SimulationGuide) record(p *Processor) {
+	labels := make(map[string]bool)
+	walkLinks(p.Init, func(link *Link) {
+		for _, label := range link.Labels {
+			labels[label] = true
+		}
+	})
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	novel := false
+	for pc := range p.coverage.statements {
+		if g.statements[pc] == 0 {
+			novel = true
+		}
+		g.statements[pc]++
+	}
+	for label := range labels {
+		if g.labels[label] == 0 {
+			novel = true
+		}
+		g.labels[label]++
+	}
+	if g.strategy != SimulationFuzz || !novel || len(p.choices) == 0 {
+		return
+	}
+	if len(g.corpus) < maxCorpusSize {
+		g.corpus = append(g.corpus, p.choices)
+	} else {
+		g.corpus[p.random.Intn(len(g.corpus))] = p.choices
+	}
+}
+
+// walkLinks calls the visit function for every link reachable from the root.
+func walkLinks(root *Node, visit func(link *Link)) {
+	if root == nil {
+		return
+	}
+	seen := map[*Node]bool{root: true}
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, link := range node.Outbound {
+			visit(link)
+			if !seen[link.Node] {
+				seen[link.Node] = true
+				stack = append(stack, link.Node)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/fizzbee-io/fizzbee/lib"
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 	"maps"
 	"slices"
 	"strings"
@@ -30,9 +31,15 @@ func CheckInvariants(process *Process) map[int][]int {
 	for i, file := range process.Files {
 		results[i] = make([]int, 0)
 		for j, invariant := range file.Invariants {
+			if IsGeneralTemporalAssertion(invariant) || invariant.Transition {
+				// Checked with the LTL checker after the model checking,
+				// or on the transitions by CheckTransitionInvariants
+				continue
+			}
 			passed := false
 			if invariant.Block == nil {
 				passed = CheckInvariant(process, invariant)
+				process.coverage.recordInvariant(process, i, j, invariant)
 				if invariant.Eventually && passed /*&& (len(process.Threads) == 0 || process.Name == "yield")*/ {
 					process.Witness[i][j] = true
 				} else if !invariant.Eventually && !passed {
@@ -40,9 +47,10 @@ func CheckInvariants(process *Process) map[int][]int {
 				}
 			} else {
 				passed = CheckAssertion(process, invariant, j)
+				// A predicate of the temporal properties is not a safety invariant.
 				if (slices.Contains(invariant.TemporalOperators, "eventually") || slices.Contains(invariant.TemporalOperators, "exists")) && passed /*&& (len(process.Threads) == 0 || process.Name == "yield")*/ {
 					process.Witness[i][j] = true
-				} else if !(slices.Contains(invariant.TemporalOperators, "eventually") || slices.Contains(invariant.TemporalOperators, "exists")) && !passed {
+				} else if !(slices.Contains(invariant.TemporalOperators, "eventually") || slices.Contains(invariant.TemporalOperators, "exists")) && !passed && !invariant.Predicate {
 					results[i] = append(results[i], j)
 				}
 			}
@@ -75,8 +83,15 @@ func CheckAssertion(process *Process, invariant *ast.Invariant, index int) bool
 	if !slices.Contains(invariant.TemporalOperators, "always") && !slices.Contains(invariant.TemporalOperators, "exists") {
 		panic("Invariant checking supported only for always/always-eventually/eventually-always/exists invariants" + strings.Join(invariant.TemporalOperators, ","))
 	}
+	return evalAssertion(process, invariant, index, nil)
+}
+
+// evalAssertion evaluates the assertion function at the process state, ignoring the temporal operators.
+// The vars are added to the state, like `old` and `new` for the transition assertions.
+func evalAssertion(process *Process, invariant *ast.Invariant, index int, vars starlark.StringDict) bool {
 	cloned := process.CloneForAssert(nil, 0)
 	cloned.Heap.state["__returns__"] = NewDictFromStringDict(cloned.Returns)
+	maps.Copy(cloned.Heap.state, vars)
 
 	numThreads := len(cloned.Threads)
 	assertThread := cloned.NewThread()
@@ -96,6 +111,62 @@ func CheckAssertion(process *Process, invariant *ast.Invariant, index int) bool
 	}
 
 }
+// CheckTransitionInvariants checks the transition assertions on the transition from the
+// previous yield point to the process, with `old` bound to the state of the previous
+// yield point and `new` to the state of the process.
+func CheckTransitionInvariants(prev *Process, process *Process) map[int][]int {
+	results := make(map[int][]int)
+	var vars starlark.StringDict
+	for i, file := range process.Files {
+		results[i] = make([]int, 0)
+		for j, invariant := range file.Invariants {
+			if !invariant.Transition {
+				continue
+			}
+			if vars == nil {
+				vars = starlark.StringDict{
+					"old": stateStruct(prev),
+					"new": stateStruct(process),
+				}
+			}
+			if !evalAssertion(process, invariant, j, vars) {
+				results[i] = append(results[i], j)
+			}
+		}
+	}
+	return results
+}
+
+func stateStruct(process *Process) *starlarkstruct.Struct {
+	refs := make(map[string]*lib.Role)
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, CloneDict(process.Heap.state, refs, nil, 0))
+}
+
+// PreviousYield returns the yield point the transition to the node started from.
+func (n *Node) PreviousYield() *Node {
+	prev := n
+	for len(prev.Inbound) > 0 {
+		prev = prev.Inbound[0].Node
+		if prev.Name == "yield" || prev.Name == "init" {
+			return prev
+		}
+	}
+	return nil
+}
+
+// TransitionPath returns the links from the previous yield point to the node.
+func TransitionPath(node *Node) []*Link {
+	path := make([]*Link, 0)
+	for n := node; len(n.Inbound) > 0; n = n.Inbound[0].Node {
+		path = append(path, ReverseLink(n, n.Inbound[0]))
+		if n.Inbound[0].Node.Name == "yield" || n.Inbound[0].Node.Name == "init" {
+			break
+		}
+	}
+	slices.Reverse(path)
+	return path
+}
+
 func CheckSimpleExistsWitness(nodes []*Node) []*InvariantPosition {
 	process := nodes[0].Process
 	if len(process.Files) > 1 {
@@ -135,6 +206,9 @@ func CheckStrictLiveness(node *Node) ([]*Link, *InvariantPosition) {
 	}
 	for i, file := range process.Files {
 		for j, invariant := range file.Invariants {
+			if IsGeneralTemporalAssertion(invariant) {
+				continue
+			}
 			predicate := func(n *Node) (bool, bool) {
 				return len(n.Process.Threads) == 0 || n.Name == "yield", n.Process.Witness[i][j]
 			}
@@ -184,6 +258,9 @@ func CheckFastLiveness(allNodes []*Node) ([]*Link, *InvariantPosition) {
 	}
 	for i, file := range process.Files {
 		for j, invariant := range file.Invariants {
+			if IsGeneralTemporalAssertion(invariant) {
+				continue
+			}
 			predicate := func(n *Node) (bool, bool) {
 				return len(n.Process.Threads) == 0, n.Process.Witness[i][j]
 			}
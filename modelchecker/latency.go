@@ -0,0 +1,309 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// reportedPercentiles are the percentiles in the LatencyReport and the estimates.
+var reportedPercentiles = []float64{0.5, 0.9, 0.95, 0.99, 0.999}
+
+// defaultTimeSteps is the number of time steps in the expected time to completion,
+// when the PerformanceModel does not set the time step.
+const defaultTimeSteps = 200
+
+// maxTimeSteps is the maximum number of time steps in a discretized latency, like a long
+// latency with a small time step. The probability beyond is in the last step.
+const maxTimeSteps = 100000
+
+// LatencyReport is the distribution of the time to completion, from the latencies and the rates
+// in the PerformanceModel. The completion is reaching an absorbing class, like a terminal state.
+type LatencyReport struct {
+	ExpectedTime float64             `json:"expectedTime"`
+	Percentiles  []LatencyPercentile `json:"percentiles"`
+	// TimeStep is the resolution of the percentiles.
+	TimeStep float64 `json:"timeStep,omitempty"`
+	// Estimate is the estimate of the time from the simulation runs, instead of the exact analysis.
+	Estimate *PerfEstimate `json:"estimate,omitempty"`
+}
+
+type LatencyPercentile struct {
+	Percentile float64 `json:"percentile"`
+	Time       float64 `json:"time"`
+}
+
+func (r *LatencyReport) String() string {
+	var b strings.Builder
+	if r.Estimate != nil {
+		fmt.Fprintf(&b, "Expected time to completion: %s\n", estimateString(r.Estimate))
+	} else {
+		fmt.Fprintf(&b, "Expected time to completion: %.6f\n", r.ExpectedTime)
+	}
+	for _, p := range r.Percentiles {
+		fmt.Fprintf(&b, "  p%g: %.6f\n", math.Round(p.Percentile*1000)/10, p.Time)
+	}
+	return b.String()
+}
+
+// hasTimeModel returns true if the PerformanceModel has latencies or rates.
+func hasTimeModel(model *proto.PerformanceModel) bool {
+	for _, config := range model.GetConfigs() {
+		if config.GetRate() > 0 || config.GetLatency() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeLatency computes the expected time to completion exactly, and the percentiles from the
+// distribution of the time, with the latencies discretized in time steps. It returns nil if the
+// PerformanceModel has neither latencies nor rates.
+func AnalyzeLatency(root *Node, perfModel *proto.PerformanceModel) (*LatencyReport, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeLatency(root, configs), nil
+}
+
+func analyzeLatency(root *Node, configs *perfConfigs) *LatencyReport {
+	if !hasTimeModel(configs.model) {
+		return nil
+	}
+	options := newSolverOptions(configs.model)
+	nodes, _, _, _ := getAllNodes(root, 0)
+	indexMap := make(map[*Node]int)
+	for i, node := range nodes {
+		indexMap[node] = i
+	}
+	transitionMatrix := genTransitionMatrix(nodes, configs)
+	system := newTransientSystem(transitionMatrix)
+	report := &LatencyReport{Percentiles: make([]LatencyPercentile, 0)}
+	if system.index[0] < 0 {
+		return report
+	}
+
+	visits := system.visits(0)
+	for t, i := range system.states {
+		node := nodes[i]
+		stepTime := 0.0
+		if rate := nodeRate(node, configs); rate > 0 {
+			stepTime += 1 / rate
+		}
+		for k, probability := range linkProbabilities(node, configs) {
+			for _, label := range node.Outbound[k].Labels {
+				stepTime += probability * distributionMean(configs.transitionConfig(label).GetLatency())
+			}
+		}
+		report.ExpectedTime += visits[t] * stepTime
+	}
+	if report.ExpectedTime <= 0 {
+		return report
+	}
+
+	report.TimeStep = configs.model.GetTimeStep()
+	if report.TimeStep <= 0 {
+		report.TimeStep = report.ExpectedTime / defaultTimeSteps
+	}
+	completion := latencyDistribution(nodes, indexMap, system, configs, options, report.TimeStep)
+	cumulative := 0.0
+	next := 0
+	for bin, probability := range completion {
+		cumulative += probability
+		for next < len(reportedPercentiles) && cumulative >= reportedPercentiles[next] {
+			report.Percentiles = append(report.Percentiles, LatencyPercentile{
+				Percentile: reportedPercentiles[next],
+				Time:       float64(bin) * report.TimeStep,
+			})
+			next++
+		}
+	}
+	return report
+}
+
+// latencyDistribution returns the probability of completing in each time step, by moving the
+// probability of each state forward in time by the discretized latency of each transition.
+func latencyDistribution(nodes []*Node, indexMap map[*Node]int, system *transientSystem, configs *perfConfigs, options *solverOptions, step float64) []float64 {
+	latencies := make(map[string][]float64)
+	probabilities := make(map[int][]float64)
+	transitionLatency := func(node *Node, link *Link) []float64 {
+		rate := nodeRate(node, configs)
+		labels := append([]string{}, link.Labels...)
+		sort.Strings(labels)
+		key := fmt.Sprintf("%v/%s", rate, strings.Join(labels, ","))
+		if pmf, ok := latencies[key]; ok {
+			return pmf
+		}
+		pmf := []float64{1.0}
+		if rate > 0 {
+			holding := &proto.Distribution{Distribution: &proto.Distribution_Exponential{Exponential: 1 / rate}}
+			pmf = convolve(pmf, discretize(holding, step, options.tolerance))
+		}
+		for _, label := range labels {
+			if latency := configs.transitionConfig(label).GetLatency(); latency != nil {
+				pmf = convolve(pmf, discretize(latency, step, options.tolerance))
+			}
+		}
+		latencies[key] = pmf
+		return pmf
+	}
+
+	completion := make([]float64, 0)
+	completed := 0.0
+	// pending is the probability of being at each state at the start of each time step.
+	pending := map[int]map[int]float64{0: {0: 1.0}}
+	for bin := 0; bin < options.maxIterations && len(pending) > 0 && completed < 1-options.tolerance; bin++ {
+		completion = append(completion, 0)
+		frontier := pending[bin]
+		delete(pending, bin)
+		// The transitions without latency move the probability within the same time step.
+		for iteration := 0; len(frontier) > 0 && iteration < options.maxIterations; iteration++ {
+			next := make(map[int]float64)
+			for i, mass := range frontier {
+				if system.index[i] < 0 {
+					completion[bin] += mass
+					completed += mass
+					continue
+				}
+				node := nodes[i]
+				if probabilities[i] == nil {
+					probabilities[i] = linkProbabilities(node, configs)
+				}
+				for k, probability := range probabilities[i] {
+					if probability == 0 {
+						continue
+					}
+					j := indexMap[node.Outbound[k].Node]
+					for offset, q := range transitionLatency(node, node.Outbound[k]) {
+						if q == 0 {
+							continue
+						}
+						if offset == 0 {
+							next[j] += mass * probability * q
+							continue
+						}
+						if pending[bin+offset] == nil {
+							pending[bin+offset] = make(map[int]float64)
+						}
+						pending[bin+offset][j] += mass * probability * q
+					}
+				}
+			}
+			frontier = next
+			// Within a loop without latency, the probability left below the tolerance is dropped.
+			if remaining := sumValues(next); remaining < options.tolerance*options.tolerance {
+				break
+			}
+		}
+	}
+	return completion
+}
+
+// distributionMean returns the mean of the distribution, 0 for nil.
+func distributionMean(d *proto.Distribution) float64 {
+	switch {
+	case d == nil:
+		return 0
+	case d.GetUniform() != nil:
+		return (d.GetUniform().GetMin() + d.GetUniform().GetMax()) / 2
+	case d.GetEmpirical() != nil:
+		total, weights := 0.0, 0.0
+		for _, bucket := range d.GetEmpirical().GetBuckets() {
+			total += bucket.GetValue() * bucket.GetWeight()
+			weights += bucket.GetWeight()
+		}
+		if weights == 0 {
+			return 0
+		}
+		return total / weights
+	case d.GetExponential() != 0:
+		return d.GetExponential()
+	default:
+		return d.GetFixed()
+	}
+}
+
+// discretize returns the probability of the distribution rounding to each multiple of the step.
+// The tail of the exponential distribution below the tolerance, or beyond maxTimeSteps, is in the last step.
+func discretize(d *proto.Distribution, step float64, tolerance float64) []float64 {
+	bin := func(value float64) int {
+		return int(math.Max(math.Min(math.Round(value/step), maxTimeSteps), 0))
+	}
+	switch {
+	case d.GetUniform() != nil:
+		low, high := d.GetUniform().GetMin(), d.GetUniform().GetMax()
+		if high <= low {
+			return pointMass(bin(low))
+		}
+		pmf := make([]float64, bin(high)+1)
+		for k := range pmf {
+			from := math.Max(low, (float64(k)-0.5)*step)
+			to := math.Min(high, (float64(k)+0.5)*step)
+			if to > from {
+				pmf[k] = (to - from) / (high - low)
+			}
+		}
+		return pmf
+	case d.GetEmpirical() != nil:
+		buckets := d.GetEmpirical().GetBuckets()
+		weights := 0.0
+		last := 0
+		for _, bucket := range buckets {
+			weights += bucket.GetWeight()
+			last = max(last, bin(bucket.GetValue()))
+		}
+		if weights == 0 {
+			return pointMass(0)
+		}
+		pmf := make([]float64, last+1)
+		for _, bucket := range buckets {
+			pmf[bin(bucket.GetValue())] += bucket.GetWeight() / weights
+		}
+		return pmf
+	case d.GetExponential() != 0:
+		mean := d.GetExponential()
+		cdf := func(x float64) float64 { return 1 - math.Exp(-math.Max(x, 0)/mean) }
+		pmf := make([]float64, 0)
+		for k := 0; ; k++ {
+			upper := cdf((float64(k) + 0.5) * step)
+			if 1-upper < tolerance || k == maxTimeSteps {
+				pmf = append(pmf, 1-cdf((float64(k)-0.5)*step))
+				return pmf
+			}
+			pmf = append(pmf, upper-cdf((float64(k)-0.5)*step))
+		}
+	default:
+		return pointMass(bin(d.GetFixed()))
+	}
+}
+
+func sumValues(m map[int]float64) float64 {
+	total := 0.0
+	for _, v := range m {
+		total += v
+	}
+	return total
+}
+
+func pointMass(k int) []float64 {
+	pmf := make([]float64, k+1)
+	pmf[k] = 1.0
+	return pmf
+}
+
+// convolve returns the distribution of the sum of the two discretized distributions.
+func convolve(a, b []float64) []float64 {
+	result := make([]float64, len(a)+len(b)-1)
+	for i, p := range a {
+		if p == 0 {
+			continue
+		}
+		for j, q := range b {
+			result[i+j] += p * q
+		}
+	}
+	return result
+}
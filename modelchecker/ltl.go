@@ -0,0 +1,577 @@
+package modelchecker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type ltlOp int
+
+const (
+	ltlTrue ltlOp = iota
+	ltlFalse
+	ltlAtom
+	ltlNot
+	ltlAnd
+	ltlOr
+	ltlImplies
+	ltlNext
+	ltlUntil
+	ltlRelease
+	ltlAlways
+	ltlEventually
+	ltlLeadsTo
+)
+
+// LtlFormula is a linear temporal logic formula over the state predicates.
+// The predicates are either the names of the assertions in the spec,
+// or python expressions over the state variables within backquotes.
+type LtlFormula struct {
+	op          ltlOp
+	atom        string
+	isExpr      bool
+	left, right *LtlFormula
+}
+
+func ltlAtomOf(name string) *LtlFormula {
+	return &LtlFormula{op: ltlAtom, atom: name}
+}
+
+func ltlUnary(op ltlOp, f *LtlFormula) *LtlFormula {
+	return &LtlFormula{op: op, left: f}
+}
+
+func ltlBinary(op ltlOp, left, right *LtlFormula) *LtlFormula {
+	return &LtlFormula{op: op, left: left, right: right}
+}
+
+// String returns the formula in the canonical syntax, with all the
+// binary operators parenthesized. It is also used as the key of the formula.
+func (f *LtlFormula) String() string {
+	switch f.op {
+	case ltlTrue:
+		return "true"
+	case ltlFalse:
+		return "false"
+	case ltlAtom:
+		if f.isExpr {
+			return "`" + f.atom + "`"
+		}
+		return f.atom
+	case ltlNot:
+		return "!" + f.left.String()
+	case ltlNext:
+		return "next " + f.left.String()
+	case ltlAlways:
+		return "always " + f.left.String()
+	case ltlEventually:
+		return "eventually " + f.left.String()
+	}
+	return fmt.Sprintf("(%s %s %s)", f.left.String(), ltlBinaryOpNames[f.op], f.right.String())
+}
+
+var ltlBinaryOpNames = map[ltlOp]string{
+	ltlAnd:     "and",
+	ltlOr:      "or",
+	ltlImplies: "->",
+	ltlUntil:   "until",
+	ltlRelease: "release",
+	ltlLeadsTo: "~>",
+}
+
+// atoms returns the distinct atomic predicates in the formula.
+func (f *LtlFormula) atoms() []*LtlFormula {
+	seen := make(map[string]*LtlFormula)
+	var walk func(g *LtlFormula)
+	walk = func(g *LtlFormula) {
+		if g == nil {
+			return
+		}
+		if g.op == ltlAtom {
+			seen[g.String()] = g
+		}
+		walk(g.left)
+		walk(g.right)
+	}
+	walk(f)
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	atoms := make([]*LtlFormula, len(keys))
+	for i, k := range keys {
+		atoms[i] = seen[k]
+	}
+	return atoms
+}
+
+// ParseLtl parses the formula. The operators in the increasing order of precedence are,
+//   - `->` (implies) and `~>` (leads to), both right associative
+//   - `or` (`||`)
+//   - `and` (`&&`)
+//   - `until` and `release`, right associative
+//   - the unary `not` (`!`), `next`, `always` (`[]`) and `eventually` (`<>`)
+func ParseLtl(formula string) (*LtlFormula, error) {
+	tokens, err := tokenizeLtl(formula)
+	if err != nil {
+		return nil, err
+	}
+	p := &ltlParser{tokens: tokens}
+	f, err := p.parseImplication()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in formula: %s", p.tokens[p.pos], formula)
+	}
+	return f, nil
+}
+
+var ltlSymbols = []string{"->", "~>", "&&", "||", "[]", "<>", "!", "(", ")"}
+
+func tokenizeLtl(formula string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(formula); {
+		c := rune(formula[i])
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+		if c == '`' {
+			end := strings.IndexByte(formula[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated expression in formula: %s", formula)
+			}
+			tokens = append(tokens, formula[i:i+end+2])
+			i += end + 2
+			continue
+		}
+		matched := false
+		for _, sym := range ltlSymbols {
+			if strings.HasPrefix(formula[i:], sym) {
+				tokens = append(tokens, sym)
+				i += len(sym)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if !unicode.IsLetter(c) && c != '_' {
+			return nil, fmt.Errorf("unexpected %q in formula: %s", c, formula)
+		}
+		j := i
+		for j < len(formula) && (unicode.IsLetter(rune(formula[j])) || unicode.IsDigit(rune(formula[j])) || formula[j] == '_') {
+			j++
+		}
+		tokens = append(tokens, formula[i:j])
+		i = j
+	}
+	return tokens, nil
+}
+
+type ltlParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *ltlParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *ltlParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *ltlParser) parseImplication() (*LtlFormula, error) {
+	left, err := p.parseDisjunction()
+	if err != nil {
+		return nil, err
+	}
+	var op ltlOp
+	switch p.peek() {
+	case "->", "implies":
+		op = ltlImplies
+	case "~>":
+		op = ltlLeadsTo
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseImplication()
+	if err != nil {
+		return nil, err
+	}
+	return ltlBinary(op, left, right), nil
+}
+
+func (p *ltlParser) parseDisjunction() (*LtlFormula, error) {
+	left, err := p.parseConjunction()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, err := p.parseConjunction()
+		if err != nil {
+			return nil, err
+		}
+		left = ltlBinary(ltlOr, left, right)
+	}
+	return left, nil
+}
+
+func (p *ltlParser) parseConjunction() (*LtlFormula, error) {
+	left, err := p.parseUntil()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUntil()
+		if err != nil {
+			return nil, err
+		}
+		left = ltlBinary(ltlAnd, left, right)
+	}
+	return left, nil
+}
+
+func (p *ltlParser) parseUntil() (*LtlFormula, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	var op ltlOp
+	switch p.peek() {
+	case "until":
+		op = ltlUntil
+	case "release":
+		op = ltlRelease
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseUntil()
+	if err != nil {
+		return nil, err
+	}
+	return ltlBinary(op, left, right), nil
+}
+
+func (p *ltlParser) parseUnary() (*LtlFormula, error) {
+	var op ltlOp
+	switch p.peek() {
+	case "!", "not":
+		op = ltlNot
+	case "next":
+		op = ltlNext
+	case "[]", "always":
+		op = ltlAlways
+	case "<>", "eventually":
+		op = ltlEventually
+	default:
+		return p.parsePrimary()
+	}
+	p.next()
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return ltlUnary(op, f), nil
+}
+
+func (p *ltlParser) parsePrimary() (*LtlFormula, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of formula")
+	case token == "(":
+		f, err := p.parseImplication()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return f, nil
+	case token == "true":
+		return &LtlFormula{op: ltlTrue}, nil
+	case token == "false":
+		return &LtlFormula{op: ltlFalse}, nil
+	case strings.HasPrefix(token, "`"):
+		return &LtlFormula{op: ltlAtom, atom: strings.TrimSpace(token[1 : len(token)-1]), isExpr: true}, nil
+	case unicode.IsLetter(rune(token[0])) || token[0] == '_':
+		return ltlAtomOf(token), nil
+	}
+	return nil, fmt.Errorf("unexpected %q in formula", token)
+}
+
+// nnf returns the negation normal form of the formula (or its negation), that
+// uses only true, false, atoms, negated atoms, and, or, next, until and release.
+func (f *LtlFormula) nnf(negate bool) *LtlFormula {
+	switch f.op {
+	case ltlTrue, ltlFalse:
+		if negate == (f.op == ltlTrue) {
+			return &LtlFormula{op: ltlFalse}
+		}
+		return &LtlFormula{op: ltlTrue}
+	case ltlAtom:
+		if negate {
+			return ltlUnary(ltlNot, f)
+		}
+		return f
+	case ltlNot:
+		return f.left.nnf(!negate)
+	case ltlAnd, ltlOr:
+		op := f.op
+		if negate {
+			op = ltlAnd + ltlOr - f.op
+		}
+		return ltlBinary(op, f.left.nnf(negate), f.right.nnf(negate))
+	case ltlImplies:
+		return ltlBinary(ltlOr, ltlUnary(ltlNot, f.left), f.right).nnf(negate)
+	case ltlNext:
+		return ltlUnary(ltlNext, f.left.nnf(negate))
+	case ltlUntil, ltlRelease:
+		op := f.op
+		if negate {
+			op = ltlUntil + ltlRelease - f.op
+		}
+		return ltlBinary(op, f.left.nnf(negate), f.right.nnf(negate))
+	case ltlAlways:
+		return ltlBinary(ltlRelease, &LtlFormula{op: ltlFalse}, f.left).nnf(negate)
+	case ltlEventually:
+		return ltlBinary(ltlUntil, &LtlFormula{op: ltlTrue}, f.left).nnf(negate)
+	case ltlLeadsTo:
+		return ltlUnary(ltlAlways, ltlBinary(ltlImplies, f.left, ltlUnary(ltlEventually, f.right))).nnf(negate)
+	}
+	panic(fmt.Sprintf("unknown ltl operator %d", f.op))
+}
+
+// buchiState is a state of the generalized Büchi automaton. The automaton
+// is state labeled, that is, the run can be in this state only if the
+// state of the model satisfies the literals.
+type buchiState struct {
+	id       int
+	literals []*LtlFormula
+	next     []int
+	// accepting[i] is true if the state is in the i-th acceptance set.
+	accepting []bool
+}
+
+// buchiAutomaton is a generalized Büchi automaton, where an accepting run must
+// visit the states in each acceptance set infinitely often.
+type buchiAutomaton struct {
+	states         []*buchiState
+	initial        []int
+	acceptanceSets int
+}
+
+// tableauNode is the node used in the construction of the automaton from the
+// formula, by the algorithm from Gerth, Peled, Vardi and Wolper,
+// "Simple On-the-fly Automatic Verification of Linear Temporal Logic".
+type tableauNode struct {
+	incoming map[int]bool
+	new      map[string]*LtlFormula
+	old      map[string]*LtlFormula
+	next     map[string]*LtlFormula
+}
+
+const tableauInit = -1
+
+// newBuchiAutomaton returns the automaton accepting the behaviors satisfying the formula in nnf.
+func newBuchiAutomaton(f *LtlFormula) *buchiAutomaton {
+	nodes := make([]*tableauNode, 0)
+	var expand func(node *tableauNode)
+	expand = func(node *tableauNode) {
+		if len(node.new) == 0 {
+			for _, other := range nodes {
+				if sameFormulas(other.old, node.old) && sameFormulas(other.next, node.next) {
+					for id := range node.incoming {
+						other.incoming[id] = true
+					}
+					return
+				}
+			}
+			nodes = append(nodes, node)
+			expand(&tableauNode{
+				incoming: map[int]bool{len(nodes) - 1: true},
+				new:      copyFormulas(node.next),
+				old:      map[string]*LtlFormula{},
+				next:     map[string]*LtlFormula{},
+			})
+			return
+		}
+		var key string
+		for k := range node.new {
+			if key == "" || k < key {
+				key = k
+			}
+		}
+		eta := node.new[key]
+		delete(node.new, key)
+		if _, ok := node.old[key]; ok {
+			expand(node)
+			return
+		}
+		switch eta.op {
+		case ltlTrue, ltlFalse, ltlAtom, ltlNot:
+			if eta.op == ltlFalse {
+				return
+			}
+			if _, ok := node.old[ltlNegate(eta).String()]; ok {
+				return
+			}
+			node.old[key] = eta
+			expand(node)
+		case ltlAnd:
+			node.old[key] = eta
+			addFormula(node.new, node.old, eta.left)
+			addFormula(node.new, node.old, eta.right)
+			expand(node)
+		case ltlNext:
+			node.old[key] = eta
+			node.next[eta.left.String()] = eta.left
+			expand(node)
+		case ltlOr, ltlUntil, ltlRelease:
+			first := node.split()
+			second := node.split()
+			first.old[key] = eta
+			second.old[key] = eta
+			switch eta.op {
+			case ltlOr:
+				addFormula(first.new, first.old, eta.left)
+				addFormula(second.new, second.old, eta.right)
+			case ltlUntil:
+				addFormula(first.new, first.old, eta.left)
+				first.next[key] = eta
+				addFormula(second.new, second.old, eta.right)
+			case ltlRelease:
+				addFormula(first.new, first.old, eta.right)
+				first.next[key] = eta
+				addFormula(second.new, second.old, eta.left)
+				addFormula(second.new, second.old, eta.right)
+			}
+			expand(first)
+			expand(second)
+		}
+	}
+	expand(&tableauNode{
+		incoming: map[int]bool{tableauInit: true},
+		new:      map[string]*LtlFormula{f.String(): f},
+		old:      map[string]*LtlFormula{},
+		next:     map[string]*LtlFormula{},
+	})
+
+	untils := make([]*LtlFormula, 0)
+	for _, node := range nodes {
+		for _, g := range node.old {
+			if g.op == ltlUntil && !containsFormula(untils, g) {
+				untils = append(untils, g)
+			}
+		}
+	}
+	sort.Slice(untils, func(i, j int) bool {
+		return untils[i].String() < untils[j].String()
+	})
+
+	automaton := &buchiAutomaton{acceptanceSets: len(untils)}
+	for i, node := range nodes {
+		state := &buchiState{id: i, accepting: make([]bool, len(untils))}
+		for _, g := range node.old {
+			if g.op == ltlAtom || g.op == ltlNot {
+				state.literals = append(state.literals, g)
+			}
+		}
+		for j, u := range untils {
+			_, hasUntil := node.old[u.String()]
+			_, hasRight := node.old[u.right.String()]
+			state.accepting[j] = !hasUntil || hasRight
+		}
+		automaton.states = append(automaton.states, state)
+	}
+	for i, node := range nodes {
+		for id := range node.incoming {
+			if id == tableauInit {
+				automaton.initial = append(automaton.initial, i)
+			} else {
+				automaton.states[id].next = append(automaton.states[id].next, i)
+			}
+		}
+	}
+	sort.Ints(automaton.initial)
+	for _, state := range automaton.states {
+		sort.Ints(state.next)
+	}
+	return automaton
+}
+
+func (n *tableauNode) split() *tableauNode {
+	incoming := make(map[int]bool, len(n.incoming))
+	for id := range n.incoming {
+		incoming[id] = true
+	}
+	return &tableauNode{
+		incoming: incoming,
+		new:      copyFormulas(n.new),
+		old:      copyFormulas(n.old),
+		next:     copyFormulas(n.next),
+	}
+}
+
+func ltlNegate(f *LtlFormula) *LtlFormula {
+	switch f.op {
+	case ltlNot:
+		return f.left
+	case ltlTrue:
+		return &LtlFormula{op: ltlFalse}
+	case ltlFalse:
+		return &LtlFormula{op: ltlTrue}
+	}
+	return ltlUnary(ltlNot, f)
+}
+
+func addFormula(new, old map[string]*LtlFormula, f *LtlFormula) {
+	if _, ok := old[f.String()]; !ok {
+		new[f.String()] = f
+	}
+}
+
+func copyFormulas(formulas map[string]*LtlFormula) map[string]*LtlFormula {
+	result := make(map[string]*LtlFormula, len(formulas))
+	for k, v := range formulas {
+		result[k] = v
+	}
+	return result
+}
+
+func sameFormulas(a, b map[string]*LtlFormula) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFormula(formulas []*LtlFormula, f *LtlFormula) bool {
+	for _, g := range formulas {
+		if g.String() == f.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,574 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"google.golang.org/protobuf/proto"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TemporalProperty is a general LTL property checked with the automata based checker.
+// These are either defined in the `properties` option, or are assertions with
+// a combination of temporal operators not handled by the liveness checkers, like `eventually`.
+type TemporalProperty struct {
+	Name        string
+	Quantifiers []*LtlQuantifier
+	Formula     *LtlFormula
+	// Position is set for the properties defined as assertions.
+	Position *InvariantPosition
+}
+
+// legacyTemporalOperators are the temporal operators of the assertions checked by
+// CheckInvariants and the liveness checkers.
+var legacyTemporalOperators = [][]string{
+	{"always"},
+	{"exists"},
+	{"always", "eventually"},
+	{"eventually", "always"},
+}
+
+// IsGeneralTemporalAssertion returns true if the assertion is checked as an LTL formula.
+func IsGeneralTemporalAssertion(invariant *ast.Invariant) bool {
+	if invariant.Block == nil {
+		return false
+	}
+	for _, ops := range legacyTemporalOperators {
+		if slices.Equal(ops, invariant.TemporalOperators) {
+			return false
+		}
+	}
+	return true
+}
+
+// TemporalProperties returns the LTL properties defined in the files and the options.
+func TemporalProperties(files []*ast.File, options *ast.StateSpaceOptions) ([]*TemporalProperty, error) {
+	properties := make([]*TemporalProperty, 0)
+	for i, file := range files {
+		for j, invariant := range file.Invariants {
+			if !IsGeneralTemporalAssertion(invariant) {
+				continue
+			}
+			formula := ltlAtomOf(invariant.Name)
+			for k := len(invariant.TemporalOperators) - 1; k >= 0; k-- {
+				switch invariant.TemporalOperators[k] {
+				case "always":
+					formula = ltlUnary(ltlAlways, formula)
+				case "eventually":
+					formula = ltlUnary(ltlEventually, formula)
+				default:
+					return nil, fmt.Errorf("assertion %s: %s cannot be combined with other temporal operators",
+						invariant.Name, invariant.TemporalOperators[k])
+				}
+			}
+			properties = append(properties, &TemporalProperty{
+				Name:     invariant.Name,
+				Formula:  formula,
+				Position: NewInvariantPosition(i, j),
+			})
+		}
+	}
+	names := make([]string, 0, len(options.GetProperties()))
+	for name := range options.GetProperties() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		quantifiers, formula, err := parseQuantifiedLtl(options.GetProperties()[name])
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", name, err)
+		}
+		properties = append(properties, &TemporalProperty{Name: name, Quantifiers: quantifiers, Formula: formula})
+	}
+	if len(files) == 0 {
+		return properties, nil
+	}
+	for _, property := range properties {
+		if err := property.validateAtoms(files[0].Invariants); err != nil {
+			return nil, err
+		}
+		if err := property.validateDomains(files[0].Roles); err != nil {
+			return nil, err
+		}
+	}
+	return properties, nil
+}
+
+// propertyAtoms returns the names of the assertions used as atoms in the temporal properties
+// of the options. The properties that fail to parse are reported by TemporalProperties.
+func propertyAtoms(options *ast.StateSpaceOptions) map[string]bool {
+	names := make(map[string]bool)
+	for _, property := range options.GetProperties() {
+		_, formula, err := parseQuantifiedLtl(property)
+		if err != nil {
+			continue
+		}
+		for _, atom := range formula.atoms() {
+			if !atom.isExpr {
+				names[atom.atom] = true
+			}
+		}
+	}
+	return names
+}
+
+// markPredicates returns the files with the assertions used as atoms in the temporal
+// properties marked as predicates, so a safety assertion like `always assertion Replied`
+// is not checked as an invariant. The files are cloned if an assertion is marked.
+func markPredicates(files []*ast.File, options *ast.StateSpaceOptions) []*ast.File {
+	atoms := propertyAtoms(options)
+	if len(atoms) == 0 {
+		return files
+	}
+	marked := make([]*ast.File, len(files))
+	for i, file := range files {
+		marked[i] = proto.Clone(file).(*ast.File)
+		for _, invariant := range marked[i].Invariants {
+			if invariant.Block != nil && !invariant.Transition && atoms[invariant.Name] {
+				invariant.Predicate = true
+			}
+		}
+	}
+	return marked
+}
+
+// validateAtoms returns an error if an atom of the property, other than the python expressions,
+// is not an assertion or is a transition assertion, as those are not evaluated on a state.
+func (p *TemporalProperty) validateAtoms(invariants []*ast.Invariant) error {
+	for _, atom := range p.Formula.atoms() {
+		if atom.isExpr {
+			continue
+		}
+		index := slices.IndexFunc(invariants, func(invariant *ast.Invariant) bool {
+			return invariant.Block != nil && invariant.Name == atom.atom
+		})
+		if index < 0 {
+			return fmt.Errorf("property %s: assertion %s not found", p.Name, atom.atom)
+		}
+		if invariants[index].Transition {
+			return fmt.Errorf("property %s: transition assertion %s cannot be used in temporal properties", p.Name, atom.atom)
+		}
+	}
+	return nil
+}
+
+// productState is a state in the product of the state graph and the Büchi automaton.
+type productState struct {
+	node  *Node
+	state int
+}
+
+type productEdge struct {
+	to   productState
+	link *Link
+}
+
+// ltlChecker checks a property by searching for a fair accepting cycle in the product of the
+// state graph and the automaton for the negation of the property. Like the liveness checkers,
+// the automaton advances only on the yield points, and the process is allowed to stutter
+// at the yield points without fair actions.
+type ltlChecker struct {
+	root      *Node
+	automaton *buchiAutomaton
+	atoms     []*LtlFormula
+	// binding is the instances bound to the quantified variables of the property.
+	binding     ltlBinding
+	quantifiers []*LtlQuantifier
+	// invariants maps the assertion names to their positions, for the atoms.
+	invariants map[string]int
+	valuations map[*Node]map[string]bool
+	// err is the first error evaluating an atom.
+	err error
+
+	edges map[productState][]productEdge
+	// parent is the previous state and the link used to first reach the product state,
+	// for the counterexample.
+	parent map[productState]*productEdge
+	order  []productState
+}
+
+// CheckTemporalProperty returns the path to a fair behavior violating the property, if any.
+// The atoms of the property must be validated, like in the properties returned by TemporalProperties.
+// For the quantified properties, it also returns the instance violating the property, like `c=Client#1`.
+// It returns an error if an atom fails to evaluate at a state.
+func CheckTemporalProperty(root *Node, property *TemporalProperty) ([]*Link, string, bool, error) {
+	if len(property.Quantifiers) == 0 {
+		path, holds, err := checkLtl(root, property, nil)
+		return path, "", holds, err
+	}
+	bindings, err := ltlBindings(root, property.Quantifiers)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("property %s: %w", property.Name, err)
+	}
+	for _, binding := range bindings {
+		path, holds, err := checkLtl(root, property, binding)
+		if err != nil {
+			return nil, binding.String(), false, err
+		}
+		if !holds {
+			return path, binding.String(), false, nil
+		}
+	}
+	return nil, "", true, nil
+}
+
+func checkLtl(root *Node, property *TemporalProperty, binding ltlBinding) ([]*Link, bool, error) {
+	c := newLtlChecker(root, property, binding)
+	if err := c.buildProduct(); err != nil {
+		return nil, false, fmt.Errorf("property %s: %w", property.Name, err)
+	}
+	start, cycle := c.findFairAcceptingCycle(c.order)
+	if cycle == nil {
+		return nil, true, nil
+	}
+	return append(c.pathTo(start), cycle...), false, nil
+}
+
+// newLtlChecker returns the checker for the property with the quantified variables bound
+// to the instances.
+func newLtlChecker(root *Node, property *TemporalProperty, binding ltlBinding) *ltlChecker {
+	c := &ltlChecker{
+		root:        root,
+		automaton:   newBuchiAutomaton(property.Formula.nnf(true)),
+		atoms:       property.Formula.atoms(),
+		binding:     binding,
+		quantifiers: property.Quantifiers,
+		invariants:  make(map[string]int),
+		valuations:  make(map[*Node]map[string]bool),
+		edges:       make(map[productState][]productEdge),
+		parent:      make(map[productState]*productEdge),
+	}
+	for i, invariant := range root.Process.Files[0].Invariants {
+		if invariant.Block != nil {
+			c.invariants[invariant.Name] = i
+		}
+	}
+	return c
+}
+
+// isYieldPoint returns true if the atomic predicates are evaluated at the node.
+func isYieldPoint(node *Node) bool {
+	return len(node.Process.Threads) == 0 || node.Name == "yield" || node.Name == "init"
+}
+
+func (c *ltlChecker) valuation(node *Node) (map[string]bool, error) {
+	if v, ok := c.valuations[node]; ok {
+		return v, nil
+	}
+	v := make(map[string]bool, len(c.atoms))
+	for _, atom := range c.atoms {
+		if atom.isExpr {
+			ref := make(map[string]*lib.Role)
+			vars := CloneDict(node.Process.Heap.state, ref, nil, 0)
+			vars["__returns__"] = NewDictFromStringDict(node.Process.Returns)
+			// The predicates on an instance that does not exist at the state are false.
+			missing := c.binding.addTo(node.Process, vars, c.quantifiers)
+			if len(missing) > 0 {
+				identifiers, err := exprIdentifiers(node.Process.Evaluator, atom.atom)
+				if err != nil {
+					return nil, fmt.Errorf("parsing %s: %w", atom, err)
+				}
+				if usesAny(identifiers, missing) {
+					v[atom.String()] = false
+					continue
+				}
+			}
+			cond, err := node.Process.Evaluator.EvalPyExpr(node.Process.Files[0].GetSourceInfo().GetFileName(), atom.atom, vars)
+			if err != nil {
+				return nil, fmt.Errorf("evaluating %s: %w", atom, err)
+			}
+			v[atom.String()] = bool(cond.Truth())
+		} else {
+			index := c.invariants[atom.atom]
+			v[atom.String()] = evalAssertion(node.Process, node.Process.Files[0].Invariants[index], index, nil)
+		}
+	}
+	c.valuations[node] = v
+	return v, nil
+}
+
+// satisfies returns true if the atoms hold at the node as required by the automaton state.
+// The first error evaluating the atoms is kept in err, and stops building the product.
+func (c *ltlChecker) satisfies(node *Node, state int) bool {
+	v, err := c.valuation(node)
+	if err != nil {
+		if c.err == nil {
+			c.err = err
+		}
+		return false
+	}
+	for _, literal := range c.automaton.states[state].literals {
+		if literal.op == ltlNot {
+			if v[literal.left.String()] {
+				return false
+			}
+		} else if !v[literal.String()] {
+			return false
+		}
+	}
+	return true
+}
+
+// canStutter returns true if the process can stop at the node, as there is
+// no fair action or pending thread to continue.
+func canStutter(node *Node) bool {
+	if len(node.Outbound) == 0 {
+		return true
+	}
+	if node.Name != "yield" {
+		return false
+	}
+	for _, link := range node.Outbound {
+		if link.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG ||
+			link.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK ||
+			strings.HasPrefix(link.Name, "thread-") {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ltlChecker) successors(from productState) []productEdge {
+	edges := make([]productEdge, 0)
+	addEdges := func(node *Node, link *Link) {
+		if !isYieldPoint(node) {
+			edges = append(edges, productEdge{to: productState{node, from.state}, link: link})
+			return
+		}
+		for _, next := range c.automaton.states[from.state].next {
+			if c.satisfies(node, next) {
+				edges = append(edges, productEdge{to: productState{node, next}, link: link})
+			}
+		}
+	}
+	for _, link := range from.node.Outbound {
+		if link.Node.Process == nil || !link.Node.Process.Enabled {
+			continue
+		}
+		addEdges(link.Node, link)
+	}
+	if canStutter(from.node) {
+		addEdges(from.node, &Link{Node: from.node, Name: "stutter"})
+	}
+	return edges
+}
+
+func (c *ltlChecker) buildProduct() error {
+	queue := lib.NewQueue[productState]()
+	for _, state := range c.automaton.initial {
+		if c.satisfies(c.root, state) {
+			initial := productState{c.root, state}
+			c.parent[initial] = nil
+			queue.Enqueue(initial)
+		}
+	}
+	for queue.Count() > 0 && c.err == nil {
+		from, _ := queue.Dequeue()
+		c.order = append(c.order, from)
+		edges := c.successors(from)
+		c.edges[from] = edges
+		for _, edge := range edges {
+			if _, ok := c.parent[edge.to]; ok {
+				continue
+			}
+			c.parent[edge.to] = &productEdge{to: from, link: edge.link}
+			queue.Enqueue(edge.to)
+		}
+	}
+	return c.err
+}
+
+// pathTo returns the shortest path from the init node to the product state.
+func (c *ltlChecker) pathTo(to productState) []*Link {
+	path := make([]*Link, 0)
+	for state := to; c.parent[state] != nil; state = c.parent[state].to {
+		path = append(path, c.parent[state].link)
+	}
+	path = append(path, InitNodeToLink(c.root))
+	slices.Reverse(path)
+	return path
+}
+
+// findFairAcceptingCycle returns a fair cycle in the product restricted to the states,
+// that visits every acceptance set, along with the state the cycle starts and ends at.
+func (c *ltlChecker) findFairAcceptingCycle(states []productState) (productState, []*Link) {
+	for _, scc := range c.stronglyConnectedComponents(states) {
+		if !c.isAccepting(scc) {
+			continue
+		}
+		cycle := c.coveringCycle(scc)
+		if isFairCycle(cycle, false) {
+			return scc[0], cycle
+		}
+		// For strong fairness, a fair cycle might exist after removing the states where
+		// a strongly fair action is enabled but not taken within the component.
+		taken := make(map[string]bool)
+		for _, link := range cycle {
+			taken[link.Name] = true
+		}
+		remaining := make([]productState, 0, len(scc))
+		for _, state := range scc {
+			starved := false
+			for _, link := range state.node.Outbound {
+				if link.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG && !taken[link.Name] {
+					starved = true
+					break
+				}
+			}
+			if !starved {
+				remaining = append(remaining, state)
+			}
+		}
+		if len(remaining) == 0 || len(remaining) == len(scc) {
+			continue
+		}
+		if start, cycle := c.findFairAcceptingCycle(remaining); cycle != nil {
+			return start, cycle
+		}
+	}
+	return productState{}, nil
+}
+
+func (c *ltlChecker) isAccepting(scc []productState) bool {
+	members := make(map[productState]bool, len(scc))
+	for _, state := range scc {
+		members[state] = true
+	}
+	hasCycle := len(scc) > 1
+	if !hasCycle {
+		for _, edge := range c.edges[scc[0]] {
+			if edge.to == scc[0] {
+				hasCycle = true
+			}
+		}
+	}
+	if !hasCycle {
+		return false
+	}
+	for i := 0; i < c.automaton.acceptanceSets; i++ {
+		found := false
+		for _, state := range scc {
+			if c.automaton.states[state.state].accepting[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// coveringCycle returns a cycle from the first state of the component, taking every transition
+// in the component, so the fairness check sees every action that can be taken in the cycle.
+func (c *ltlChecker) coveringCycle(scc []productState) []*Link {
+	members := make(map[productState]bool, len(scc))
+	for _, state := range scc {
+		members[state] = true
+	}
+	start := scc[0]
+	cycle := make([]*Link, 0)
+	current := start
+	covered := make(map[*Link]bool)
+	for _, state := range scc {
+		for _, edge := range c.edges[state] {
+			if !members[edge.to] || covered[edge.link] {
+				continue
+			}
+			cycle = append(cycle, c.pathWithin(members, current, state)...)
+			cycle = append(cycle, edge.link)
+			covered[edge.link] = true
+			current = edge.to
+		}
+	}
+	cycle = append(cycle, c.pathWithin(members, current, start)...)
+	return cycle
+}
+
+// pathWithin returns the shortest path between the states within the component.
+func (c *ltlChecker) pathWithin(members map[productState]bool, from, to productState) []*Link {
+	if from == to {
+		return nil
+	}
+	parent := map[productState]*productEdge{from: nil}
+	queue := lib.NewQueue[productState]()
+	queue.Enqueue(from)
+	for queue.Count() > 0 {
+		state, _ := queue.Dequeue()
+		if state == to {
+			break
+		}
+		for _, edge := range c.edges[state] {
+			if !members[edge.to] {
+				continue
+			}
+			if _, ok := parent[edge.to]; ok {
+				continue
+			}
+			parent[edge.to] = &productEdge{to: state, link: edge.link}
+			queue.Enqueue(edge.to)
+		}
+	}
+	path := make([]*Link, 0)
+	for state := to; parent[state] != nil; state = parent[state].to {
+		path = append(path, parent[state].link)
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// stronglyConnectedComponents returns the components of the product restricted to the states,
+// using Tarjan's algorithm.
+func (c *ltlChecker) stronglyConnectedComponents(states []productState) [][]productState {
+	members := make(map[productState]bool, len(states))
+	for _, state := range states {
+		members[state] = true
+	}
+	index := make(map[productState]int)
+	lowLink := make(map[productState]int)
+	onStack := make(map[productState]bool)
+	stack := make([]productState, 0)
+	components := make([][]productState, 0)
+
+	var connect func(v productState)
+	connect = func(v productState) {
+		index[v] = len(index)
+		lowLink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, edge := range c.edges[v] {
+			w := edge.to
+			if !members[w] {
+				continue
+			}
+			if _, ok := index[w]; !ok {
+				connect(w)
+				lowLink[v] = min(lowLink[v], lowLink[w])
+			} else if onStack[w] {
+				lowLink[v] = min(lowLink[v], index[w])
+			}
+		}
+		if lowLink[v] == index[v] {
+			component := make([]productState, 0)
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, state := range states {
+		if _, ok := index[state]; !ok {
+			connect(state)
+		}
+	}
+	return components
+}
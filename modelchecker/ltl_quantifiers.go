@@ -0,0 +1,219 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LtlQuantifier binds a variable to every instance of a role, or to every value
+// of a domain, like "forall c in Client: `c.pending` ~> `c.done`". The property is
+// checked separately for each instance, so one instance satisfying the predicate
+// does not mask another instance starving.
+type LtlQuantifier struct {
+	Var string
+	// Domain is either a role name, or a python expression in backquotes
+	// evaluated at every state, like `forall k in `KEYS`: ...`.
+	Domain string
+}
+
+func (q *LtlQuantifier) String() string {
+	return fmt.Sprintf("forall %s in %s", q.Var, q.Domain)
+}
+
+var ltlQuantifierPattern = regexp.MustCompile("^\\s*forall\\s+([A-Za-z_][A-Za-z0-9_]*)\\s+in\\s+([A-Za-z_][A-Za-z0-9_]*|`[^`]*`)\\s*:")
+
+// parseQuantifiedLtl parses the formula with the optional leading quantifiers.
+func parseQuantifiedLtl(formula string) ([]*LtlQuantifier, *LtlFormula, error) {
+	quantifiers := make([]*LtlQuantifier, 0)
+	rest := formula
+	for {
+		match := ltlQuantifierPattern.FindStringSubmatch(rest)
+		if match == nil {
+			break
+		}
+		for _, q := range quantifiers {
+			if q.Var == match[1] {
+				return nil, nil, fmt.Errorf("variable %s quantified more than once in formula: %s", q.Var, formula)
+			}
+		}
+		quantifiers = append(quantifiers, &LtlQuantifier{Var: match[1], Domain: match[2]})
+		rest = rest[len(match[0]):]
+	}
+	f, err := ParseLtl(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return quantifiers, f, nil
+}
+
+// ltlInstance is the role instance or the value bound to a quantified variable.
+type ltlInstance struct {
+	name string
+	// role is the RefStringShort of the role instance. As the fields change from state
+	// to state, the role is looked up in each state.
+	role  string
+	value starlark.Value
+}
+
+// ltlBinding is the instances bound to the quantified variables of a property.
+type ltlBinding []*ltlInstance
+
+// String returns the binding in the report format, like `c=Client#1`.
+func (b ltlBinding) String() string {
+	parts := make([]string, len(b))
+	for i, instance := range b {
+		parts[i] = instance.name
+	}
+	return strings.Join(parts, ", ")
+}
+
+// addTo binds the variables for the evaluation at the process, and returns the
+// variables bound to the role instances that do not exist at the process.
+func (b ltlBinding) addTo(process *Process, vars starlark.StringDict, quantifiers []*LtlQuantifier) map[string]bool {
+	missing := make(map[string]bool)
+	for i, instance := range b {
+		if instance.role == "" {
+			vars[quantifiers[i].Var] = instance.value
+			continue
+		}
+		found := false
+		for _, role := range process.Roles {
+			if role.RefStringShort() == instance.role {
+				vars[quantifiers[i].Var] = role
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing[quantifiers[i].Var] = true
+			vars[quantifiers[i].Var] = starlark.None
+		}
+	}
+	return missing
+}
+
+// validateDomains returns an error if a domain of the quantifiers is neither a role
+// nor an expression in backquotes.
+func (p *TemporalProperty) validateDomains(roles []*ast.Role) error {
+	for _, q := range p.Quantifiers {
+		if strings.HasPrefix(q.Domain, "`") {
+			continue
+		}
+		if !slices.ContainsFunc(roles, func(role *ast.Role) bool { return role.Name == q.Domain }) {
+			return fmt.Errorf("property %s: %s is not a role, use backquotes for expressions", p.Name, q.Domain)
+		}
+	}
+	return nil
+}
+
+// ltlBindings returns every binding of the quantified variables to the instances
+// that exist in any of the states reachable from the root. It returns an error if
+// a domain expression fails to evaluate or is not iterable.
+func ltlBindings(root *Node, quantifiers []*LtlQuantifier) ([]ltlBinding, error) {
+	roleNames := make(map[string]bool)
+	for _, file := range root.Process.Files {
+		for _, role := range file.Roles {
+			roleNames[role.Name] = true
+		}
+	}
+	instances := make([]map[string]*ltlInstance, len(quantifiers))
+	for i := range quantifiers {
+		instances[i] = make(map[string]*ltlInstance)
+	}
+	filename := root.Process.Files[0].GetSourceInfo().GetFileName()
+
+	visited := map[*Node]bool{root: true}
+	queue := lib.NewQueue[*Node]()
+	queue.Enqueue(root)
+	for queue.Count() > 0 {
+		node, _ := queue.Dequeue()
+		for _, link := range node.Outbound {
+			if !visited[link.Node] && link.Node.Process != nil {
+				visited[link.Node] = true
+				queue.Enqueue(link.Node)
+			}
+		}
+		if !isYieldPoint(node) {
+			continue
+		}
+		for i, q := range quantifiers {
+			if roleNames[q.Domain] {
+				for _, role := range node.Process.Roles {
+					if role.Name == q.Domain {
+						name := role.RefStringShort()
+						instances[i][name] = &ltlInstance{name: q.Var + "=" + name, role: name}
+					}
+				}
+				continue
+			}
+			if !strings.HasPrefix(q.Domain, "`") {
+				return nil, fmt.Errorf("%s: %s is not a role, use backquotes for expressions", q, q.Domain)
+			}
+			expr := strings.Trim(q.Domain, "`")
+			val, err := node.Process.Evaluator.EvalPyExpr(filename, expr, node.Process.getGuardVariables(nil))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", q, err)
+			}
+			domain, ok := val.(starlark.Iterable)
+			if !ok {
+				return nil, fmt.Errorf("%s: domain must be iterable, got %s", q, val.Type())
+			}
+			iter := domain.Iterate()
+			var x starlark.Value
+			for iter.Next(&x) {
+				name := actionArgString(x)
+				instances[i][name] = &ltlInstance{name: q.Var + "=" + name, value: x}
+			}
+			iter.Done()
+		}
+	}
+
+	bindings := []ltlBinding{{}}
+	for i := range quantifiers {
+		names := make([]string, 0, len(instances[i]))
+		for name := range instances[i] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		next := make([]ltlBinding, 0, len(bindings)*len(names))
+		for _, binding := range bindings {
+			for _, name := range names {
+				next = append(next, append(binding[:len(binding):len(binding)], instances[i][name]))
+			}
+		}
+		bindings = next
+	}
+	return bindings, nil
+}
+
+// exprIdentifiers returns the identifiers referenced in the python expression.
+func exprIdentifiers(e *Evaluator, expr string) (map[string]bool, error) {
+	parsed, err := e.options.ParseExpr("", expr, 0)
+	if err != nil {
+		return nil, err
+	}
+	identifiers := make(map[string]bool)
+	syntax.Walk(parsed, func(n syntax.Node) bool {
+		if ident, ok := n.(*syntax.Ident); ok {
+			identifiers[ident.Name] = true
+		}
+		return true
+	})
+	return identifiers, nil
+}
+
+func usesAny(identifiers map[string]bool, names map[string]bool) bool {
+	for name := range names {
+		if identifiers[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	"slices"
+	"testing"
+)
+
+func TestParseLtl(t *testing.T) {
+	tests := []struct {
+		formula  string
+		expected string
+	}{
+		{"a", "a"},
+		{"!a", "!a"},
+		{"not a and b", "(!a and b)"},
+		{"a || b && c", "(a or (b and c))"},
+		{"a -> b -> c", "(a -> (b -> c))"},
+		{"[]<>a", "always eventually a"},
+		{"always eventually a", "always eventually a"},
+		{"a until b until c", "(a until (b until c))"},
+		{"next a release b", "(next a release b)"},
+		{"`x > 0` ~> `y == x`", "(`x > 0` ~> `y == x`)"},
+		{"[](a -> <>b) && (c || !d)", "(always (a -> eventually b) and (c or !d))"},
+	}
+	for _, test := range tests {
+		t.Run(test.formula, func(t *testing.T) {
+			f, err := ParseLtl(test.formula)
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, f.String())
+		})
+	}
+
+	for _, formula := range []string{"", "a b", "(a", "a && ", "`x > 0", "a $ b"} {
+		_, err := ParseLtl(formula)
+		assert.NotNil(t, err, formula)
+	}
+}
+
+func TestCheckTemporalProperty(t *testing.T) {
+	run := func(replyFairness ast.FairnessLevel) *Node {
+		file, err := parseAstFromString(RequestReply)
+		require.Nil(t, err)
+		file.Actions[1].Fairness.Level = replyFairness
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           10,
+				MaxConcurrentActions: 1,
+				CrashOnYield:         &crashOnYield,
+			},
+		}, false, 0, "")
+		root, _, err := p1.Start()
+		require.Nil(t, err)
+		require.NotNil(t, root)
+		return root
+	}
+	check := func(root *Node, formula string) ([]*Link, bool) {
+		f, err := ParseLtl(formula)
+		require.Nil(t, err)
+		path, _, holds, err := CheckTemporalProperty(root, &TemporalProperty{Name: "Property", Formula: f})
+		require.Nil(t, err)
+		return path, holds
+	}
+
+	fair := run(ast.FairnessLevel_FAIRNESS_LEVEL_WEAK)
+	unfair := run(ast.FairnessLevel_FAIRNESS_LEVEL_UNFAIR)
+
+	_, holds := check(fair, "`requested` ~> `replied`")
+	assert.True(t, holds)
+	_, holds = check(fair, "!`replied` until `requested`")
+	assert.True(t, holds)
+	_, holds = check(fair, "[]<>`replied` && []<>`requested`")
+	assert.True(t, holds)
+	_, holds = check(fair, "<>[]`requested`")
+	assert.False(t, holds)
+	_, holds = check(fair, "[](`replied` -> !`requested`)")
+	assert.True(t, holds)
+	// Safety violations are reported regardless of the fairness
+	_, holds = check(fair, "[]!`replied`")
+	assert.False(t, holds)
+
+	path, holds := check(unfair, "`requested` ~> `replied`")
+	assert.False(t, holds)
+	require.NotEmpty(t, path)
+	assert.Equal(t, "Init", path[0].Name)
+	last := path[len(path)-1]
+	assert.Equal(t, "stutter", last.Name)
+	assert.Equal(t, starlark.Bool(true), last.Node.Heap.state["requested"])
+	_, holds = check(unfair, "!`replied` until `requested`")
+	assert.True(t, holds)
+
+	// An atom failing to evaluate, like a typo, is an error.
+	f, err := ParseLtl("`requested` ~> `replyed`")
+	require.Nil(t, err)
+	_, _, _, err = CheckTemporalProperty(fair, &TemporalProperty{Name: "Typo", Formula: f})
+	assert.ErrorContains(t, err, "property Typo")
+}
+
+func TestCheckTemporalProperty_Quantified(t *testing.T) {
+	file, err := parseAstFromString(ClientsWithUnfairServer)
+	require.Nil(t, err)
+	crashOnYield := false
+	p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           10,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+	}, false, 0, "")
+	root, _, err := p1.Start()
+	require.Nil(t, err)
+	require.NotNil(t, root)
+
+	check := func(formula string) ([]*Link, string, bool) {
+		quantifiers, f, err := parseQuantifiedLtl(formula)
+		require.Nil(t, err)
+		path, instance, holds, err := CheckTemporalProperty(root, &TemporalProperty{Name: "Property", Quantifiers: quantifiers, Formula: f})
+		require.Nil(t, err)
+		return path, instance, holds
+	}
+
+	// Without the quantifier, the first client being served masks the second client starving.
+	_, _, holds := check("`any([c.pending for c in clients])` ~> `any([c.done for c in clients])`")
+	assert.True(t, holds)
+
+	path, instance, holds := check("forall c in Client: `c.pending` ~> `c.done`")
+	assert.False(t, holds)
+	assert.Equal(t, "c=Client#1", instance)
+	require.NotEmpty(t, path)
+	last := path[len(path)-1].Node
+	client := last.Process.Heap.state["clients"].(*starlark.List).Index(1).(*lib.Role)
+	pending, err := client.Fields.Attr("pending")
+	require.Nil(t, err)
+	assert.Equal(t, starlark.True, pending)
+
+	_, instance, holds = check("forall i in `range(len(clients))`: `clients[i].pending` ~> `clients[i].done`")
+	assert.False(t, holds)
+	assert.Equal(t, "i=1", instance)
+
+	_, instance, holds = check("forall c in Client: <>`c.done`")
+	assert.False(t, holds)
+	assert.Equal(t, "c=Client#1", instance)
+	_, _, holds = check("forall c in Client: <>`c.pending`")
+	assert.True(t, holds)
+
+	// The domains failing to evaluate or not iterable are errors.
+	for _, formula := range []string{"forall k in `KEYS`: <>`k`", "forall k in `len(clients)`: <>`k`"} {
+		quantifiers, f, err := parseQuantifiedLtl(formula)
+		require.Nil(t, err)
+		_, _, _, err = CheckTemporalProperty(root, &TemporalProperty{Name: "Property", Quantifiers: quantifiers, Formula: f})
+		assert.NotNil(t, err, formula)
+	}
+}
+
+func TestTemporalProperties(t *testing.T) {
+	file := &ast.File{
+		Invariants: []*ast.Invariant{
+			{Name: "Safe", TemporalOperators: []string{"always"}, Block: &ast.Block{}},
+			{Name: "Done", TemporalOperators: []string{"eventually"}, Block: &ast.Block{}},
+			{Name: "Stable", TemporalOperators: []string{"eventually", "always"}, Block: &ast.Block{}},
+			{Name: "Recurring", TemporalOperators: []string{"always", "eventually", "always"}, Block: &ast.Block{}},
+		},
+		Roles: []*ast.Role{{Name: "Client"}},
+	}
+	options := &ast.StateSpaceOptions{
+		Properties: map[string]string{
+			"Response":   "Safe ~> Done",
+			"Progress":   "[]<>Done",
+			"Quantified": "forall c in Client: forall k in `KEYS`: Safe ~> Done",
+		},
+	}
+	properties, err := TemporalProperties([]*ast.File{file}, options)
+	require.Nil(t, err)
+	names := make([]string, len(properties))
+	formulas := make([]string, len(properties))
+	for i, property := range properties {
+		names[i] = property.Name
+		formulas[i] = property.Formula.String()
+	}
+	assert.Equal(t, []string{"Done", "Recurring", "Progress", "Quantified", "Response"}, names)
+	assert.Equal(t, []string{"eventually Done", "always eventually always Recurring", "always eventually Done", "(Safe ~> Done)", "(Safe ~> Done)"}, formulas)
+	assert.Equal(t, []*LtlQuantifier{{Var: "c", Domain: "Client"}, {Var: "k", Domain: "`KEYS`"}}, properties[3].Quantifiers)
+	assert.Equal(t, NewInvariantPosition(0, 1), properties[0].Position)
+	assert.Nil(t, properties[2].Position)
+
+	options.Properties["Invalid"] = "Safe ~>"
+	_, err = TemporalProperties([]*ast.File{file}, options)
+	assert.NotNil(t, err)
+
+	delete(options.Properties, "Invalid")
+	options.Properties["Unknown"] = "Safe ~> Missing"
+	_, err = TemporalProperties([]*ast.File{file}, options)
+	assert.ErrorContains(t, err, "assertion Missing not found")
+
+	delete(options.Properties, "Unknown")
+	file.Invariants = append(file.Invariants, &ast.Invariant{Name: "Monotonic", TemporalOperators: []string{"always"}, Transition: true, Block: &ast.Block{}})
+	options.Properties["Transition"] = "[]<>Monotonic"
+	_, err = TemporalProperties([]*ast.File{file}, options)
+	assert.ErrorContains(t, err, "transition assertion Monotonic")
+
+	delete(options.Properties, "Transition")
+	options.Properties["Domain"] = "forall k in KEYS: Safe ~> Done"
+	_, err = TemporalProperties([]*ast.File{file}, options)
+	assert.ErrorContains(t, err, "KEYS is not a role")
+}
+
+func TestTemporalProperties_Predicates(t *testing.T) {
+	start := func(properties map[string]string) (*ast.File, *Processor, *Node, *Node) {
+		file, err := parseAstFromString(RequestReply)
+		require.Nil(t, err)
+		file.Invariants = append(file.Invariants, &ast.Invariant{
+			Name:              "Idle",
+			TemporalOperators: []string{"always"},
+			Block: &ast.Block{
+				Flow:  ast.Flow_FLOW_ATOMIC,
+				Stmts: []*ast.Statement{{ReturnStmt: &ast.ReturnStmt{PyExpr: "not replied", Expr: &ast.Expr{PyExpr: "not replied"}}}},
+			},
+		})
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           10,
+				MaxConcurrentActions: 1,
+				CrashOnYield:         &crashOnYield,
+			},
+			Properties: properties,
+		}, false, 0, "")
+		root, failedNode, err := p1.Start()
+		require.Nil(t, err)
+		return file, p1, root, failedNode
+	}
+
+	// Idle is false after the first reply, so it fails as an invariant.
+	_, _, _, failedNode := start(nil)
+	require.NotNil(t, failedNode)
+
+	// Used as an atom of a property, the assertion is a predicate, not an invariant.
+	properties := map[string]string{"ReplyAfterRequest": "`requested` ~> !Idle"}
+	file, p1, root, failedNode := start(properties)
+	assert.Nil(t, failedNode)
+	assert.False(t, file.Invariants[0].Predicate)
+	assert.True(t, p1.Files[0].Invariants[0].Predicate)
+	temporal, err := TemporalProperties(p1.Files, &ast.StateSpaceOptions{Properties: properties})
+	require.Nil(t, err)
+	require.Len(t, temporal, 1)
+	_, _, holds, err := CheckTemporalProperty(root, temporal[0])
+	require.Nil(t, err)
+	assert.True(t, holds)
+}
+
+func TestStartSimulation_Lasso(t *testing.T) {
+	start := func(replyFairness ast.FairnessLevel, formula string, seed int64) (*Processor, *Node, error) {
+		file, err := parseAstFromString(RequestReply)
+		require.Nil(t, err)
+		file.Actions[1].Fairness.Level = replyFairness
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           10,
+				MaxConcurrentActions: 1,
+				CrashOnYield:         &crashOnYield,
+			},
+			Properties: map[string]string{"Property": formula},
+		}, true, seed, "")
+		_, failedNode, err := p1.StartSimulation()
+		return p1, failedNode, err
+	}
+	simulate := func(replyFairness ast.FairnessLevel, formula string, seed int64) *Processor {
+		p1, failedNode, err := start(replyFairness, formula, seed)
+		require.Nil(t, err)
+		if p1.LassoFailure() != nil {
+			assert.Equal(t, p1.LassoFailure().Path[len(p1.LassoFailure().Path)-1].Node, failedNode)
+		}
+		return p1
+	}
+
+	for seed := int64(1); seed <= 10; seed++ {
+		// Every fair behavior alternates between the requests and the replies.
+		assert.Nil(t, simulate(ast.FairnessLevel_FAIRNESS_LEVEL_WEAK, "`requested` ~> `replied`", seed).LassoFailure())
+
+		failure := simulate(ast.FairnessLevel_FAIRNESS_LEVEL_WEAK, "<>[]`requested`", seed).LassoFailure()
+		require.NotNil(t, failure)
+		assert.Equal(t, "Property", failure.Property.Name)
+		// The loop goes back to a state in the path
+		last := failure.Path[len(failure.Path)-1]
+		assert.NotEqual(t, "stutter", last.Name)
+		revisited := slices.ContainsFunc(failure.Path[:len(failure.Path)-1], func(link *Link) bool {
+			return link.Node == last.Node
+		})
+		assert.True(t, revisited)
+
+		// Without fairness, the reply may never happen after the request.
+		failure = simulate(ast.FairnessLevel_FAIRNESS_LEVEL_UNFAIR, "`requested` ~> `replied`", seed).LassoFailure()
+		require.NotNil(t, failure)
+		last = failure.Path[len(failure.Path)-1]
+		assert.Equal(t, "stutter", last.Name)
+		assert.Equal(t, starlark.True, last.Node.Heap.state["requested"])
+	}
+
+	_, _, err := start(ast.FairnessLevel_FAIRNESS_LEVEL_WEAK, "`requested` ~> `replyed`", 1)
+	assert.ErrorContains(t, err, "property Property")
+}
+
+func TestEvalLasso(t *testing.T) {
+	// p holds at the positions 0 and 2, and the positions 1 and 2 repeat forever.
+	valuations := []map[string]bool{{"p": true}, {"p": false}, {"p": true}}
+	tests := []struct {
+		formula  string
+		expected bool
+	}{
+		{"p", true},
+		{"next p", false},
+		{"[]<>p", true},
+		{"<>[]p", false},
+		{"[]p", false},
+		{"p until !p", true},
+		{"!p ~> p", true},
+		{"next next next !p", true},
+	}
+	for _, test := range tests {
+		f, err := ParseLtl(test.formula)
+		require.Nil(t, err)
+		assert.Equal(t, test.expected, evalLasso(f, valuations, 1)[0], test.formula)
+	}
+}
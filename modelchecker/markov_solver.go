@@ -0,0 +1,230 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// SolverGaussSeidel updates each state from the values already updated in the same
+	// iteration, converging in fewer iterations. This is the default.
+	SolverGaussSeidel = "gauss_seidel"
+	// SolverJacobi updates every state from the values of the previous iteration.
+	SolverJacobi = "jacobi"
+)
+
+const (
+	defaultTolerance     = 1e-7
+	defaultMaxIterations = 10000
+)
+
+// solverOptions are the settings of the iterative solvers, from the PerformanceModel.
+type solverOptions struct {
+	method        string
+	tolerance     float64
+	maxIterations int
+	// unconverged are the solves stopped at maxIterations before reaching the tolerance.
+	unconverged map[string]bool
+	// unknownMethod is the solver requested, if unknown and replaced by Gauss-Seidel.
+	unknownMethod string
+}
+
+func newSolverOptions(perfModel *proto.PerformanceModel) *solverOptions {
+	options := &solverOptions{
+		method:        perfModel.GetSolver(),
+		tolerance:     perfModel.GetTolerance(),
+		maxIterations: int(perfModel.GetMaxIterations()),
+	}
+	switch options.method {
+	case "":
+		options.method = SolverGaussSeidel
+	case SolverGaussSeidel, SolverJacobi:
+	default:
+		// The solver is checked by ValidatePerfModel, but the PerformanceModel
+		// can be passed directly to the exported analyses.
+		options.unknownMethod = options.method
+		options.method = SolverGaussSeidel
+	}
+	if options.tolerance <= 0 {
+		options.tolerance = defaultTolerance
+	}
+	if options.maxIterations <= 0 {
+		options.maxIterations = defaultMaxIterations
+	}
+	return options
+}
+
+// notConverged records that the solve stopped at maxIterations before reaching the tolerance.
+func (o *solverOptions) notConverged(solve string) {
+	if o.unconverged == nil {
+		o.unconverged = make(map[string]bool)
+	}
+	o.unconverged[solve] = true
+}
+
+// warnings returns a warning for an unknown solver, and for each solve that did not converge,
+// as the results may be inaccurate.
+func (o *solverOptions) warnings() []string {
+	warnings := make([]string, 0, len(o.unconverged))
+	for solve := range o.unconverged {
+		warnings = append(warnings, fmt.Sprintf("the %s did not converge in %d iterations of %s, increase max_iterations or tolerance",
+			solve, o.maxIterations, o.method))
+	}
+	sort.Strings(warnings)
+	if o.unknownMethod != "" {
+		warnings = append([]string{fmt.Sprintf("unknown solver %s, using %s", o.unknownMethod, o.method)}, warnings...)
+	}
+	return warnings
+}
+
+// longRunDistribution returns the long run distribution of the chain from the initial distribution,
+// along with the expected number of visits to each transient state.
+//
+// The transient states are the states not in a bottom strongly connected component. In each bottom
+// component, the distribution is the stationary distribution of the component, scaled by the
+// probability of reaching it. The other states have the probability 0.
+func (o *solverOptions) longRunDistribution(transitionMatrix *sparseMatrix, init []float64) ([]float64, []float64) {
+	transposed := transitionMatrix.transpose()
+	component, bottom := transitionMatrix.bottomComponents()
+	transient := make([]bool, transitionMatrix.n)
+	members := make(map[int][]int)
+	for j := range transient {
+		if bottom[component[j]] {
+			members[component[j]] = append(members[component[j]], j)
+		} else {
+			transient[j] = true
+		}
+	}
+	visits := o.expectedVisits(transposed, transient, init)
+
+	// The probability of reaching each bottom component, from the initial distribution
+	// or from the last transient state visited.
+	reached := transitionMatrix.leftMultiply(visits)
+	distribution := make([]float64, transitionMatrix.n)
+	for _, states := range members {
+		probability := 0.0
+		for _, j := range states {
+			probability += init[j] + reached[j]
+		}
+		if probability == 0 {
+			continue
+		}
+		stationary := o.stationaryDistribution(transposed, states, component)
+		for a, j := range states {
+			distribution[j] = probability * stationary[a]
+		}
+	}
+	return distribution, visits
+}
+
+// expectedVisits returns the expected number of visits to each transient state, starting from
+// the initial distribution. The visits to the recurrent states are not computed, and are 0.
+// It solves v = init + vP restricted to the transient states, using the transposed transition matrix.
+func (o *solverOptions) expectedVisits(transposed *sparseMatrix, transient []bool, init []float64) []float64 {
+	visits := make([]float64, transposed.n)
+	for j := range visits {
+		if transient[j] {
+			visits[j] = init[j]
+		}
+	}
+	previous := make([]float64, len(visits))
+	converged := false
+	for iteration := 0; iteration < o.maxIterations && !converged; iteration++ {
+		copy(previous, visits)
+		// Gauss-Seidel uses the values already updated in this iteration.
+		source := visits
+		if o.method == SolverJacobi {
+			source = previous
+		}
+		for j := range visits {
+			if !transient[j] {
+				continue
+			}
+			value, stay := init[j], 0.0
+			cols, values := transposed.row(j)
+			for k, i := range cols {
+				if !transient[i] {
+					continue
+				}
+				if i == j {
+					stay = values[k]
+				} else {
+					value += source[i] * values[k]
+				}
+			}
+			visits[j] = value / (1 - stay)
+		}
+		converged = maxDifference(visits, previous) < o.tolerance
+	}
+	if !converged {
+		o.notConverged("expected visits")
+	}
+	return visits
+}
+
+// stationaryDistribution returns the stationary distribution within the bottom component
+// of the members, solving π = πP with the probabilities of the members adding up to 1.
+// For a periodic component, it is the fraction of the time spent in each state.
+func (o *solverOptions) stationaryDistribution(transposed *sparseMatrix, members []int, component []int) []float64 {
+	distribution := make([]float64, len(members))
+	for a := range distribution {
+		distribution[a] = 1 / float64(len(members))
+	}
+	if len(members) == 1 {
+		return distribution
+	}
+	position := make(map[int]int, len(members))
+	for a, j := range members {
+		position[j] = a
+	}
+	id := component[members[0]]
+	previous := make([]float64, len(members))
+	converged := false
+	for iteration := 0; iteration < o.maxIterations && !converged; iteration++ {
+		copy(previous, distribution)
+		source := distribution
+		if o.method == SolverJacobi {
+			source = previous
+		}
+		for a, j := range members {
+			value, stay := 0.0, 0.0
+			cols, values := transposed.row(j)
+			for k, i := range cols {
+				if component[i] != id {
+					continue
+				}
+				if i == j {
+					stay = values[k]
+				} else {
+					value += source[position[i]] * values[k]
+				}
+			}
+			value /= 1 - stay
+			if o.method == SolverJacobi {
+				// Jacobi alone oscillates on periodic components, so it is damped. That is the lazy
+				// chain staying at each state with probability 1/2, with the same stationary distribution.
+				value = (value + previous[a]) / 2
+			}
+			distribution[a] = value
+		}
+		total := sum(distribution)
+		for a := range distribution {
+			distribution[a] /= total
+		}
+		converged = maxDifference(distribution, previous) < o.tolerance
+	}
+	if !converged {
+		o.notConverged("stationary distribution")
+	}
+	return distribution
+}
+
+func maxDifference(a, b []float64) float64 {
+	result := 0.0
+	for i := range a {
+		result = math.Max(result, math.Abs(a[i]-b[i]))
+	}
+	return result
+}
@@ -9,43 +9,6 @@ import (
 	"strings"
 )
 
-func matrixVectorProduct(matrix [][]float64, vector []float64) []float64 {
-	result := make([]float64, len(vector))
-
-	for i := range matrix {
-		for j := range matrix[i] {
-			result[i] += matrix[i][j] * vector[j]
-		}
-	}
-	//fmt.Printf("Matrix Vector Product:%v\n", result)
-	return result
-}
-
-func multiplyMatrices(a, b [][]float64) [][]float64 {
-	rows := len(a)
-	cols := len(a[0])
-
-	// Check if matrices have the same dimensions
-	if len(b) != rows || len(b[0]) != cols {
-		panic("Matrices must have the same dimensions for element-wise multiplication")
-	}
-
-	// Initialize the result matrix
-	result := make([][]float64, rows)
-	for i := range result {
-		result[i] = make([]float64, cols)
-	}
-
-	// Perform element-wise multiplication
-	for i := 0; i < rows; i++ {
-		for j := 0; j < cols; j++ {
-			result[i][j] = a[i][j] * b[i][j]
-		}
-	}
-
-	return result
-}
-
 func vectorNorm(vector []float64) float64 {
 	sum := 0.0
 	for _, v := range vector {
@@ -56,24 +19,6 @@ func vectorNorm(vector []float64) float64 {
 	return math.Sqrt(sum)
 }
 
-func normalizeVector(vector []float64) {
-	norm := vectorNorm(vector)
-	for i := range vector {
-		vector[i] /= norm
-	}
-}
-func printMatrix(matrix [][]float64) {
-	fmt.Println("[")
-	for _, row := range matrix {
-		fmt.Print("[")
-		for _, v := range row {
-			fmt.Printf("%f,", v)
-		}
-		fmt.Println("],")
-	}
-	fmt.Println("]")
-}
-
 type Histogram struct {
 	entries []HistogramEntry
 	mean map[string]float64
@@ -92,9 +37,16 @@ func (h *Histogram) GetMean(counter string) float64 {
 	return h.mean[counter]
 }
 
+// GetVariance returns the variance of the counter until termination.
+func (h *Histogram) GetVariance(counter string) float64 {
+	return h.variance[counter]
+}
+
+// HistogramEntry is the probability of having terminated after a step of the chain,
+// with the expected counters of the runs not terminated yet at the step.
 type HistogramEntry struct {
-	percentile float64
-	counters  map[string]float64
+	Percentile float64            `json:"percentile"`
+	Counters   map[string]float64 `json:"counters"`
 }
 
 func (h *Histogram) addEntry(percentile float64, counters map[string]float64) {
@@ -102,14 +54,14 @@ func (h *Histogram) addEntry(percentile float64, counters map[string]float64) {
 	for k, v := range counters {
 		newCounters[k] = v
 	}
-	h.entries = append(h.entries, HistogramEntry{percentile: percentile, counters: newCounters})
+	h.entries = append(h.entries, HistogramEntry{Percentile: percentile, Counters: newCounters})
 }
 
 func newHistogram() *Histogram {
 	return &Histogram{entries: make([]HistogramEntry, 0), mean: make(map[string]float64), variance: make(map[string]float64)}
 }
 
-func steadyStateDistribution(root *Node, perfModel *proto.PerformanceModel) ([]float64, *Histogram) {
+func steadyStateDistribution(root *Node, configs *perfConfigs, options *solverOptions) ([]float64, *Histogram) {
 
 
 	// Create the transition matrix
@@ -126,91 +78,122 @@ func steadyStateDistribution(root *Node, perfModel *proto.PerformanceModel) ([]f
 	//}
 
 	//transitionMatrix := createTransitionMatrix(nodes)
-	transitionMatrix := genTransitionMatrix(nodes, perfModel)
-	return markovChainAnalysis(nodes, perfModel, transitionMatrix, initialDistribution)
+	transitionMatrix := genTransitionMatrix(nodes, configs)
+	return markovChainAnalysis(nodes, configs, transitionMatrix, initialDistribution, options)
 }
 
-func markovChainAnalysis(nodes []*Node, perfModel *proto.PerformanceModel, transitionMatrix [][]float64, initialDistribution []float64) ([]float64, *Histogram) {
-	matrices := genCounterMatrices(nodes, perfModel)
-	histogram := newHistogram()
-	//fmt.Printf("\ninitial distribution:\n%v\n", initialDistribution)
-	//fmt.Printf("\nTransition Matrix:\n%v\n", transitionMatrix)
-	transitionMatrix = transpose(transitionMatrix)
-	//printMatrix(transitionMatrix)
-	expectedCounterMatrices := make(map[string][][]float64)
-	//rawCounterMatrices := make(map[string][][]float64)
+// markovChainAnalysis returns the long run distribution of the chain from the initial distribution,
+// and the histogram of the counters until termination. The expected counters are the counters
+// incremented until the chain leaves the transient states.
+func markovChainAnalysis(nodes []*Node, configs *perfConfigs, transitionMatrix *sparseMatrix, initialDistribution []float64, options *solverOptions) ([]float64, *Histogram) {
+	counterMatrices := genCounterMatrices(nodes, configs)
+	rewards := make(map[string][]float64)
+	for counterName, matrix := range counterMatrices {
+		rewards[counterName] = transitionMatrix.rowProducts(matrix)
+	}
+	distribution, visits := options.longRunDistribution(transitionMatrix, initialDistribution)
+
 	mean := make(map[string]float64)
-	rawCounters := make(map[string]float64)
-	for counterName, matrix := range matrices {
-		m := transpose(matrix)
-		expectedCounterMatrices[counterName] = multiplyMatrices(m, transitionMatrix)
-		//rawCounterMatrices[counterName] = m
-		mean[counterName] = 0.0
-		rawCounters[counterName] = 0.0
-		//fmt.Println(counterName)
-		//printMatrix(expectedCounterMatrices[counterName])
+	for counter, reward := range rewards {
+		mean[counter] = 0.0
+		for j, visit := range visits {
+			mean[counter] += visit * reward[j]
+		}
 	}
 
-	// Compute the matrix power (raise the matrix to a sufficiently large power)
-	iterations := 10000
+	histogram := terminationHistogram(nodes, transitionMatrix, rewards, initialDistribution, options)
+	histogram.mean = mean
+	histogram.variance = counterVariances(transitionMatrix, counterMatrices, rewards, visits, mean, options)
+	return distribution, histogram
+}
+
+// counterVariances returns the variance of each counter until termination, from the second moment
+// E[R^2] = sum of the visits to each transient state i times sum_j P(i,j) (r(i,j)^2 + 2 r(i,j) m(j)),
+// where m(j) is the expected counter from the state j until termination.
+func counterVariances(transitionMatrix *sparseMatrix, counterMatrices map[string]*sparseMatrix, rewards map[string][]float64, visits []float64, mean map[string]float64, options *solverOptions) map[string]float64 {
+	component, bottom := transitionMatrix.bottomComponents()
+	transient := make([]bool, transitionMatrix.n)
+	for j := range transient {
+		transient[j] = !bottom[component[j]]
+	}
+	variance := make(map[string]float64)
+	for counter, matrix := range counterMatrices {
+		// m = r + Pm over the transient states is the same iteration as the visits, on P instead of P^T.
+		future := options.expectedVisits(transitionMatrix, transient, rewards[counter])
+		secondMoment := 0.0
+		for i, visit := range visits {
+			if !transient[i] || visit == 0 {
+				continue
+			}
+			cols, values := transitionMatrix.row(i)
+			for k, j := range cols {
+				r := matrix.get(i, j)
+				secondMoment += visit * values[k] * (r*r + 2*r*future[j])
+			}
+		}
+		variance[counter] = math.Max(secondMoment-mean[counter]*mean[counter], 0)
+	}
+	return variance
+}
 
-	// Iterate to find the steady-state distribution
+// terminationHistogram steps the chain from the initial distribution, to find the probability of
+// having terminated after each step, along with the counters of the runs not terminated yet.
+func terminationHistogram(nodes []*Node, transitionMatrix *sparseMatrix, rewards map[string][]float64, initialDistribution []float64, options *solverOptions) *Histogram {
+	histogram := newHistogram()
+	if len(rewards) == 0 {
+		return histogram
+	}
+	rawCounters := make(map[string]float64)
+	for counter := range rewards {
+		rawCounters[counter] = 0.0
+	}
 	currentDistribution := initialDistribution
-	//fmt.Println(currentDistribution)
 	altCurrentDistribution := make([]float64, len(nodes))
 	copy(altCurrentDistribution, currentDistribution)
 	prevTerminationProbability := 0.0
-	for i := 0; i < iterations; i++ { // Max iterations to avoid infinite loop
+	for i := 0; i < options.maxIterations; i++ {
 		terminationProbability := 0.0
-		for counter, counterMatrix := range expectedCounterMatrices {
-			mean[counter] += sum(matrixVectorProduct(counterMatrix, currentDistribution))
-			rawCounters[counter] += sum(matrixVectorProduct(counterMatrix, altCurrentDistribution))
+		for counter, reward := range rewards {
+			for j, p := range altCurrentDistribution {
+				rawCounters[counter] += p * reward[j]
+			}
 		}
 
-		nextDistribution := matrixVectorProduct(transitionMatrix, currentDistribution)
-		altCurrentDistribution = matrixVectorProduct(transitionMatrix, altCurrentDistribution)
-
-		//fmt.Println(i+1, nextDistribution)
-
+		nextDistribution := transitionMatrix.leftMultiply(currentDistribution)
+		altCurrentDistribution = transitionMatrix.leftMultiply(altCurrentDistribution)
 
 		totalProb := 0.0
-		for j, _ := range altCurrentDistribution {
-			if transitionMatrix[j][j] == 1.0 || (nodes[j].Process != nil &&
+		for j := range altCurrentDistribution {
+			if transitionMatrix.get(j, j) == 1.0 || (nodes[j].Process != nil &&
 				len(nodes[j].Process.Threads) == 0 && len(nodes[j].Process.Witness) > 0 && len(nodes[j].Process.Witness[0]) > 0 &&
 				nodes[j].Process.Witness[0][0]) {
 				altCurrentDistribution[j] = 0.0
 				terminationProbability += nextDistribution[j]
 			}
 			totalProb += altCurrentDistribution[j]
-
 		}
-		if len(mean) > 0 {
-			//fmt.Println(i+1, rawCounters)
-			//fmt.Println(i+1, mean)
-			//fmt.Println(i+1, terminationProbability)
-			if terminationProbability > prevTerminationProbability {
-				prevTerminationProbability = terminationProbability
-				histogram.addEntry(terminationProbability, rawCounters)
-			}
+		if terminationProbability > prevTerminationProbability {
+			prevTerminationProbability = terminationProbability
+			histogram.addEntry(terminationProbability, rawCounters)
 		}
-		for j, f := range altCurrentDistribution {
-			altCurrentDistribution[j] = f / totalProb
+		if totalProb > 0 {
+			for j, f := range altCurrentDistribution {
+				altCurrentDistribution[j] = f / totalProb
+			}
 		}
-		//fmt.Println(i+1, terminationProbability)
-		// Check for convergence (you may define a suitable threshold)
-		if vectorNorm(vectorDifference(nextDistribution, currentDistribution)) < 1e-7 {
+		if vectorNorm(vectorDifference(nextDistribution, currentDistribution)) < options.tolerance {
 			break
 		}
-
 		currentDistribution = nextDistribution
 	}
-	//fmt.Println(mean)
-	//fmt.Println(rawCounters)
-	histogram.mean = mean
-	return currentDistribution, histogram
+	return histogram
 }
 
-func FindAbsorptionCosts(root *Node, perfModel *proto.PerformanceModel, fileId int, invariantId int) ([]float64, *Histogram) {
+func FindAbsorptionCosts(root *Node, perfModel *proto.PerformanceModel, fileId int, invariantId int) ([]float64, *Histogram, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, nil, err
+	}
 	// Create the transition matrix
 	nodes, _, _, yields := getAllNodes(root, 0)
 	//fmt.Println("Yields", yields)
@@ -224,41 +207,43 @@ func FindAbsorptionCosts(root *Node, perfModel *proto.PerformanceModel, fileId i
 			initialDistribution[i] = 1.0 / float64(yields) // Set every node to 1.0/n
 		}
 	}
-	steadstate, histogram := markovChainAnalysis(nodes, perfModel, transitionMatrix, initialDistribution)
+	steadstate, histogram := markovChainAnalysis(nodes, configs, transitionMatrix, initialDistribution, newSolverOptions(perfModel))
 	//fmt.Println("liveness ", steadstate)
 	fmt.Println("liveness mean counts", histogram.GetMeanCounts())
 	fmt.Println("liveness histogram", histogram.GetAllHistogram())
-	return steadstate, histogram
+	return steadstate, histogram, nil
 }
 
-func createAbsorptionTransitionMatrix(nodes []*Node, fileId int, invariantId int) [][]float64 {
-	transitionMatrix := createTransitionMatrix(nodes)
-	//fmt.Printf("\nTransition Matrix:\n%v\n", transitionMatrix)
-
-	//printMatrix(transitionMatrix)
-	for i, matrix := range transitionMatrix {
-		if nodes[i].Process == nil {
+// createAbsorptionTransitionMatrix returns the transition matrix with every outbound link equally likely,
+// where the nodes satisfying the invariant are absorbing.
+func createAbsorptionTransitionMatrix(nodes []*Node, fileId int, invariantId int) *sparseMatrix {
+	indexMap := make(map[*Node]int)
+	for i, node := range nodes {
+		indexMap[node] = i
+	}
+	matrix := newSparseMatrix(len(nodes))
+	for i, node := range nodes {
+		if len(node.Outbound) == 0 || (node.Process != nil && node.Witness[fileId][invariantId]) {
+			matrix.appendRow([]int{i}, []float64{1.0})
 			continue
 		}
-		if nodes[i].Witness[fileId][invariantId] {
-			for j := range matrix {
-				if i == j {
-					matrix[j] = 1.0
-				} else {
-					matrix[j] = 0.0
-				}
-			}
+		cols := make([]int, 0, len(node.Outbound))
+		values := make([]float64, 0, len(node.Outbound))
+		for _, outboundLink := range node.Outbound {
+			cols = append(cols, indexMap[outboundLink.Node])
+			values = append(values, 1.0)
 		}
+		matrix.appendRow(cols, values)
 	}
-	//transitionMatrix = transpose(transitionMatrix)
-	//printMatrix(transitionMatrix)
-	//transitionMatrix = normalizeColumns(transitionMatrix)
-	transitionMatrix = normalizeRows(transitionMatrix)
-	return transitionMatrix
+	matrix.normalizeRows()
+	return matrix
 }
 
-
-func checkLivenessAndCost(root *Node, perfModel *proto.PerformanceModel, fileId int, invariantId int) ([]float64, *Histogram) {
+func checkLivenessAndCost(root *Node, perfModel *proto.PerformanceModel, fileId int, invariantId int) ([]float64, *Histogram, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, nil, err
+	}
 	// Create the transition matrix
 	nodes, _, _, yields := getAllNodes(root, 0)
 	fmt.Println("Yields", yields)
@@ -272,106 +257,11 @@ func checkLivenessAndCost(root *Node, perfModel *proto.PerformanceModel, fileId
 			initialDistribution[i] = 1.0 / float64(yields) // Set every node to 1.0/n
 		}
 	}
-	steadstate, histogram := markovChainAnalysis(nodes, perfModel, transitionMatrix, initialDistribution)
+	steadstate, histogram := markovChainAnalysis(nodes, configs, transitionMatrix, initialDistribution, newSolverOptions(perfModel))
 	//fmt.Println("liveness ", steadstate)
 	fmt.Println("liveness mean counts", histogram.GetMeanCounts())
 	fmt.Println("liveness histogram", histogram.GetAllHistogram())
-	return steadstate, histogram
-}
-
-func checkLiveness(root *Node, fileId int, invariantId int) []float64 {
-	// Create the transition matrix
-	nodes, _, _, _ := getAllNodes(root, 0)
-
-	transitionMatrix := createTransitionMatrix(nodes)
-	//fmt.Printf("\nTransition Matrix:\n%v\n", transitionMatrix)
-
-
-	//printMatrix(transitionMatrix)
-	for i, matrix := range transitionMatrix {
-		if nodes[i].Process == nil {
-			continue
-		}
-		if nodes[i].Witness[fileId][invariantId] {
-			for j := range matrix {
-				if i == j {
-					matrix[j] = 1.0
-				} else {
-					matrix[j] = 0.0
-				}
-			}
-		}
-	}
-	transitionMatrix = transpose(transitionMatrix)
-	//printMatrix(transitionMatrix)
-	transitionMatrix = normalizeColumns(transitionMatrix)
-	//printMatrix(transitionMatrix)
-
-	// Compute the matrix power (raise the matrix to a sufficiently large power)
-	iterations := 2000
-
-	initialDistribution := make([]float64, len(nodes))
-	for i, _ := range initialDistribution {
-		initialDistribution[i] = 1.0 / float64(len(nodes)) // Set every node to 1.0/n
-	}
-
-	// Iterate to find the steady-state distribution
-	currentDistribution := initialDistribution
-	//fmt.Println(currentDistribution)
-	for i := 0; i < iterations; i++ { // Max iterations to avoid infinite loop
-		nextDistribution := matrixVectorProduct(transitionMatrix, currentDistribution)
-		//fmt.Println(i, nextDistribution)
-		// Check for convergence (you may define a suitable threshold)
-		if vectorNorm(vectorDifference(nextDistribution, currentDistribution)) < 1e-7 {
-			break
-		}
-
-		currentDistribution = nextDistribution
-	}
-
-	return currentDistribution
-}
-func normalizeRows(matrix [][]float64) [][]float64 {
-
-	// Iterate over each column
-	for _, row := range matrix {
-		// Calculate the sum of values in the column
-		rowSum := 0.0
-		for _, val := range row {
-			rowSum += val
-		}
-
-		// Normalize the values in the column
-		if rowSum != 0 {
-			for columnIndex := range row {
-				row[columnIndex] /= rowSum
-			}
-		}
-	}
-
-	return matrix
-}
-func normalizeColumns(matrix [][]float64) [][]float64 {
-	// Get the number of columns
-	numColumns := len(matrix[0])
-
-	// Iterate over each column
-	for col := 0; col < numColumns; col++ {
-		// Calculate the sum of values in the column
-		columnSum := 0.0
-		for _, row := range matrix {
-			columnSum += row[col]
-		}
-
-		// Normalize the values in the column
-		if columnSum != 0 {
-			for row := range matrix {
-				matrix[row][col] /= columnSum
-			}
-		}
-	}
-
-	return matrix
+	return steadstate, histogram, nil
 }
 
 func sum(distribution []float64) float64 {
@@ -389,48 +279,6 @@ func vectorDifference(a, b []float64) []float64 {
 	return result
 }
 
-func createTransitionMatrix(nodes []*Node) [][]float64 {
-	n := len(nodes)
-	matrix := make([][]float64, n)
-	for i := range matrix {
-		matrix[i] = make([]float64, n)
-	}
-
-	indexMap := make(map[*Node]int)
-	for i, node := range nodes {
-		indexMap[node] = i
-	}
-
-	for _, node := range nodes {
-		if len(node.Outbound) == 0 {
-			matrix[indexMap[node]][indexMap[node]] = 1.0
-		}
-		for _, outboundNode := range node.Outbound {
-			matrix[indexMap[node]][indexMap[outboundNode.Node]] += 1.0 / float64(len(node.Outbound))
-		}
-
-	}
-
-	return matrix
-}
-func transpose(matrix [][]float64) [][]float64 {
-	rows := len(matrix)
-	cols := len(matrix[0])
-
-	result := make([][]float64, cols)
-	for i := range result {
-		result[i] = make([]float64, rows)
-	}
-
-	for i := 0; i < rows; i++ {
-		for j := 0; j < cols; j++ {
-			result[j][i] = matrix[i][j]
-		}
-	}
-
-	return result
-}
-
 func GetAllNodes(root *Node, maxActions int64) ([]*Node, []string, *Node, int) {
 	return getAllNodes(root, maxActions)
 
@@ -551,7 +399,9 @@ func traverseBFS(rootNode *Node, maxActions int64) ([]*Node, []string, *Node, in
 				if node == link.Node || node.HashCode() == link.Node.HashCode() {
 					continue
 				}
-				messageKey := link.Name
+				// For parameterized actions, the communication graph shows the action
+				// without the arguments, like `Send` instead of `Send(n1,n2)`.
+				messageKey, _, _ := strings.Cut(link.Name, "(")
 				if _, ok := msgSet[messageKey]; ok {
 					msgSet[messageKey]++
 				} else {
@@ -4,10 +4,13 @@ import (
 	ast "fizz/proto"
 	"fmt"
 	"github.com/fizzbee-io/fizzbee/lib"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"math"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -157,7 +160,9 @@ func TestSteadyStateDistribution(t *testing.T) {
 				require.Nil(t, err)
 			}
 
-			steadyStateDist, histogram := steadyStateDistribution(root, perfModel)
+			configs, err := newPerfConfigs(perfModel)
+			require.Nil(t, err)
+			steadyStateDist, histogram := steadyStateDistribution(root, configs, newSolverOptions(perfModel))
 			fmt.Println(steadyStateDist)
 			fmt.Println(histogram.GetMeanCounts())
 			//fmt.Println(histogram.GetAllHistogram())
@@ -171,7 +176,8 @@ func TestSteadyStateDistribution(t *testing.T) {
 				if !inv.Eventually && !slices.Contains(inv.TemporalOperators, "eventually") {
 					continue
 				}
-				_, histogram := FindAbsorptionCosts(root, perfModel, 0, k)
+				_, histogram, err := FindAbsorptionCosts(root, perfModel, 0, k)
+				require.Nil(t, err)
 				fmt.Println("Absorption Cost")
 				fmt.Println(histogram.GetMeanCounts())
 				//fmt.Println(histogram.GetAllHistogram())
@@ -192,7 +198,8 @@ func TestSteadyStateDistribution(t *testing.T) {
 					}
 					continue
 				} else {
-					liveness, _ := checkLivenessAndCost(root, perfModel, 0, k)
+					liveness, _, err := checkLivenessAndCost(root, perfModel, 0, k)
+					require.Nil(t, err)
 					//liveness := checkLiveness(root, 0, k)
 					fmt.Println(liveness)
 					fmt.Println("Liveness")
@@ -212,3 +219,558 @@ func TestSteadyStateDistribution(t *testing.T) {
 		})
 	}
 }
+
+// coinToss returns the labeled coin toss without the invariants, and the options
+// tossing the coin up to maxActions times.
+func coinToss(t *testing.T, maxActions int64) (*ast.File, *ast.StateSpaceOptions) {
+	file, err := parseAstFromString(LabeledCoinToss)
+	require.Nil(t, err)
+	file.Invariants = nil
+	crashOnYield := false
+	return file, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           maxActions,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+	}
+}
+
+// exploreCoinToss returns the root of the state space of the labeled coin toss.
+func exploreCoinToss(t *testing.T, maxActions int64) *Node {
+	file, options := coinToss(t, maxActions)
+	p1 := NewProcessor([]*ast.File{file}, options, false, 0, "")
+	root, failedNode, err := p1.Start()
+	require.Nil(t, err)
+	require.Nil(t, failedNode)
+	return root
+}
+
+func TestAnalyzePerformance(t *testing.T) {
+	root := exploreCoinToss(t, 1)
+
+	report, err := AnalyzePerformance(root, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {Probability: 0.8, Counters: map[string]*ast.Counter{"heads": {Numeric: 1}}},
+			"Toss.tail": {Probability: 0.2},
+		},
+	})
+	require.Nil(t, err)
+	assert.InDelta(t, 0.8, report.ExpectedCounters["heads"], 1e-6)
+	require.Len(t, report.SteadyState, 2)
+	assert.Equal(t, `{"heads":"1","tails":"0"}`, report.SteadyState[0].State)
+	assert.InDelta(t, 0.8, report.SteadyState[0].Probability, 1e-6)
+	assert.InDelta(t, 0.2, report.SteadyState[1].Probability, 1e-6)
+	require.NotEmpty(t, report.TerminationCurve)
+	assert.InDelta(t, 1.0, report.TerminationCurve[len(report.TerminationCurve)-1].Probability, 1e-6)
+	assert.Contains(t, report.String(), "heads: 0.800000")
+}
+
+func TestAnalyzePerformance_Tutorial(t *testing.T) {
+	dir := filepath.Join(os.Getenv("RUNFILES_DIR"), "_main", "examples/tutorials/37-unfair-coin-toss-labels")
+	file, err := readAstFromFile(filepath.Join(dir, "FairCoin.json"))
+	require.Nil(t, err)
+	stateCfg, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+	require.Nil(t, err)
+	p1 := NewProcessor([]*ast.File{file}, stateCfg, false, 0, "")
+	root, failedNode, err := p1.Start()
+	require.Nil(t, err)
+	require.Nil(t, failedNode)
+
+	tests := []struct {
+		perfModel string
+		// tosses is the expected number of the unfair tosses, two per round until they differ.
+		tosses float64
+	}{
+		{perfModel: "perf_model_unbiased.yaml", tosses: 2 / 0.5},
+		{perfModel: "perf_model_biased.yaml", tosses: 2 / (2 * 0.9 * 0.1)},
+	}
+	for _, test := range tests {
+		t.Run(test.perfModel, func(t *testing.T) {
+			perfModel := &ast.PerformanceModel{}
+			require.Nil(t, lib.ReadProtoFromFile(filepath.Join(dir, test.perfModel), perfModel))
+			require.Nil(t, ValidatePerfModel(perfModel))
+
+			report, err := AnalyzePerformance(root, perfModel)
+			require.Nil(t, err)
+			assert.Empty(t, report.Warnings)
+			assert.InDelta(t, test.tosses, report.ExpectedCounters["toss"], 1e-6)
+			assert.InDelta(t, 0.5*test.tosses, report.ExpectedCounters["latency"], 1e-6)
+			// The fair toss returns the head and the tail equally, regardless of the bias.
+			require.Len(t, report.SteadyState, 2)
+			assert.InDelta(t, 0.5, report.SteadyState[0].Probability, 1e-6)
+			assert.InDelta(t, 0.5, report.SteadyState[1].Probability, 1e-6)
+		})
+	}
+}
+
+func TestMarkovChainSolvers(t *testing.T) {
+	// 0 -> 1 with 0.5, and stays at 0 otherwise. 1 -> 2 or 3, and back to 1 is a periodic bottom component.
+	matrix := newSparseMatrix(4)
+	matrix.appendRow([]int{0, 1}, []float64{0.5, 0.5})
+	matrix.appendRow([]int{2, 3}, []float64{0.5, 0.5})
+	matrix.appendRow([]int{1}, []float64{1.0})
+	matrix.appendRow([]int{1}, []float64{1.0})
+	component, bottom := matrix.bottomComponents()
+	assert.False(t, bottom[component[0]])
+	assert.True(t, bottom[component[1]])
+	assert.Equal(t, component[1], component[2])
+	assert.Equal(t, component[1], component[3])
+
+	transposed := matrix.transpose()
+	assert.Equal(t, 0.5, transposed.get(1, 0))
+	for _, solver := range []string{SolverGaussSeidel, SolverJacobi} {
+		t.Run(solver, func(t *testing.T) {
+			options := newSolverOptions(&ast.PerformanceModel{Solver: solver})
+			visits := options.expectedVisits(transposed, []bool{true, false, false, false}, []float64{1, 0, 0, 0})
+			assert.InDelta(t, 2.0, visits[0], 1e-6)
+			stationary := options.stationaryDistribution(transposed, []int{1, 2, 3}, component)
+			assert.InDelta(t, 0.5, stationary[0], 1e-6)
+			assert.InDelta(t, 0.25, stationary[1], 1e-6)
+			assert.InDelta(t, 0.25, stationary[2], 1e-6)
+		})
+	}
+
+	// Stopped after an iteration, the solves are reported as not converged.
+	options := newSolverOptions(&ast.PerformanceModel{MaxIterations: 1})
+	options.expectedVisits(transposed, []bool{true, false, false, false}, []float64{1, 0, 0, 0})
+	options.stationaryDistribution(transposed, []int{1, 2, 3}, component)
+	assert.Equal(t, []string{
+		"the expected visits did not converge in 1 iterations of gauss_seidel, increase max_iterations or tolerance",
+		"the stationary distribution did not converge in 1 iterations of gauss_seidel, increase max_iterations or tolerance",
+	}, options.warnings())
+	assert.NotNil(t, ValidatePerfModel(&ast.PerformanceModel{Solver: "gauss-seidel"}))
+
+	// An unknown solver falls back to Gauss-Seidel with a warning.
+	options = newSolverOptions(&ast.PerformanceModel{Solver: "gauss-seidel"})
+	assert.Equal(t, SolverGaussSeidel, options.method)
+	assert.Equal(t, []string{
+		"unknown solver gauss-seidel, using gauss_seidel",
+	}, options.warnings())
+}
+
+func TestAnalyzeAbsorption(t *testing.T) {
+	root := exploreCoinToss(t, 1)
+
+	report, err := AnalyzeAbsorption(root, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {Probability: 0.8, Counters: map[string]*ast.Counter{"heads": {Numeric: 1}}},
+			"Toss.tail": {Probability: 0.2},
+		},
+	})
+	require.Nil(t, err)
+	assert.InDelta(t, 0.8, report.ExpectedCounters["heads"], 1e-12)
+	require.Len(t, report.Classes, 2)
+	// Given the run ends with a head, the head was counted.
+	assert.Equal(t, []string{`{"heads":"1","tails":"0"}`}, report.Classes[0].States)
+	assert.InDelta(t, 0.8, report.Classes[0].Probability, 1e-12)
+	assert.InDelta(t, 1.0, report.Classes[0].ExpectedCounters["heads"], 1e-12)
+	assert.Equal(t, []string{`{"heads":"0","tails":"1"}`}, report.Classes[1].States)
+	assert.InDelta(t, 0.2, report.Classes[1].Probability, 1e-12)
+	assert.InDelta(t, 0.0, report.Classes[1].ExpectedCounters["heads"], 1e-12)
+}
+
+func TestEvaluatePerfQueries(t *testing.T) {
+	root := exploreCoinToss(t, 3)
+
+	tests := []struct {
+		query       string
+		probability float64
+	}{
+		{query: "P=? [F<=1 tails > 0]", probability: 0.2},
+		{query: "P=? [F<=2 tails > 0]", probability: 1 - 0.8*0.8},
+		{query: "P=? [F tails > 0]", probability: 1 - 0.8*0.8*0.8},
+		{query: "P=? [G<=2 `tails == 0`]", probability: 0.8 * 0.8},
+		{query: "P=? [G heads + tails < 3]", probability: 0},
+		{query: "S=? [heads == 3]", probability: 0.8 * 0.8 * 0.8},
+	}
+	queries := make([]*PerfQuery, 0, len(tests))
+	for _, test := range tests {
+		q, err := ParsePerfQuery(test.query)
+		require.Nil(t, err)
+		queries = append(queries, q)
+	}
+	perfModel := &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {Probability: 0.8},
+			"Toss.tail": {Probability: 0.2},
+		},
+	}
+	results, err := EvaluatePerfQueries(root, perfModel, queries)
+	require.Nil(t, err)
+	require.Len(t, results, len(tests))
+	for i, test := range tests {
+		assert.Equal(t, test.query, results[i].Query)
+		assert.InDelta(t, test.probability, results[i].Probability, 1e-9, test.query)
+	}
+
+	_, err = ParsePerfQuery("P=? [X tails > 0]")
+	assert.NotNil(t, err)
+	_, err = ParsePerfQuery("R=? [F tails > 0]")
+	assert.NotNil(t, err)
+
+	// A predicate failing to evaluate, like with an undefined name, returns the error.
+	undefined, err := ParsePerfQuery("P=? [F coins > 0]")
+	require.Nil(t, err)
+	_, err = EvaluatePerfQueries(root, perfModel, []*PerfQuery{undefined})
+	assert.ErrorContains(t, err, "coins")
+	perfModel.Queries = []string{undefined.Query}
+	_, err = AnalyzePerformance(root, perfModel)
+	assert.ErrorContains(t, err, "coins")
+}
+
+func TestAnalyzeLatency(t *testing.T) {
+	root := exploreCoinToss(t, 1)
+
+	report, err := AnalyzeLatency(root, &ast.PerformanceModel{})
+	require.Nil(t, err)
+	assert.Nil(t, report)
+
+	t.Run("latency", func(t *testing.T) {
+		report, err := AnalyzeLatency(root, &ast.PerformanceModel{
+			Configs: map[string]*ast.TransitionConfig{
+				"Toss.head": {
+					Probability: 0.5,
+					Latency:     &ast.Distribution{Distribution: &ast.Distribution_Fixed{Fixed: 2}},
+				},
+				"Toss.tail": {
+					Probability: 0.5,
+					Latency: &ast.Distribution{Distribution: &ast.Distribution_Uniform{
+						Uniform: &ast.UniformDistribution{Min: 3, Max: 5},
+					}},
+				},
+			},
+		})
+		require.Nil(t, err)
+		require.NotNil(t, report)
+		assert.InDelta(t, 3.0, report.ExpectedTime, 1e-9)
+		require.Len(t, report.Percentiles, len(reportedPercentiles))
+		assert.InDelta(t, 2.0, report.Percentiles[0].Time, report.TimeStep)
+		// The p90 is the 80th percentile of the tails, uniform between 3 and 5.
+		assert.InDelta(t, 4.6, report.Percentiles[1].Time, 2*report.TimeStep)
+	})
+
+	t.Run("rates", func(t *testing.T) {
+		report, err := AnalyzeLatency(root, &ast.PerformanceModel{
+			Configs: map[string]*ast.TransitionConfig{
+				"Toss.head": {Rate: 3},
+				"Toss.tail": {Rate: 1},
+			},
+		})
+		require.Nil(t, err)
+		require.NotNil(t, report)
+		// The time at the toss is exponential with the total rate 4.
+		assert.InDelta(t, 0.25, report.ExpectedTime, 1e-9)
+		assert.InDelta(t, math.Log(2)/4, report.Percentiles[0].Time, 2*report.TimeStep)
+		assert.InDelta(t, math.Log(10)/4, report.Percentiles[1].Time, 2*report.TimeStep)
+
+		absorption, err := AnalyzeAbsorption(root, &ast.PerformanceModel{
+			Configs: map[string]*ast.TransitionConfig{
+				"Toss.head": {Rate: 3},
+				"Toss.tail": {Rate: 1},
+			},
+		})
+		require.Nil(t, err)
+		assert.InDelta(t, 0.75, absorption.Classes[0].Probability, 1e-9)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, d := range []*ast.Distribution{
+			{Distribution: &ast.Distribution_Fixed{Fixed: -1}},
+			{Distribution: &ast.Distribution_Exponential{Exponential: -2}},
+			{Distribution: &ast.Distribution_Exponential{Exponential: 0}},
+			{Distribution: &ast.Distribution_Uniform{Uniform: &ast.UniformDistribution{Min: 5, Max: 3}}},
+			{Distribution: &ast.Distribution_Uniform{Uniform: &ast.UniformDistribution{Min: -1, Max: 3}}},
+			{Distribution: &ast.Distribution_Empirical{Empirical: &ast.EmpiricalDistribution{
+				Buckets: []*ast.EmpiricalBucket{{Value: 1, Weight: -1}},
+			}}},
+		} {
+			assert.NotNil(t, ValidatePerfModel(&ast.PerformanceModel{
+				Configs: map[string]*ast.TransitionConfig{"Toss.head": {Latency: d}},
+			}), d.String())
+		}
+		assert.NotNil(t, ValidatePerfModel(&ast.PerformanceModel{
+			Configs: map[string]*ast.TransitionConfig{"Toss.head": {Rate: -1}},
+		}))
+
+		// The tail of a long latency with a small time step is cut at maxTimeSteps.
+		pmf := discretize(&ast.Distribution{Distribution: &ast.Distribution_Exponential{Exponential: 1e9}}, 1, 1e-6)
+		assert.Len(t, pmf, maxTimeSteps+1)
+		assert.InDelta(t, 1.0, sum(pmf), 1e-9)
+		assert.Len(t, discretize(&ast.Distribution{Distribution: &ast.Distribution_Fixed{Fixed: 1e12}}, 1, 1e-6), maxTimeSteps+1)
+	})
+}
+
+func TestPerfEstimator(t *testing.T) {
+	file, options := coinToss(t, 1)
+	perfModel := &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {
+				Probability: 0.8,
+				Counters:    map[string]*ast.Counter{"toss": {Numeric: 1}, "heads": {Numeric: 1}},
+				Latency:     &ast.Distribution{Distribution: &ast.Distribution_Fixed{Fixed: 2}},
+			},
+			"Toss.tail": {
+				Probability: 0.2,
+				Counters:    map[string]*ast.Counter{"toss": {Numeric: 1}},
+				Latency:     &ast.Distribution{Distribution: &ast.Distribution_Fixed{Fixed: 7}},
+			},
+		},
+	}
+	e := NewPerfEstimator([]*ast.File{file}, options, "", perfModel, 1, 0.02, 10000)
+	report, err := e.Estimate()
+	require.Nil(t, err)
+	assert.GreaterOrEqual(t, report.Runs, minEstimationRuns)
+
+	heads := report.Estimates["heads"]
+	require.NotNil(t, heads)
+	assert.InDelta(t, 0.8, heads.Mean, heads.ConfidenceInterval*2)
+	assert.LessOrEqual(t, heads.ConfidenceInterval, 0.02*heads.Mean)
+	assert.InDelta(t, 0.16, heads.Variance, 0.02)
+	// Every run tosses once, so the estimate is exact.
+	assert.Equal(t, 1.0, report.ExpectedCounters["toss"])
+	assert.Equal(t, 0.0, report.Estimates["toss"].ConfidenceInterval)
+
+	require.NotNil(t, report.Latency)
+	require.NotNil(t, report.Latency.Estimate)
+	assert.InDelta(t, 3.0, report.Latency.ExpectedTime, report.Latency.Estimate.ConfidenceInterval*2)
+	assert.Equal(t, 2.0, report.Latency.Percentiles[0].Time)
+	assert.Equal(t, 7.0, report.Latency.Percentiles[2].Time)
+
+	require.Len(t, report.AbsorbingClasses, 2)
+	assert.InDelta(t, 0.8, report.AbsorbingClasses[0].Probability, 0.05)
+	assert.Equal(t, 1.0, report.AbsorbingClasses[0].ExpectedCounters["heads"])
+	assert.Equal(t, 0.0, report.AbsorbingClasses[1].ExpectedCounters["heads"])
+}
+
+func TestCounterDistributions(t *testing.T) {
+	root := exploreCoinToss(t, 1)
+
+	report, err := AnalyzePerformance(root, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {Probability: 0.8, Counters: map[string]*ast.Counter{"heads": {Numeric: 1}}},
+			"Toss.tail": {Probability: 0.2},
+		},
+	})
+	require.Nil(t, err)
+	require.Len(t, report.Distributions, 1)
+	heads := report.Distributions[0]
+	assert.Equal(t, "heads", heads.Counter)
+	assert.InDelta(t, 0.8, heads.Mean, 1e-6)
+	assert.InDelta(t, 0.16, heads.Variance, 1e-6)
+	assert.InDelta(t, 0.4, heads.StdDev, 1e-6)
+	require.Len(t, heads.CDF, 2)
+	assert.Equal(t, 0.0, heads.CDF[0].Value)
+	assert.InDelta(t, 0.2, heads.CDF[0].Probability, 1e-9)
+	assert.Equal(t, 1.0, heads.CDF[1].Value)
+	assert.InDelta(t, 1.0, heads.CDF[1].Probability, 1e-9)
+	require.Len(t, heads.Percentiles, len(reportedPercentiles))
+	assert.Equal(t, 1.0, heads.Percentiles[0].Value)
+
+	var b strings.Builder
+	require.Nil(t, WriteDistributionsCSV(&b, report.Distributions))
+	assert.Equal(t, "counter,value,probability\nheads,0,0.2\nheads,1,1\n", b.String())
+
+	t.Run("geometric", func(t *testing.T) {
+		// Each toss is counted, and stops with the probability 1/2.
+		matrix := newSparseMatrix(2)
+		matrix.appendRow([]int{0, 1}, []float64{0.5, 0.5})
+		matrix.appendRow([]int{1}, []float64{1.0})
+		counter := newSparseMatrix(2)
+		counter.appendRow([]int{0, 1}, []float64{1, 1})
+		counter.appendRow([]int{}, []float64{})
+		options := newSolverOptions(&ast.PerformanceModel{})
+		component, bottom := matrix.bottomComponents()
+		probabilities := counterProbabilities(matrix, counter, component, bottom, options)
+		assert.InDelta(t, 0.5, probabilities[1], 1e-12)
+		assert.InDelta(t, 0.25, probabilities[2], 1e-12)
+
+		rewards := map[string][]float64{"toss": matrix.rowProducts(counter)}
+		visits := options.expectedVisits(matrix.transpose(), []bool{true, false}, []float64{1, 0})
+		variances := counterVariances(matrix, map[string]*sparseMatrix{"toss": counter}, rewards, visits, map[string]float64{"toss": 2}, options)
+		assert.InDelta(t, 2.0, variances["toss"], 1e-6)
+	})
+}
+
+func TestComparePerformance(t *testing.T) {
+	root := exploreCoinToss(t, 1)
+
+	_, err := ParsePerfSweep("Toss.head=0.9:0.1:0.1", "")
+	assert.NotNil(t, err)
+	sweep, err := ParsePerfSweep("Toss.head=0.1:0.9:0.4", "Toss.tail")
+	require.Nil(t, err)
+	base := &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {Counters: map[string]*ast.Counter{"heads": {Numeric: 1}}},
+		},
+	}
+	models, names := sweep.Models(base)
+	assert.Equal(t, []string{"Toss.head=0.1", "Toss.head=0.5", "Toss.head=0.9"}, names)
+	assert.InDelta(t, 0.1, models[2].Configs["Toss.tail"].Probability, 1e-12)
+	// The base model is not modified.
+	assert.Equal(t, 0.0, base.Configs["Toss.head"].Probability)
+
+	comparison, err := ComparePerformance(root, models, names)
+	require.Nil(t, err)
+	require.Len(t, comparison.Rows, 3)
+	assert.Equal(t, []string{"heads"}, comparison.Counters)
+	assert.Len(t, comparison.Classes, 2)
+	for i, head := range []float64{0.1, 0.5, 0.9} {
+		assert.InDelta(t, head, comparison.Rows[i].ExpectedCounters["heads"], 1e-9)
+		assert.InDelta(t, head, comparison.Rows[i].Termination[`{"heads":"1","tails":"0"}`], 1e-9)
+	}
+
+	var b strings.Builder
+	require.Nil(t, comparison.WriteCSV(&b))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "model,heads,"))
+	assert.True(t, strings.HasPrefix(lines[2], "Toss.head=0.5,0.500000,"))
+	assert.Contains(t, comparison.String(), "Toss.head=0.9")
+}
+
+func TestTransitionConfig(t *testing.T) {
+	exact := &ast.TransitionConfig{Probability: 0.1}
+	roleType := &ast.TransitionConfig{Probability: 0.2}
+	glob := &ast.TransitionConfig{Probability: 0.3}
+	longGlob := &ast.TransitionConfig{Probability: 0.4}
+	regex := &ast.TransitionConfig{Probability: 0.5}
+	model := &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Participant#0.Prepare.call": exact,
+			"Participant#.Prepare.call":  roleType,
+			"Participant#*":              glob,
+			"Participant#*.Commit.*":     longGlob,
+			`/Coordinator#\d+\..*/`:      regex,
+		},
+	}
+	require.Nil(t, ValidatePerfModel(model))
+	configs, err := newPerfConfigs(model)
+	require.Nil(t, err)
+	assert.Same(t, exact, configs.transitionConfig("Participant#0.Prepare.call"))
+	assert.Same(t, roleType, configs.transitionConfig("Participant#1.Prepare.call"))
+	assert.Same(t, longGlob, configs.transitionConfig("Participant#1.Commit.call"))
+	assert.Same(t, glob, configs.transitionConfig("Participant#1.Abort.call"))
+	assert.Same(t, regex, configs.transitionConfig("Coordinator#0.Prepare.call"))
+	assert.Nil(t, configs.transitionConfig("Coordinator.Prepare.call"))
+	configs, err = newPerfConfigs(nil)
+	require.Nil(t, err)
+	assert.Nil(t, configs.transitionConfig("Toss.head"))
+
+	assert.NotNil(t, ValidatePerfModel(&ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{"/Toss.(/": {}},
+	}))
+
+	root := exploreCoinToss(t, 1)
+	report, err := AnalyzePerformance(root, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.h*":    {Probability: 0.8, Counters: map[string]*ast.Counter{"heads": {Numeric: 1}}},
+			"/Toss.t.*/": {Probability: 0.2},
+			"Toss.edge":  {Probability: 0.5},
+		},
+	})
+	require.Nil(t, err)
+	assert.InDelta(t, 0.8, report.ExpectedCounters["heads"], 1e-9)
+	assert.Equal(t, []string{"the perf model config Toss.edge matches no transition"}, report.Warnings)
+
+	// The exported analyses return the invalid glob or regex instead of panicking.
+	for _, key := range []string{"/Toss.(/", "Toss.["} {
+		invalid := &ast.PerformanceModel{Configs: map[string]*ast.TransitionConfig{key: {}}}
+		_, err = AnalyzeAbsorption(root, invalid)
+		assert.NotNil(t, err, key)
+		_, err = AnalyzeLatency(root, invalid)
+		assert.NotNil(t, err, key)
+		_, err = UnmatchedPerfConfigs(root, invalid)
+		assert.NotNil(t, err, key)
+		_, err = ComparePerformance(root, []*ast.PerformanceModel{invalid}, []string{"invalid"})
+		assert.NotNil(t, err, key)
+	}
+}
+
+func TestAnalyzeAvailability(t *testing.T) {
+	root := exploreCoinToss(t, 1)
+
+	perfModel := &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Toss.head": {Probability: 0.8},
+			"Toss.tail": {Probability: 0.2},
+		},
+		StatePredicates: map[string]string{
+			"headed": "heads > 0",
+			"tossed": "heads + tails == 1",
+		},
+	}
+	availability, err := AnalyzeAvailability(root, perfModel)
+	require.Nil(t, err)
+	require.Len(t, availability, 2)
+	headed := availability[0]
+	assert.Equal(t, "headed", headed.Name)
+	assert.InDelta(t, 0.8, headed.Fraction, 1e-6)
+	// The chain is reducible, it ends in either terminal state.
+	require.Len(t, headed.Components, 2)
+	assert.Equal(t, []string{`{"heads":"1","tails":"0"}`}, headed.Components[0].States)
+	assert.InDelta(t, 0.8, headed.Components[0].Probability, 1e-6)
+	assert.InDelta(t, 1.0, headed.Components[0].Fraction, 1e-6)
+	assert.InDelta(t, 0.2, headed.Components[1].Probability, 1e-6)
+	assert.InDelta(t, 0.0, headed.Components[1].Fraction, 1e-6)
+	assert.InDelta(t, 1.0, availability[1].Fraction, 1e-6)
+
+	report, err := AnalyzePerformance(root, perfModel)
+	require.Nil(t, err)
+	assert.Contains(t, report.String(), "headed (heads > 0): 0.800000")
+	assert.NotNil(t, ValidatePerfModel(&ast.PerformanceModel{StatePredicates: map[string]string{"empty": " "}}))
+
+	invalid := &ast.PerformanceModel{StatePredicates: map[string]string{"elected": "leader > 0"}}
+	_, err = AnalyzeAvailability(root, invalid)
+	assert.NotNil(t, err)
+	_, err = AnalyzePerformance(root, invalid)
+	assert.NotNil(t, err)
+	_, err = ComparePerformance(root, []*ast.PerformanceModel{perfModel, invalid}, []string{"valid", "invalid"})
+	assert.NotNil(t, err)
+}
+
+func TestAnalyzeAvailability_Recurrent(t *testing.T) {
+	file, err := parseAstFromString(LeaderElection)
+	require.Nil(t, err)
+	crashOnYield := false
+	p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           10,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+	}, false, 0, "")
+	root, failedNode, err := p1.Start()
+	require.Nil(t, err)
+	require.Nil(t, failedNode)
+
+	// The leader crashes after 10 terms on average, then the election takes a single action.
+	availability, err := AnalyzeAvailability(root, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{
+			"Elect.n1":     {Probability: 0.5},
+			"Elect.n2":     {Probability: 0.5},
+			"Lead.crash":   {Probability: 0.1},
+			"Lead.handoff": {Probability: 0.9},
+		},
+		StatePredicates: map[string]string{
+			"elected": "leader != 0",
+			"first":   "leader == 1",
+		},
+	})
+	require.Nil(t, err)
+	require.Len(t, availability, 2)
+	elected := availability[0]
+	assert.Equal(t, "elected", elected.Name)
+	assert.InDelta(t, 10.0/11, elected.Fraction, 1e-6)
+	// The chain is irreducible, all the states are in a single recurrent component.
+	require.Len(t, elected.Components, 1)
+	assert.Equal(t, []string{`{"leader":"0"}`, `{"leader":"1"}`, `{"leader":"2"}`}, elected.Components[0].States)
+	assert.InDelta(t, 1.0, elected.Components[0].Probability, 1e-6)
+	assert.InDelta(t, 10.0/11, elected.Components[0].Fraction, 1e-6)
+	assert.InDelta(t, 5.0/11, availability[1].Fraction, 1e-6)
+
+	_, err = AnalyzeAvailability(root, &ast.PerformanceModel{
+		StatePredicates: map[string]string{"elected": "leader !="},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,231 @@
+package modelchecker
+
+import (
+	"slices"
+	"strings"
+)
+
+// traceSegment is a step in the failure path that can be dropped or moved as a unit.
+// It is either the start of an action, the continuation of a thread after a yield,
+// or an injected fault, along with the forks for the non-determinism that follow it.
+type traceSegment struct {
+	links []*Link
+	// thread is the id of the thread started or continued by the segment,
+	// and 0 for the injected faults.
+	thread int
+}
+
+func (s *traceSegment) isContinuation() bool {
+	return strings.HasPrefix(s.links[0].Name, "thread-")
+}
+
+func (s *traceSegment) isInjectedFault() bool {
+	return isInjectedFaultLink(s.links[0])
+}
+
+func isInjectedFaultLink(link *Link) bool {
+	return link.Type == CrashActionName || link.Type == ChannelFaultLinkType || link.Type == TickActionName
+}
+
+// traceSegments splits the failure path into segments. The first segment is the
+// init node along with its forks, and is never dropped or moved.
+func traceSegments(path []*Link) []*traceSegment {
+	segments := []*traceSegment{{links: []*Link{path[0]}}}
+	for _, link := range path[1:] {
+		last := segments[len(segments)-1]
+		if link.Type != "action" && !isInjectedFaultLink(link) && !strings.HasPrefix(link.Name, "thread-") {
+			// A fork for the non-determinism within the step
+			last.links = append(last.links, link)
+			continue
+		}
+		segments = append(segments, &traceSegment{links: []*Link{link}, thread: link.ReqId})
+	}
+	return segments
+}
+
+// contextSwitches returns the number of times a thread continues after another thread ran.
+func contextSwitches(segments []*traceSegment) int {
+	switches := 0
+	for i := 1; i < len(segments); i++ {
+		if segments[i].isContinuation() && segments[i].thread != segments[i-1].thread {
+			switches++
+		}
+	}
+	return switches
+}
+
+// traceLength returns the number of steps in the trace.
+func traceLength(segments []*traceSegment) int {
+	n := 0
+	for _, segment := range segments {
+		n += len(segment.links)
+	}
+	return n
+}
+
+// MinimizeFailurePath tries to find a shorter or a more readable path to a node failing
+// the same invariant as the failed node. It repeatedly drops the actions along with their
+// continuations and the injected faults, and moves the continuations of a thread next
+// to its previous step to reduce the interleaving. Each candidate is re-executed, and kept
+// only if the invariant still fails. Returns nil if the path could not be improved.
+func (p *Processor) MinimizeFailurePath(failedNode *Node, invariantIndex int) []*Link {
+	if !slices.Contains(failedNode.FailedInvariants[0], invariantIndex) {
+		return nil
+	}
+	m := &traceMinimizer{processor: p, invariant: invariantIndex}
+	original := traceSegments(pathToInit([]*Node{p.Init}, failedNode))
+	best := original
+	bestNode := m.replay(best)
+	if bestNode == nil {
+		// The path could not be reproduced.
+		return nil
+	}
+	// The replay can fail the invariant earlier than the original path.
+	best = traceSegments(pathToInit([]*Node{bestNode.root()}, bestNode))
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(best) - 1; i >= 1 && !changed; i-- {
+			if best[i].isContinuation() {
+				continue
+			}
+			candidate := make([]*traceSegment, 0, len(best))
+			for j, segment := range best {
+				if j == i || (j > i && !best[i].isInjectedFault() && segment.thread == best[i].thread) {
+					continue
+				}
+				candidate = append(candidate, segment)
+			}
+			if node := m.replay(candidate); node != nil {
+				best, bestNode, changed = traceSegments(pathToInit([]*Node{node.root()}, node)), node, true
+			}
+		}
+		for i := 2; i < len(best) && !changed; i++ {
+			if !best[i].isContinuation() || best[i].thread == best[i-1].thread {
+				continue
+			}
+			prev := -1
+			for j := i - 1; j >= 1; j-- {
+				if best[j].thread == best[i].thread {
+					prev = j
+					break
+				}
+			}
+			if prev < 0 {
+				continue
+			}
+			candidate := slices.Clone(best)
+			candidate = slices.Delete(candidate, i, i+1)
+			candidate = slices.Insert(candidate, prev+1, best[i])
+			node := m.replay(candidate)
+			if node == nil {
+				continue
+			}
+			replayed := traceSegments(pathToInit([]*Node{node.root()}, node))
+			if traceLength(replayed) < traceLength(best) ||
+				(traceLength(replayed) == traceLength(best) && contextSwitches(replayed) < contextSwitches(best)) {
+				best, bestNode, changed = replayed, node, true
+			}
+		}
+	}
+	if traceLength(best) == traceLength(original) && contextSwitches(best) == contextSwitches(original) {
+		return nil
+	}
+	return pathToInit([]*Node{bestNode.root()}, bestNode)
+}
+
+// traceMinimizer re-executes the candidate paths with a fresh processor.
+type traceMinimizer struct {
+	processor *Processor
+	invariant int
+}
+
+// replay re-executes the segments, and returns the node failing the invariant.
+// Returns nil if a step cannot be taken, or the invariant does not fail.
+func (m *traceMinimizer) replay(segments []*traceSegment) *Node {
+	p := m.processor
+	q := NewProcessor(p.Files, p.config, false, p.Seed, p.dirPath)
+	_, failedNode, err := q.InitializeNode()
+	if err != nil {
+		return nil
+	}
+	if failedNode != nil {
+		return m.failed(failedNode)
+	}
+	// threads maps the thread ids in the original path to the thread ids in the replay.
+	threads := make(map[int]int)
+	node := q.Init
+	for i, segment := range segments {
+		for j, link := range segment.links {
+			if i == 0 && j == 0 {
+				// The init node
+				continue
+			}
+			q.visited = make(map[string]*Node)
+			if invariantFailure, _ := q.processNode(node); invariantFailure {
+				return m.failed(node)
+			}
+			node = q.nextReplayNode(link, j == 0 && !segment.isContinuation(), threads)
+			if node == nil {
+				return nil
+			}
+		}
+	}
+	q.visited = make(map[string]*Node)
+	if invariantFailure, _ := q.processNode(node); invariantFailure {
+		return m.failed(node)
+	}
+	return nil
+}
+
+func (m *traceMinimizer) failed(node *Node) *Node {
+	if slices.Contains(node.FailedInvariants[0], m.invariant) {
+		return node
+	}
+	return nil
+}
+
+// nextReplayNode returns the child node matching the link in the original path,
+// among the nodes scheduled by the last step.
+func (p *Processor) nextReplayNode(link *Link, starts bool, threads map[int]int) *Node {
+	children := make([]*Node, 0, p.intermediate_states.Len()+p.queue.Len())
+	for p.intermediate_states.Len() > 0 {
+		child, _ := p.intermediate_states.Remove()
+		children = append(children, child)
+	}
+	for p.queue.Len() > 0 {
+		child, _ := p.queue.Remove()
+		children = append(children, child)
+	}
+	for _, child := range children {
+		inbound := child.Inbound[0]
+		if strings.HasPrefix(link.Name, "thread-") {
+			if replayed, ok := threads[link.ReqId]; ok {
+				if !strings.HasPrefix(inbound.Name, "thread-") || inbound.ReqId != replayed {
+					continue
+				}
+			} else if inbound.Name != link.Name {
+				// The thread started before the path, like the Init action.
+				continue
+			}
+			return child
+		}
+		if inbound.Name != link.Name {
+			continue
+		}
+		if starts {
+			threads[link.ReqId] = inbound.ReqId
+		}
+		return child
+	}
+	return nil
+}
+
+// root returns the init node the node was reached from.
+func (n *Node) root() *Node {
+	root := n
+	for len(root.Inbound) > 0 {
+		root = root.Inbound[0].Node
+	}
+	return root
+}
@@ -1,72 +1,105 @@
 package modelchecker
 
-import proto "fizz/proto"
-
-func genTransitionMatrix(nodes []*Node, model *proto.PerformanceModel) [][]float64 {
-    n := len(nodes)
-    matrix := make([][]float64, n)
-    for i := range matrix {
-        matrix[i] = make([]float64, n)
-    }
-
+// genTransitionMatrix returns the transition probabilities between the nodes, from the
+// probabilities of the labels of the links. The links without a probability share the rest.
+func genTransitionMatrix(nodes []*Node, configs *perfConfigs) *sparseMatrix {
     indexMap := make(map[*Node]int)
     for i, node := range nodes {
         indexMap[node] = i
     }
 
-    for _, node := range nodes {
+    matrix := newSparseMatrix(len(nodes))
+    for i, node := range nodes {
         if len(node.Outbound) == 0 {
-            matrix[indexMap[node]][indexMap[node]] = 1.0
+            matrix.appendRow([]int{i}, []float64{1.0})
+            continue
         }
-        totalProb := 0.0
-        missingCount := 0
-        linkProbabilities := make(map[*Link]float64)
-        for _, outboundLink := range node.Outbound {
-            if len(outboundLink.Labels) == 0 {
-                missingCount++
+        cols := make([]int, 0, len(node.Outbound))
+        values := make([]float64, 0, len(node.Outbound))
+        for k, prob := range linkProbabilities(node, configs) {
+            if prob == 0 {
                 continue
             }
-            linkProb := 0.0
-            for _, label := range outboundLink.Labels {
-                linkProb += model.Configs[label].GetProbability()
-            }
-            totalProb += linkProb
-            linkProbabilities[outboundLink] = linkProb
+            cols = append(cols, indexMap[node.Outbound[k].Node])
+            values = append(values, prob)
         }
-        if totalProb > 1.0 {
-            panic("Total probability for a node cannot exceed 1")
+        matrix.appendRow(cols, values)
+    }
+
+    return matrix
+}
+
+// linkProbabilities returns the probability of taking each outbound link of the node.
+func linkProbabilities(node *Node, configs *perfConfigs) []float64 {
+    probabilities := make([]float64, len(node.Outbound))
+    if totalRate := nodeRate(node, configs); totalRate > 0 {
+        // A CTMC state, the transitions race with their rates.
+        for k, outboundLink := range node.Outbound {
+            probabilities[k] = linkRate(outboundLink, configs) / totalRate
         }
-        if totalProb == 0 {
-            missingCount = len(node.Outbound)
+        return probabilities
+    }
+    totalProb := 0.0
+    missingCount := 0
+    labeled := make([]bool, len(node.Outbound))
+    for k, outboundLink := range node.Outbound {
+        if len(outboundLink.Labels) == 0 {
+            missingCount++
+            continue
         }
-        missingProb := 0.0
-        if missingCount > 0 {
-            missingProb = (1.0 - totalProb) / float64(missingCount)
+        linkProb := 0.0
+        for _, label := range outboundLink.Labels {
+            linkProb += configs.transitionConfig(label).GetProbability()
         }
-        for _, outboundLink := range node.Outbound {
-            prob,found := linkProbabilities[outboundLink]
-            if found && totalProb > 0 {
-                matrix[indexMap[node]][indexMap[outboundLink.Node]] += prob
-            } else {
-                matrix[indexMap[node]][indexMap[outboundLink.Node]] += missingProb
-            }
+        totalProb += linkProb
+        probabilities[k] = linkProb
+        labeled[k] = true
+    }
+    if totalProb > 1.0 {
+        panic("Total probability for a node cannot exceed 1")
+    }
+    if totalProb == 0 {
+        missingCount = len(node.Outbound)
+    }
+    missingProb := 0.0
+    if missingCount > 0 {
+        missingProb = (1.0 - totalProb) / float64(missingCount)
+    }
+    for k := range node.Outbound {
+        if !labeled[k] || totalProb == 0 {
+            probabilities[k] = missingProb
         }
-
     }
+    return probabilities
+}
 
-    return matrix
+// linkRate returns the rate of the link, from the rates of its labels.
+func linkRate(link *Link, configs *perfConfigs) float64 {
+    rate := 0.0
+    for _, label := range link.Labels {
+        rate += configs.transitionConfig(label).GetRate()
+    }
+    return rate
 }
 
-func genCounterMatrices(nodes []*Node, model *proto.PerformanceModel) map[string][][]float64 {
-    matrices := make(map[string][][]float64)
-    if model == nil {
-        return matrices
+// nodeRate returns the total rate of the outbound links of the node. It is 0 if the
+// node is not a CTMC state, and otherwise the time spent at the node is exponentially
+// distributed with the mean 1/rate.
+func nodeRate(node *Node, configs *perfConfigs) float64 {
+    total := 0.0
+    for _, link := range node.Outbound {
+        total += linkRate(link, configs)
     }
-    for _, config := range model.Configs {
+    return total
+}
+
+// genCounterMatrices returns the counter increments of the transitions between the nodes,
+// from the counters of the labels of the links.
+func genCounterMatrices(nodes []*Node, configs *perfConfigs) map[string]*sparseMatrix {
+    matrices := make(map[string]*sparseMatrix)
+    for _, config := range configs.model.Configs {
         for name, _ := range config.Counters {
-            if matrices[name] == nil {
-                matrices[name] = create2DMatrix(len(nodes))
-            }
+            matrices[name] = newSparseMatrix(len(nodes))
         }
     }
 
@@ -76,34 +109,24 @@ func genCounterMatrices(nodes []*Node, model *proto.PerformanceModel) map[string
     }
 
     for _, node := range nodes {
-        if len(node.Outbound) == 0 {
-            continue
-        }
+        cols := make(map[string][]int)
+        values := make(map[string][]float64)
         for _, outboundLink := range node.Outbound {
-            if len(outboundLink.Labels) == 0 {
-                continue
-            }
             for _, label := range outboundLink.Labels {
-                config := model.Configs[label]
+                config := configs.transitionConfig(label)
                 if config == nil {
                     continue
                 }
                 for name, counter := range config.Counters {
-                    matrices[name][indexMap[node]][indexMap[outboundLink.Node]] += counter.GetNumeric()
+                    cols[name] = append(cols[name], indexMap[outboundLink.Node])
+                    values[name] = append(values[name], counter.GetNumeric())
                 }
             }
-
         }
-
+        for name, matrix := range matrices {
+            matrix.appendRow(cols[name], values[name])
+        }
     }
 
     return matrices
 }
-
-func create2DMatrix(n int) [][]float64 {
-    matrix := make([][]float64, n)
-    for i := range matrix {
-        matrix[i] = make([]float64, n)
-    }
-    return matrix
-}
\ No newline at end of file
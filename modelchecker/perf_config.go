@@ -0,0 +1,234 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The keys of the configs in the PerformanceModel match the labels of the transitions, like
+// `Toss.head`. Besides the exact labels, the keys can be:
+//
+//	Participant#.Prepare.call   the label of any instance of the role, like the action options
+//	Participant#*.Prepare.*     a glob, with * ? and [...] like path.Match
+//	/Participant#\d+\.retry/    a regular expression matching the whole label, within slashes
+//
+// A label takes the config of the exact key first, then of the role type key, then of the
+// globs, then of the regular expressions. Among the globs or the regular expressions matching
+// the label, the longest key is taken, and the first in the alphabetical order for the same length.
+
+// roleRefRegex matches the instance refs of the roles in the labels, like the #0 in `Participant#0.Prepare.call`.
+var roleRefRegex = regexp.MustCompile(`#\d+\.`)
+
+// perfConfigs resolves the labels to the configs of a PerformanceModel. It is built once
+// per analysis or simulation, and passed down to everything looking up the configs.
+type perfConfigs struct {
+	model    *proto.PerformanceModel
+	globs    []string
+	regexes  []string
+	compiled map[string]*regexp.Regexp
+
+	lock     sync.Mutex
+	resolved map[string]*proto.TransitionConfig
+}
+
+func isRegexKey(key string) bool {
+	return len(key) > 2 && strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/")
+}
+
+func isGlobKey(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// newPerfConfigs returns the configs of the PerformanceModel, or an error if a glob or
+// a regular expression in the keys is invalid. A nil model has no configs.
+func newPerfConfigs(model *proto.PerformanceModel) (*perfConfigs, error) {
+	if model == nil {
+		model = &proto.PerformanceModel{}
+	}
+	configs := &perfConfigs{
+		model:    model,
+		compiled: make(map[string]*regexp.Regexp),
+		resolved: make(map[string]*proto.TransitionConfig),
+	}
+	for key := range model.GetConfigs() {
+		switch {
+		case isRegexKey(key):
+			compiled, err := regexp.Compile("^(?:" + key[1:len(key)-1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression in the perf model config %s: %w", key, err)
+			}
+			configs.compiled[key] = compiled
+			configs.regexes = append(configs.regexes, key)
+		case isGlobKey(key):
+			if _, err := path.Match(key, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob in the perf model config %s: %w", key, err)
+			}
+			configs.globs = append(configs.globs, key)
+		}
+	}
+	// The longest, that is the most specific, pattern first.
+	byLength := func(keys []string) {
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) > len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+	}
+	byLength(configs.globs)
+	byLength(configs.regexes)
+	return configs, nil
+}
+
+// ValidatePerfModel returns an error if the solver is unknown, a glob or a regular expression
+// in the keys is invalid, a rate or a latency is negative, or a state predicate is empty.
+func ValidatePerfModel(model *proto.PerformanceModel) error {
+	switch model.GetSolver() {
+	case "", SolverGaussSeidel, SolverJacobi:
+	default:
+		return fmt.Errorf("unknown solver %s, expected %s or %s", model.GetSolver(), SolverGaussSeidel, SolverJacobi)
+	}
+	for key, config := range model.GetConfigs() {
+		if config.GetRate() < 0 {
+			return fmt.Errorf("the perf model config %s has a negative rate %g", key, config.GetRate())
+		}
+		if err := validateDistribution(config.GetLatency()); err != nil {
+			return fmt.Errorf("the latency of the perf model config %s %w", key, err)
+		}
+	}
+	for name, predicate := range model.GetStatePredicates() {
+		if strings.TrimSpace(predicate) == "" {
+			return fmt.Errorf("the state predicate %s has no expression", name)
+		}
+	}
+	_, err := newPerfConfigs(model)
+	return err
+}
+
+// validateDistribution returns an error if the distribution can take negative values.
+func validateDistribution(d *proto.Distribution) error {
+	switch d := d.GetDistribution().(type) {
+	case *proto.Distribution_Fixed:
+		if d.Fixed < 0 {
+			return fmt.Errorf("is negative: fixed %g", d.Fixed)
+		}
+	case *proto.Distribution_Exponential:
+		if d.Exponential <= 0 {
+			return fmt.Errorf("has a mean %g, expected a positive exponential mean", d.Exponential)
+		}
+	case *proto.Distribution_Uniform:
+		if d.Uniform.GetMin() < 0 || d.Uniform.GetMin() > d.Uniform.GetMax() {
+			return fmt.Errorf("is invalid: uniform min %g, max %g, expected 0 <= min <= max",
+				d.Uniform.GetMin(), d.Uniform.GetMax())
+		}
+	case *proto.Distribution_Empirical:
+		for _, bucket := range d.Empirical.GetBuckets() {
+			if bucket.GetValue() < 0 || bucket.GetWeight() < 0 {
+				return fmt.Errorf("has a negative empirical bucket: value %g, weight %g",
+					bucket.GetValue(), bucket.GetWeight())
+			}
+		}
+	}
+	return nil
+}
+
+// transitionConfig returns the config of the label, or nil if no key matches the label.
+func (c *perfConfigs) transitionConfig(label string) *proto.TransitionConfig {
+	if len(c.model.Configs) == 0 {
+		return nil
+	}
+	if config, ok := c.model.Configs[label]; ok {
+		return config
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if config, ok := c.resolved[label]; ok {
+		return config
+	}
+	key := c.match(label)
+	var config *proto.TransitionConfig
+	if key != "" {
+		config = c.model.Configs[key]
+	}
+	c.resolved[label] = config
+	return config
+}
+
+// match returns the key matching the label, by the precedence of the keys, or "" if none.
+func (c *perfConfigs) match(label string) string {
+	if _, ok := c.model.Configs[label]; ok {
+		return label
+	}
+	if roleType := roleRefRegex.ReplaceAllString(label, "#."); roleType != label {
+		if _, ok := c.model.Configs[roleType]; ok {
+			return roleType
+		}
+	}
+	for _, key := range c.globs {
+		if matched, _ := path.Match(key, label); matched {
+			return key
+		}
+	}
+	for _, key := range c.regexes {
+		if c.compiled[key].MatchString(label) {
+			return key
+		}
+	}
+	return ""
+}
+
+// UnmatchedPerfConfigs returns the keys of the configs matching no label of the transitions
+// explored from the root, like a misspelled label. The keys are sorted.
+func UnmatchedPerfConfigs(root *Node, model *proto.PerformanceModel) ([]string, error) {
+	configs, err := newPerfConfigs(model)
+	if err != nil {
+		return nil, err
+	}
+	return configs.unmatched(root), nil
+}
+
+func (c *perfConfigs) unmatched(root *Node) []string {
+	model := c.model
+	unmatched := make([]string, 0)
+	if len(model.Configs) == 0 {
+		return unmatched
+	}
+	used := make(map[string]bool)
+	nodes, _, _, _ := getAllNodes(root, 0)
+	for _, node := range nodes {
+		for _, link := range node.Outbound {
+			for _, label := range link.Labels {
+				// Every key matching the label is used, even if a key with a higher precedence is taken.
+				if _, ok := model.Configs[label]; ok {
+					used[label] = true
+				}
+				roleType := roleRefRegex.ReplaceAllString(label, "#.")
+				if _, ok := model.Configs[roleType]; ok {
+					used[roleType] = true
+				}
+				for _, key := range c.globs {
+					if matched, _ := path.Match(key, label); matched {
+						used[key] = true
+					}
+				}
+				for _, key := range c.regexes {
+					if c.compiled[key].MatchString(label) {
+						used[key] = true
+					}
+				}
+			}
+		}
+	}
+	for key := range model.Configs {
+		if !used[key] {
+			unmatched = append(unmatched, key)
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched
+}
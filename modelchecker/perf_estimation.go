@@ -0,0 +1,311 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// confidenceZ is the z-score of the 95% confidence intervals of the estimates.
+	confidenceZ = 1.96
+	// minEstimationRuns is the number of runs before the confidence intervals are checked.
+	minEstimationRuns = 100
+	// defaultEstimationRuns is the max number of runs, if not set.
+	defaultEstimationRuns = 100000
+	// maxRevisitSteps is the max number of steps of a walk revisiting the states.
+	maxRevisitSteps = 100000
+)
+
+// PerfEstimate is the statistical estimate of a metric from the simulation runs.
+type PerfEstimate struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	// ConfidenceInterval is the half width of the 95% confidence interval of the mean.
+	ConfidenceInterval float64              `json:"confidenceInterval"`
+	Percentiles        []EstimatePercentile `json:"percentiles"`
+}
+
+type EstimatePercentile struct {
+	Percentile float64 `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+// PerfEstimator estimates the performance metrics with random walks following the probabilities
+// in the PerformanceModel, for the state spaces too large for the Markov chain analysis.
+// The runs stop when the confidence intervals of all the metrics are within the precision,
+// relative to the mean, or at the max runs.
+type PerfEstimator struct {
+	files     []*proto.File
+	options   *proto.StateSpaceOptions
+	dirPath   string
+	perfModel *proto.PerformanceModel
+	seed      int64
+	precision float64
+	maxRuns   int
+	stopped   atomic.Bool
+}
+
+func NewPerfEstimator(files []*proto.File, options *proto.StateSpaceOptions, dirPath string, perfModel *proto.PerformanceModel, seed int64, precision float64, maxRuns int) *PerfEstimator {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if maxRuns <= 0 {
+		maxRuns = defaultEstimationRuns
+	}
+	return &PerfEstimator{
+		files:     files,
+		options:   options,
+		dirPath:   dirPath,
+		perfModel: perfModel,
+		seed:      seed,
+		precision: precision,
+		maxRuns:   maxRuns,
+	}
+}
+
+// Stop stops the estimation after the current run.
+func (e *PerfEstimator) Stop() {
+	e.stopped.Store(true)
+}
+
+// sampleStats accumulates the samples of a metric, with the running mean and variance.
+type sampleStats struct {
+	values []float64
+	mean   float64
+	m2     float64
+}
+
+func (s *sampleStats) add(value float64) {
+	s.values = append(s.values, value)
+	delta := value - s.mean
+	s.mean += delta / float64(len(s.values))
+	s.m2 += delta * (value - s.mean)
+}
+
+func (s *sampleStats) variance() float64 {
+	if len(s.values) < 2 {
+		return 0
+	}
+	return s.m2 / float64(len(s.values)-1)
+}
+
+func (s *sampleStats) confidenceInterval() float64 {
+	if len(s.values) == 0 {
+		return 0
+	}
+	return confidenceZ * math.Sqrt(s.variance()/float64(len(s.values)))
+}
+
+func (s *sampleStats) estimate() *PerfEstimate {
+	sorted := append([]float64{}, s.values...)
+	sort.Float64s(sorted)
+	estimate := &PerfEstimate{
+		Mean:               s.mean,
+		Variance:           s.variance(),
+		ConfidenceInterval: s.confidenceInterval(),
+		Percentiles:        make([]EstimatePercentile, 0, len(reportedPercentiles)),
+	}
+	for _, percentile := range reportedPercentiles {
+		if len(sorted) == 0 {
+			break
+		}
+		// The nearest rank.
+		rank := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+		estimate.Percentiles = append(estimate.Percentiles, EstimatePercentile{
+			Percentile: percentile,
+			Value:      sorted[max(rank, 0)],
+		})
+	}
+	return estimate
+}
+
+// distribution returns the empirical distribution of the samples.
+func (s *sampleStats) distribution(counter string) *CounterDistribution {
+	probabilities := make(map[float64]float64)
+	for _, value := range s.values {
+		probabilities[value] += 1 / float64(len(s.values))
+	}
+	return newCounterDistribution(counter, s.mean, s.variance(), probabilities)
+}
+
+// precise returns true if the confidence interval is within the precision, relative to the mean.
+func (s *sampleStats) precise(precision float64) bool {
+	return s.confidenceInterval() <= precision*math.Abs(s.mean)
+}
+
+// Estimate runs the random walks, and returns the estimates in the format of the Markov chain
+// analysis: the means are the expected counters, and the absorbing classes are the final states.
+func (e *PerfEstimator) Estimate() (*PerfReport, error) {
+	guide, err := NewSimulationGuide(SimulationWeighted, e.perfModel)
+	if err != nil {
+		return nil, err
+	}
+	configs := guide.configs
+	counters := make(map[string]*sampleStats)
+	for _, config := range e.perfModel.GetConfigs() {
+		for name := range config.GetCounters() {
+			counters[name] = &sampleStats{}
+		}
+	}
+	timed := hasTimeModel(e.perfModel)
+	elapsed := &sampleStats{}
+	type finalState struct {
+		runs     int
+		counters map[string]float64
+	}
+	finalStates := make(map[string]*finalState)
+
+	runs, truncated := 0, 0
+	for runs < e.maxRuns && !e.stopped.Load() {
+		runSeed := e.seed + int64(runs)
+		p := NewProcessor(e.files, e.options, true, runSeed, e.dirPath)
+		p.SetSimulationGuide(guide)
+		// Unlike the simulation, the walk continues around the loops, like the Markov chain.
+		p.revisit = true
+		_, _, err := p.Start()
+		if err != nil {
+			return nil, err
+		}
+		runs++
+		if p.Stopped() {
+			truncated++
+		}
+
+		// The times are sampled from the stream of the run, continuing after the walk, so
+		// they are independent of the random choices made along the path.
+		random := &p.random
+		path := p.WalkPath()
+		values := make(map[string]float64, len(counters))
+		duration := 0.0
+		for k := 1; k < len(path); k++ {
+			source := path[k-1].Node
+			if rate := nodeRate(source, configs); rate > 0 {
+				duration += random.ExpFloat64() / rate
+			}
+			for _, label := range path[k].Labels {
+				config := configs.transitionConfig(label)
+				for name, counter := range config.GetCounters() {
+					values[name] += counter.GetNumeric()
+				}
+				duration += sampleDistribution(random, config.GetLatency())
+			}
+		}
+		for name, stats := range counters {
+			stats.add(values[name])
+		}
+		elapsed.add(duration)
+
+		state := "<none>"
+		for k := len(path) - 1; k >= 0; k-- {
+			if path[k].Node.Process != nil {
+				state = perfStateName(path[k].Node)
+				break
+			}
+		}
+		final := finalStates[state]
+		if final == nil {
+			final = &finalState{counters: make(map[string]float64)}
+			finalStates[state] = final
+		}
+		final.runs++
+		for name, value := range values {
+			final.counters[name] += value
+		}
+
+		if runs >= minEstimationRuns && (!timed || elapsed.precise(e.precision)) {
+			precise := true
+			for _, stats := range counters {
+				precise = precise && stats.precise(e.precision)
+			}
+			if precise {
+				break
+			}
+		}
+	}
+
+	report := &PerfReport{
+		ExpectedCounters: make(map[string]float64),
+		AbsorbingClasses: make([]*AbsorbingClass, 0),
+		TerminationCurve: make([]TerminationPoint, 0),
+		Distributions:    make([]*CounterDistribution, 0, len(counters)),
+		SteadyState:      make([]StateProbability, 0),
+		Queries:          make([]*QueryResult, 0),
+		Runs:             runs,
+		TruncatedRuns:    truncated,
+		Estimates:        make(map[string]*PerfEstimate),
+	}
+	for name, stats := range counters {
+		report.ExpectedCounters[name] = stats.mean
+		report.Estimates[name] = stats.estimate()
+		report.Distributions = append(report.Distributions, stats.distribution(name))
+	}
+	sort.Slice(report.Distributions, func(i, j int) bool {
+		return report.Distributions[i].Counter < report.Distributions[j].Counter
+	})
+	if timed {
+		estimate := elapsed.estimate()
+		report.Latency = &LatencyReport{
+			ExpectedTime: estimate.Mean,
+			Percentiles:  make([]LatencyPercentile, 0, len(estimate.Percentiles)),
+			Estimate:     estimate,
+		}
+		for _, percentile := range estimate.Percentiles {
+			report.Latency.Percentiles = append(report.Latency.Percentiles, LatencyPercentile{
+				Percentile: percentile.Percentile,
+				Time:       percentile.Value,
+			})
+		}
+	}
+	for state, final := range finalStates {
+		class := &AbsorbingClass{
+			States:           []string{state},
+			Probability:      float64(final.runs) / float64(runs),
+			ExpectedCounters: make(map[string]float64),
+		}
+		for name := range counters {
+			class.ExpectedCounters[name] = final.counters[name] / float64(final.runs)
+		}
+		report.AbsorbingClasses = append(report.AbsorbingClasses, class)
+	}
+	sort.Slice(report.AbsorbingClasses, func(i, j int) bool {
+		if report.AbsorbingClasses[i].Probability != report.AbsorbingClasses[j].Probability {
+			return report.AbsorbingClasses[i].Probability > report.AbsorbingClasses[j].Probability
+		}
+		return lessStrings(report.AbsorbingClasses[i].States, report.AbsorbingClasses[j].States)
+	})
+	return report, nil
+}
+
+// sampleDistribution returns a random value of the distribution, 0 for nil.
+func sampleDistribution(random *rand.Rand, d *proto.Distribution) float64 {
+	switch {
+	case d == nil:
+		return 0
+	case d.GetUniform() != nil:
+		return d.GetUniform().GetMin() + random.Float64()*(d.GetUniform().GetMax()-d.GetUniform().GetMin())
+	case d.GetEmpirical() != nil:
+		buckets := d.GetEmpirical().GetBuckets()
+		weights := make([]float64, len(buckets))
+		for i, bucket := range buckets {
+			weights[i] = bucket.GetWeight()
+		}
+		if len(buckets) == 0 {
+			return 0
+		}
+		return buckets[pickWeighted(random, weights)].GetValue()
+	case d.GetExponential() != 0:
+		return random.ExpFloat64() * d.GetExponential()
+	default:
+		return d.GetFixed()
+	}
+}
+
+// estimateString formats the estimate in a line of the text report.
+func estimateString(estimate *PerfEstimate) string {
+	return fmt.Sprintf("%.6f ± %.6f (variance %.6f)", estimate.Mean, estimate.ConfidenceInterval, estimate.Variance)
+}
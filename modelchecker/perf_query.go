@@ -0,0 +1,305 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PerfQuery is a PCTL-style probabilistic query over the explored state space:
+//
+//	P=? [F pred]       the probability of eventually reaching a state satisfying pred
+//	P=? [F<=k pred]    the probability of reaching a state satisfying pred within k steps
+//	P=? [G pred]       the probability of pred holding forever
+//	P=? [G<=k pred]    the probability of pred holding for the first k steps
+//	S=? [pred]         the long run probability of being in a state satisfying pred
+//
+// The predicates are python expressions over the state variables, evaluated at the yield
+// points, and a step is an action, that is, the transition from a yield point to the next.
+type PerfQuery struct {
+	Query string
+	// kind is P or S.
+	kind string
+	// operator is F or G for the P queries.
+	operator string
+	// bound is the max number of steps, or -1 if unbounded.
+	bound     int
+	predicate string
+}
+
+// QueryResult is the probability computed for a query.
+type QueryResult struct {
+	Query       string  `json:"query"`
+	Probability float64 `json:"probability"`
+}
+
+var (
+	perfQueryRegex = regexp.MustCompile(`^\s*([PS])\s*=\s*\?\s*\[\s*(.*?)\s*\]\s*$`)
+	pathRegex      = regexp.MustCompile(`^([FG])(\s*<=\s*(\d+))?\s+(.+)$`)
+)
+
+func ParsePerfQuery(query string) (*PerfQuery, error) {
+	match := perfQueryRegex.FindStringSubmatch(query)
+	if match == nil {
+		return nil, fmt.Errorf("invalid query %q, expected P=? [F pred], P=? [F<=k pred], P=? [G pred], P=? [G<=k pred] or S=? [pred]", query)
+	}
+	q := &PerfQuery{Query: strings.TrimSpace(query), kind: match[1], bound: -1}
+	if q.kind == "S" {
+		q.predicate = match[2]
+	} else {
+		path := pathRegex.FindStringSubmatch(match[2])
+		if path == nil {
+			return nil, fmt.Errorf("invalid query %q, expected F or G with an optional <=k bound before the predicate", query)
+		}
+		q.operator = path[1]
+		if path[3] != "" {
+			bound, err := strconv.Atoi(path[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid bound in query %q: %w", query, err)
+			}
+			q.bound = bound
+		}
+		q.predicate = path[4]
+	}
+	// Like the LTL properties, the predicate can be within backquotes.
+	q.predicate = strings.TrimSpace(strings.Trim(q.predicate, "`"))
+	if q.predicate == "" {
+		return nil, fmt.Errorf("invalid query %q, missing the predicate", query)
+	}
+	return q, nil
+}
+
+// yieldChain is the Markov chain between the yield points, where each transition is an action.
+// The steps within the actions are collapsed into the probability of reaching each yield point.
+type yieldChain struct {
+	nodes  []*Node
+	matrix *sparseMatrix
+	// init is the index of the init node.
+	init int
+}
+
+// isChainState returns true if the node is a state of the yield chain. The nodes without a
+// successor are states too, so the probability within an action is never stuck.
+func isChainState(node *Node) bool {
+	return len(node.Outbound) == 0 || (node.Process != nil && isYieldPoint(node))
+}
+
+func newYieldChain(root *Node, configs *perfConfigs, options *solverOptions) *yieldChain {
+	nodes, _, _, _ := getAllNodes(root, 0)
+	transitionMatrix := genTransitionMatrix(nodes, configs)
+	index := make([]int, len(nodes))
+	chain := &yieldChain{}
+	for i, node := range nodes {
+		index[i] = -1
+		if isChainState(node) {
+			index[i] = len(chain.nodes)
+			chain.nodes = append(chain.nodes, node)
+		}
+	}
+	chain.init = max(index[0], 0)
+	chain.matrix = newSparseMatrix(len(chain.nodes))
+	for i := range nodes {
+		if index[i] < 0 {
+			continue
+		}
+		// The probability within the action is moved forward until it reaches a yield point.
+		// With a loop within the action, the probability left below the tolerance is dropped.
+		cols := make([]int, 0)
+		values := make([]float64, 0)
+		frontier := map[int]float64{i: 1.0}
+		for iteration := 0; len(frontier) > 0 && iteration < options.maxIterations; iteration++ {
+			next := make(map[int]float64)
+			remaining := 0.0
+			for from, probability := range frontier {
+				rowCols, rowValues := transitionMatrix.row(from)
+				for k, to := range rowCols {
+					if index[to] >= 0 {
+						cols = append(cols, index[to])
+						values = append(values, probability*rowValues[k])
+					} else {
+						next[to] += probability * rowValues[k]
+						remaining += probability * rowValues[k]
+					}
+				}
+			}
+			frontier = next
+			if remaining < options.tolerance {
+				break
+			}
+		}
+		chain.matrix.appendRow(cols, values)
+	}
+	chain.matrix.normalizeRows()
+	return chain
+}
+
+// satisfying evaluates the predicate at each state of the chain.
+func (c *yieldChain) satisfying(predicate string) ([]bool, error) {
+	result := make([]bool, len(c.nodes))
+	for i, node := range c.nodes {
+		if node.Process == nil {
+			continue
+		}
+		ref := make(map[string]*lib.Role)
+		vars := CloneDict(node.Process.Heap.state, ref, nil, 0)
+		vars["__returns__"] = NewDictFromStringDict(node.Process.Returns)
+		cond, err := node.Process.Evaluator.EvalPyExpr(node.Process.Files[0].GetSourceInfo().GetFileName(), predicate, vars)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %q: %w", predicate, err)
+		}
+		result[i] = bool(cond.Truth())
+	}
+	return result, nil
+}
+
+// boundedReachability returns the probability of reaching a goal state within the steps from each state.
+func (c *yieldChain) boundedReachability(goal []bool, steps int) []float64 {
+	probabilities := make([]float64, len(goal))
+	for i := range goal {
+		if goal[i] {
+			probabilities[i] = 1.0
+		}
+	}
+	for step := 0; step < steps; step++ {
+		next := make([]float64, len(goal))
+		for i := range goal {
+			if goal[i] {
+				next[i] = 1.0
+				continue
+			}
+			cols, values := c.matrix.row(i)
+			for k, j := range cols {
+				next[i] += values[k] * probabilities[j]
+			}
+		}
+		probabilities = next
+	}
+	return probabilities
+}
+
+// reachability returns the probability of eventually reaching a goal state from each state,
+// from the linear system of the states that can reach the goal without being goal states.
+func (c *yieldChain) reachability(goal []bool) []float64 {
+	n := len(goal)
+	// The states that can reach the goal, by the backward search from the goal states.
+	transposed := c.matrix.transpose()
+	canReach := make([]bool, n)
+	stack := make([]int, 0)
+	for i := range goal {
+		if goal[i] {
+			canReach[i] = true
+			stack = append(stack, i)
+		}
+	}
+	for len(stack) > 0 {
+		j := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		cols, values := transposed.row(j)
+		for k, i := range cols {
+			if values[k] > 0 && !canReach[i] {
+				canReach[i] = true
+				stack = append(stack, i)
+			}
+		}
+	}
+	unknown := make([]int, 0)
+	unknownIndex := make([]int, n)
+	for i := range goal {
+		unknownIndex[i] = -1
+		if canReach[i] && !goal[i] {
+			unknownIndex[i] = len(unknown)
+			unknown = append(unknown, i)
+		}
+	}
+	rows := make([]map[int]float64, len(unknown))
+	step := make([]float64, len(unknown))
+	for u, i := range unknown {
+		rows[u] = map[int]float64{u: 1.0}
+		cols, values := c.matrix.row(i)
+		for k, j := range cols {
+			if goal[j] {
+				step[u] += values[k]
+			} else if unknownIndex[j] >= 0 {
+				rows[u][unknownIndex[j]] -= values[k]
+			}
+		}
+	}
+	solution := newSparseLU(rows).solve(step)
+	probabilities := make([]float64, n)
+	for i := range goal {
+		if goal[i] {
+			probabilities[i] = 1.0
+		} else if unknownIndex[i] >= 0 {
+			probabilities[i] = solution[unknownIndex[i]]
+		}
+	}
+	return probabilities
+}
+
+// evaluate returns the probability of the query from the init state.
+func (c *yieldChain) evaluate(q *PerfQuery, options *solverOptions) (float64, error) {
+	holds, err := c.satisfying(q.predicate)
+	if err != nil {
+		return 0, err
+	}
+	switch q.kind {
+	case "S":
+		init := make([]float64, len(c.nodes))
+		init[c.init] = 1.0
+		distribution, _ := options.longRunDistribution(c.matrix, init)
+		probability := 0.0
+		for i, p := range distribution {
+			if holds[i] {
+				probability += p
+			}
+		}
+		return probability, nil
+	}
+	goal := holds
+	if q.operator == "G" {
+		// G pred holds unless a state violating pred is reached.
+		goal = make([]bool, len(holds))
+		for i := range holds {
+			goal[i] = !holds[i]
+		}
+	}
+	var probabilities []float64
+	if q.bound >= 0 {
+		probabilities = c.boundedReachability(goal, q.bound)
+	} else {
+		probabilities = c.reachability(goal)
+	}
+	if q.operator == "G" {
+		return 1 - probabilities[c.init], nil
+	}
+	return probabilities[c.init], nil
+}
+
+// EvaluatePerfQueries evaluates the queries with the transition probabilities in the PerformanceModel.
+// It returns an error if a predicate cannot be evaluated.
+func EvaluatePerfQueries(root *Node, perfModel *proto.PerformanceModel, queries []*PerfQuery) ([]*QueryResult, error) {
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	return evaluatePerfQueries(root, configs, queries, newSolverOptions(perfModel))
+}
+
+func evaluatePerfQueries(root *Node, configs *perfConfigs, queries []*PerfQuery, options *solverOptions) ([]*QueryResult, error) {
+	results := make([]*QueryResult, 0, len(queries))
+	if len(queries) == 0 {
+		return results, nil
+	}
+	chain := newYieldChain(root, configs, options)
+	for _, q := range queries {
+		probability, err := chain.evaluate(q, options)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", q.Query, err)
+		}
+		results = append(results, &QueryResult{Query: q.Query, Probability: probability})
+	}
+	return results, nil
+}
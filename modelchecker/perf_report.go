@@ -0,0 +1,276 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// minStateProbability is the steady state probability below which the states are not reported.
+	minStateProbability = 1e-6
+	// maxPrintedStates is the number of the most probable states printed in the text report.
+	maxPrintedStates = 30
+	// maxComponentStates is the number of states printed for a strongly connected component.
+	maxComponentStates = 3
+)
+
+// printedQuantiles are the termination probabilities printed in the text report.
+var printedQuantiles = []float64{0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.999}
+
+// PerfReport is the result of the Markov chain analysis of the explored state space,
+// with the transition probabilities and the counters from the PerformanceModel.
+type PerfReport struct {
+	// ExpectedCounters are the expected value of each counter until termination.
+	ExpectedCounters map[string]float64 `json:"expectedCounters"`
+	// AbsorbingClasses are the probabilities of terminating in each absorbing class,
+	// and the expected counters of the runs terminating in the class.
+	AbsorbingClasses []*AbsorbingClass `json:"absorbingClasses"`
+	// TerminationCurve is the probability of having terminated when the counters
+	// reach the values, in the increasing order of the probability.
+	TerminationCurve []TerminationPoint `json:"terminationCurve"`
+	// Distributions are the distributions of each counter until termination, by the counter name.
+	Distributions []*CounterDistribution `json:"distributions"`
+	// Latency is the time to completion, if the PerformanceModel has latencies or rates.
+	Latency *LatencyReport `json:"latency,omitempty"`
+	// Availability are the long run fractions of the state predicates in the PerformanceModel.
+	Availability []*Availability `json:"availability,omitempty"`
+	// Queries are the results of the queries in the PerformanceModel.
+	Queries []*QueryResult `json:"queries"`
+	// SteadyState are the states with their probability in the steady state distribution,
+	// from the most probable. The states are named by perfStateName.
+	SteadyState []StateProbability `json:"steadyState"`
+	// Runs is the number of simulation runs of the Monte-Carlo estimation, 0 for the exact analysis.
+	Runs int `json:"runs,omitempty"`
+	// Estimates are the statistics of each counter over the simulation runs.
+	Estimates map[string]*PerfEstimate `json:"estimates,omitempty"`
+	// TruncatedRuns are the runs stopped after too many steps, like in a loop without a way out.
+	TruncatedRuns int `json:"truncatedRuns,omitempty"`
+	// Warnings are the problems in the PerformanceModel, like the configs matching no transition,
+	// or the solves not converging in max_iterations.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type TerminationPoint struct {
+	Probability float64            `json:"probability"`
+	Counters    map[string]float64 `json:"counters"`
+}
+
+type StateProbability struct {
+	State       string  `json:"state"`
+	Probability float64 `json:"probability"`
+}
+
+// AnalyzePerformance runs the Markov chain analysis on the state space explored from the root.
+// It returns an error if a config key or a query in the PerformanceModel is invalid, or a query
+// cannot be evaluated.
+func AnalyzePerformance(root *Node, perfModel *proto.PerformanceModel) (*PerfReport, error) {
+	if perfModel == nil {
+		perfModel = &proto.PerformanceModel{}
+	}
+	// The configs are resolved once, and shared by the analyses.
+	configs, err := newPerfConfigs(perfModel)
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]*PerfQuery, 0, len(perfModel.Queries))
+	for _, query := range perfModel.Queries {
+		q, err := ParsePerfQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	// The solver options are shared by the analyses, to report the solves that did not converge.
+	options := newSolverOptions(perfModel)
+	distribution, histogram := steadyStateDistribution(root, configs, options)
+	absorption := analyzeAbsorption(root, configs)
+	nodes, _, _, _ := getAllNodes(root, 0)
+	results, err := evaluatePerfQueries(root, configs, queries, options)
+	if err != nil {
+		return nil, err
+	}
+	availability, err := analyzeAvailability(root, configs, options)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PerfReport{
+		// The expected counters from the linear solve are exact, unlike the iterations of the histogram.
+		ExpectedCounters: absorption.ExpectedCounters,
+		AbsorbingClasses: absorption.Classes,
+		Latency:          analyzeLatency(root, configs),
+		Queries:          results,
+		Availability:     availability,
+		TerminationCurve: make([]TerminationPoint, 0, len(histogram.entries)),
+		Distributions:    analyzeCounterDistributions(root, configs, histogram),
+		Warnings:         unmatchedConfigWarnings(root, configs),
+		SteadyState:      make([]StateProbability, 0),
+	}
+	report.Warnings = append(report.Warnings, options.warnings()...)
+	for _, entry := range histogram.entries {
+		report.TerminationCurve = append(report.TerminationCurve, TerminationPoint{
+			Probability: entry.Percentile,
+			Counters:    entry.Counters,
+		})
+	}
+
+	// The nodes with the same state variables, like the same state in different threads, are merged.
+	probabilities := make(map[string]float64)
+	for i, probability := range distribution {
+		if nodes[i].Process == nil {
+			continue
+		}
+		probabilities[perfStateName(nodes[i])] += probability
+	}
+	for state, probability := range probabilities {
+		if probability >= minStateProbability {
+			report.SteadyState = append(report.SteadyState, StateProbability{State: state, Probability: probability})
+		}
+	}
+	sort.Slice(report.SteadyState, func(i, j int) bool {
+		if report.SteadyState[i].Probability != report.SteadyState[j].Probability {
+			return report.SteadyState[i].Probability > report.SteadyState[j].Probability
+		}
+		return report.SteadyState[i].State < report.SteadyState[j].State
+	})
+	return report, nil
+}
+
+func (r *PerfReport) String() string {
+	var b strings.Builder
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", warning)
+	}
+	if r.Runs > 0 {
+		fmt.Fprintf(&b, "Estimated from %d simulation runs, with the 95%% confidence intervals\n", r.Runs)
+	}
+	if r.TruncatedRuns > 0 {
+		fmt.Fprintf(&b, "Truncated runs: %d, stopped after %d steps\n", r.TruncatedRuns, maxRevisitSteps)
+	}
+	b.WriteString("Expected counters:\n")
+	for _, counter := range sortedKeys(r.ExpectedCounters) {
+		if estimate, ok := r.Estimates[counter]; ok {
+			fmt.Fprintf(&b, "  %s: %s\n", counter, estimateString(estimate))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s: %.6f\n", counter, r.ExpectedCounters[counter])
+	}
+	fmt.Fprintf(&b, "Absorbing classes: %d\n", len(r.AbsorbingClasses))
+	for i, class := range r.AbsorbingClasses {
+		if i == maxPrintedStates {
+			fmt.Fprintf(&b, "  ... %d more classes\n", len(r.AbsorbingClasses)-maxPrintedStates)
+			break
+		}
+		fmt.Fprintf(&b, "  %.6f: %s\n", class.Probability, class.name())
+		for _, counter := range sortedKeys(class.ExpectedCounters) {
+			fmt.Fprintf(&b, "    %s: %.6f\n", counter, class.ExpectedCounters[counter])
+		}
+	}
+	if len(r.TerminationCurve) > 0 {
+		// Only the quantiles are printed, the json has the whole curve.
+		b.WriteString("Termination probability:\n")
+		next := 0
+		for _, point := range r.TerminationCurve {
+			if next == len(printedQuantiles) {
+				break
+			}
+			if point.Probability < printedQuantiles[next] {
+				continue
+			}
+			for next < len(printedQuantiles) && point.Probability >= printedQuantiles[next] {
+				next++
+			}
+			counters := make([]string, 0, len(point.Counters))
+			for _, counter := range sortedKeys(point.Counters) {
+				counters = append(counters, fmt.Sprintf("%s=%.6f", counter, point.Counters[counter]))
+			}
+			fmt.Fprintf(&b, "  %.6f: %s\n", point.Probability, strings.Join(counters, ", "))
+		}
+	}
+	if len(r.Distributions) > 0 {
+		b.WriteString("Counter distributions:\n")
+		for _, distribution := range r.Distributions {
+			fmt.Fprintf(&b, "  %s: mean %.6f, stddev %.6f", distribution.Counter, distribution.Mean, distribution.StdDev)
+			for _, p := range distribution.Percentiles {
+				fmt.Fprintf(&b, ", p%g %.6f", math.Round(p.Percentile*1000)/10, p.Value)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if r.Latency != nil {
+		b.WriteString(r.Latency.String())
+	}
+	if len(r.Availability) > 0 {
+		b.WriteString("Availability:\n")
+		for _, availability := range r.Availability {
+			fmt.Fprintf(&b, "  %s (%s): %.6f\n", availability.Name, availability.Predicate, availability.Fraction)
+			if len(availability.Components) < 2 {
+				continue
+			}
+			// For a reducible chain, the fraction in each component the chain can end in.
+			for i, component := range availability.Components {
+				if i == maxPrintedStates {
+					fmt.Fprintf(&b, "    ... %d more components\n", len(availability.Components)-maxPrintedStates)
+					break
+				}
+				fmt.Fprintf(&b, "    %.6f in %s: %.6f\n", component.Probability, componentName(component.States), component.Fraction)
+			}
+		}
+	}
+	if len(r.Queries) > 0 {
+		b.WriteString("Queries:\n")
+		for _, result := range r.Queries {
+			fmt.Fprintf(&b, "  %s = %.6f\n", result.Query, result.Probability)
+		}
+	}
+	if r.Runs > 0 {
+		// The estimation has no steady state.
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Steady state: %d states\n", len(r.SteadyState))
+	for i, state := range r.SteadyState {
+		if i == maxPrintedStates {
+			fmt.Fprintf(&b, "  ... %d more states\n", len(r.SteadyState)-maxPrintedStates)
+			break
+		}
+		fmt.Fprintf(&b, "  %.6f: %s\n", state.Probability, state.State)
+	}
+	return b.String()
+}
+
+// componentName names the component by its states, or by the number of states if there are many.
+func componentName(states []string) string {
+	if len(states) > maxComponentStates {
+		return fmt.Sprintf("[%d states: %s, ...]", len(states), strings.Join(states[:maxComponentStates], ", "))
+	}
+	return "[" + strings.Join(states, ", ") + "]"
+}
+
+func unmatchedConfigWarnings(root *Node, configs *perfConfigs) []string {
+	warnings := make([]string, 0)
+	for _, key := range configs.unmatched(root) {
+		warnings = append(warnings, fmt.Sprintf("the perf model config %s matches no transition", key))
+	}
+	return warnings
+}
+
+// perfStateName names the state of the node in the reports, by the values of the state
+// variables, and the return values for the specs returning a value like a die roll.
+func perfStateName(node *Node) string {
+	if len(node.Returns) == 0 {
+		return node.Heap.String()
+	}
+	return node.Heap.String() + " / returns: " + node.Returns.String()
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
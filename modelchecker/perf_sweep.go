@@ -0,0 +1,248 @@
+package modelchecker
+
+import (
+	"encoding/csv"
+	"fizz/proto"
+	"fmt"
+	proto3 "google.golang.org/protobuf/proto"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PerfSweep varies the probability of a label over a range, like `Client.retry=0.1:0.9:0.1`.
+type PerfSweep struct {
+	Label string
+	From  float64
+	To    float64
+	Step  float64
+	// Complement is the label with the rest of the probability, like the other branch of a oneof.
+	Complement string
+}
+
+var perfSweepRegex = regexp.MustCompile(`^\s*([^=\s]+)\s*=\s*([^:\s]+)\s*:\s*([^:\s]+)\s*:\s*([^:\s]+)\s*$`)
+
+func ParsePerfSweep(spec string, complement string) (*PerfSweep, error) {
+	match := perfSweepRegex.FindStringSubmatch(spec)
+	if match == nil {
+		return nil, fmt.Errorf("invalid sweep %q, expected label=from:to:step", spec)
+	}
+	sweep := &PerfSweep{Label: match[1], Complement: complement}
+	for i, value := range []*float64{&sweep.From, &sweep.To, &sweep.Step} {
+		v, err := strconv.ParseFloat(match[i+2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sweep %q: %w", spec, err)
+		}
+		*value = v
+	}
+	if sweep.Step <= 0 || sweep.From > sweep.To || sweep.From < 0 || sweep.To > 1 {
+		return nil, fmt.Errorf("invalid sweep %q, expected 0 <= from <= to <= 1 and a positive step", spec)
+	}
+	return sweep, nil
+}
+
+// Models returns a copy of the PerformanceModel for each probability of the sweep, named by the probability.
+func (s *PerfSweep) Models(base *proto.PerformanceModel) ([]*proto.PerformanceModel, []string) {
+	if base == nil {
+		base = &proto.PerformanceModel{}
+	}
+	models := make([]*proto.PerformanceModel, 0)
+	names := make([]string, 0)
+	// The steps are counted, so the rounding of the additions does not skip the last probability.
+	steps := int(math.Floor((s.To-s.From)/s.Step + 1e-9))
+	for i := 0; i <= steps; i++ {
+		probability := math.Round((s.From+float64(i)*s.Step)*1e9) / 1e9
+		model := proto3.Clone(base).(*proto.PerformanceModel)
+		setProbability(model, s.Label, probability)
+		if s.Complement != "" {
+			setProbability(model, s.Complement, math.Round((1-probability)*1e9)/1e9)
+		}
+		models = append(models, model)
+		names = append(names, fmt.Sprintf("%s=%g", s.Label, probability))
+	}
+	return models, names
+}
+
+func setProbability(model *proto.PerformanceModel, label string, probability float64) {
+	if model.Configs == nil {
+		model.Configs = make(map[string]*proto.TransitionConfig)
+	}
+	if model.Configs[label] == nil {
+		model.Configs[label] = &proto.TransitionConfig{}
+	}
+	model.Configs[label].Probability = probability
+}
+
+// PerfComparison compares the performance analysis of the same state space with several
+// PerformanceModels, like the variants of a design or the steps of a PerfSweep.
+type PerfComparison struct {
+	Rows []*PerfComparisonRow `json:"rows"`
+	// Counters and Classes are the columns of the comparison, sorted by name.
+	Counters []string `json:"counters"`
+	Classes  []string `json:"classes"`
+	// Predicates are the names of the state predicates, sorted.
+	Predicates []string `json:"predicates"`
+	// Warnings are the problems in the PerformanceModels, like the configs matching no transition.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type PerfComparisonRow struct {
+	Name             string             `json:"name"`
+	ExpectedCounters map[string]float64 `json:"expectedCounters"`
+	// Termination is the probability of terminating in each absorbing class, by the name of the class.
+	Termination map[string]float64 `json:"termination"`
+	// ExpectedTime is the expected time to completion, if the PerformanceModel has latencies or rates.
+	ExpectedTime *float64 `json:"expectedTime,omitempty"`
+	// Availability is the long run fraction of each state predicate, by the name of the predicate.
+	Availability map[string]float64 `json:"availability,omitempty"`
+}
+
+// ComparePerformance runs the numeric analysis of the explored state space with each of the
+// PerformanceModels. The state space is explored once, only the linear systems are solved again.
+func ComparePerformance(root *Node, models []*proto.PerformanceModel, names []string) (*PerfComparison, error) {
+	comparison := &PerfComparison{Rows: make([]*PerfComparisonRow, 0, len(models))}
+	counters := make(map[string]bool)
+	classes := make(map[string]bool)
+	predicates := make(map[string]bool)
+	for i, model := range models {
+		configs, err := newPerfConfigs(model)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+		absorption := analyzeAbsorption(root, configs)
+		row := &PerfComparisonRow{
+			Name:             names[i],
+			ExpectedCounters: absorption.ExpectedCounters,
+			Termination:      make(map[string]float64),
+		}
+		for _, class := range absorption.Classes {
+			row.Termination[class.name()] += class.Probability
+			classes[class.name()] = true
+		}
+		for counter := range row.ExpectedCounters {
+			counters[counter] = true
+		}
+		if latency := analyzeLatency(root, configs); latency != nil {
+			row.ExpectedTime = &latency.ExpectedTime
+		}
+		options := newSolverOptions(model)
+		availabilities, err := analyzeAvailability(root, configs, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+		for _, availability := range availabilities {
+			if row.Availability == nil {
+				row.Availability = make(map[string]float64)
+			}
+			row.Availability[availability.Name] = availability.Fraction
+			predicates[availability.Name] = true
+		}
+		for _, warning := range append(unmatchedConfigWarnings(root, configs), options.warnings()...) {
+			comparison.Warnings = append(comparison.Warnings, names[i]+": "+warning)
+		}
+		comparison.Rows = append(comparison.Rows, row)
+	}
+	comparison.Counters = sortedSet(counters)
+	comparison.Classes = sortedSet(classes)
+	comparison.Predicates = sortedSet(predicates)
+	return comparison, nil
+}
+
+func (c *PerfComparison) hasTime() bool {
+	for _, row := range c.Rows {
+		if row.ExpectedTime != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// table returns the header and the rows of the comparison, with a column per counter, absorbing class
+// and state predicate.
+func (c *PerfComparison) table() [][]string {
+	header := []string{"model"}
+	for _, counter := range c.Counters {
+		header = append(header, counter)
+	}
+	if c.hasTime() {
+		header = append(header, "expected time")
+	}
+	for _, class := range c.Classes {
+		header = append(header, "P["+class+"]")
+	}
+	for _, predicate := range c.Predicates {
+		header = append(header, "A["+predicate+"]")
+	}
+	table := [][]string{header}
+	for _, row := range c.Rows {
+		line := []string{row.Name}
+		for _, counter := range c.Counters {
+			line = append(line, strconv.FormatFloat(row.ExpectedCounters[counter], 'f', 6, 64))
+		}
+		if c.hasTime() {
+			value := ""
+			if row.ExpectedTime != nil {
+				value = strconv.FormatFloat(*row.ExpectedTime, 'f', 6, 64)
+			}
+			line = append(line, value)
+		}
+		for _, class := range c.Classes {
+			line = append(line, strconv.FormatFloat(row.Termination[class], 'f', 6, 64))
+		}
+		for _, predicate := range c.Predicates {
+			line = append(line, strconv.FormatFloat(row.Availability[predicate], 'f', 6, 64))
+		}
+		table = append(table, line)
+	}
+	return table
+}
+
+func (c *PerfComparison) String() string {
+	table := c.table()
+	widths := make([]int, len(table[0]))
+	for _, line := range table {
+		for k, cell := range line {
+			widths[k] = max(widths[k], len(cell))
+		}
+	}
+	var b strings.Builder
+	for _, warning := range c.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", warning)
+	}
+	for _, line := range table {
+		for k, cell := range line {
+			if k > 0 {
+				b.WriteString("  ")
+			}
+			if k == len(line)-1 {
+				b.WriteString(cell)
+				continue
+			}
+			fmt.Fprintf(&b, "%-*s", widths[k], cell)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// WriteCSV writes the comparison with a row per PerformanceModel.
+func (c *PerfComparison) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.WriteAll(c.table())
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -47,6 +47,15 @@ const (
 
 var forkLock sync.Mutex
 
+const (
+	// CrashActionName is the name of the scheduler injected transition that crashes a role instance.
+	CrashActionName = "crash"
+	// RecoverActionName is the name of the optional role action executed after a crash.
+	RecoverActionName = "Recover"
+	// TickActionName is the name of the scheduler injected transition that advances the time.
+	TickActionName = "tick"
+)
+
 const enableCaptureStackTrace = false
 
 type Definition struct {
@@ -162,6 +171,14 @@ type Process struct {
 
 	Modules	 map[string]starlark.Value `json:"-"`
 	EnableCheckpoint bool 		  `json:"-"`
+
+	// Time is the number of discrete time ticks elapsed, used only when max_time is set.
+	Time        int                    `json:"time"`
+
+	// coverage records the statements executed, shared by all the forked processes.
+	coverage    *Coverage
+	// roleRefs numbers the role instances created in the run, shared by all the forked processes.
+	roleRefs    *lib.RoleRefs
 }
 
 func NewProcess(name string, files []*ast.File, parent *Process) *Process {
@@ -225,7 +242,11 @@ func NewProcess(name string, files []*ast.File, parent *Process) *Process {
 }
 
 func (p *Process) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
+	return json.Marshal(p.jsonFields())
+}
+
+func (p *Process) jsonFields() map[string]interface{} {
+	return map[string]interface{}{
 		"state":     p.Heap,
 		"threads":   p.Threads,
 		"current":   p.Current,
@@ -235,7 +256,8 @@ func (p *Process) MarshalJSON() ([]byte, error) {
 		"witness":   p.Witness,
 		"returns":   StringDictToJsonString(p.Returns),
 		"roles":     p.Roles,
-	})
+		"time":      p.Time,
+	}
 }
 
 func (p *Process) HasFailedInvariants() bool {
@@ -263,6 +285,8 @@ func (p *Process) Fork() *Process {
 	clone.SetCustomPtrFunc(reflect.TypeOf(&lib.Role{}), roleResolveCloneFn(refs, nil, 0))
 	clone.SetCustomFunc(reflect.TypeOf(starlark.Set{}), starlarkSetResolveFn(refs, nil, 0))
 	clone.SetCustomFunc(reflect.TypeOf(starlark.Dict{}), starlarkDictResolveFn(refs, nil, 0))
+	// Reset the permutations of the symmetric values, left by the last CloneForAssert.
+	clone.SetCustomFunc(reflect.TypeOf(lib.SymmetricValue{}), symmetricValueResolveFn(refs, nil, 0))
 	p2 := &Process{
 		Name:        p.Name,
 		Heap:        p.Heap.Clone(refs, nil, 0),
@@ -277,6 +301,9 @@ func (p *Process) Fork() *Process {
 		Labels:      make([]string, 0),
 		Messages: 	 make([]*ast.Message, 0),
 		Stats:       p.Stats.Clone(),
+		Time:        p.Time,
+		coverage:    p.coverage,
+		roleRefs:    p.roleRefs,
 	}
 	p2.Witness = make([][]bool, len(p.Files))
 	for i, file := range p.Files {
@@ -286,7 +313,7 @@ func (p *Process) Fork() *Process {
 	p.Children = append(p.Children, p2)
 	clonedThreads := make([]*Thread, len(p.Threads))
 	for i, thread := range p.Threads {
-		clonedThreads[i] = thread.Clone(nil, 0)
+		clonedThreads[i] = thread.Clone(refs, nil, 0)
 		clonedThreads[i].Process = p2
 	}
 	p2.Threads = clonedThreads
@@ -323,6 +350,9 @@ func (p *Process) CloneForAssert(permutations map[lib.SymmetricValue][]lib.Symme
 		Labels:      make([]string, 0),
 		Messages: 	 make([]*ast.Message, 0),
 		Stats:       p.Stats.Clone(),
+		Time:        p.Time,
+		coverage:    p.coverage,
+		roleRefs:    p.roleRefs,
 	}
 	p2.Witness = make([][]bool, len(p.Files))
 	for i, file := range p.Files {
@@ -331,7 +361,7 @@ func (p *Process) CloneForAssert(permutations map[lib.SymmetricValue][]lib.Symme
 
 	clonedThreads := make([]*Thread, len(p.Threads))
 	for i, thread := range p.Threads {
-		clonedThreads[i] = thread.Clone(permutations, alt)
+		clonedThreads[i] = thread.Clone(refs, permutations, alt)
 		clonedThreads[i].Process = p2
 	}
 	p2.Threads = clonedThreads
@@ -389,6 +419,9 @@ func (n *Node) String() string {
 
 	n.appendState(p, buf)
 	buf.WriteString("\n")
+	if len(n.DisabledActions) > 0 {
+		buf.WriteString(fmt.Sprintf("Disabled: %s\n", strings.Join(n.DisabledActions, ", ")))
+	}
 	if len(p.Threads) > 0 {
 		buf.WriteString(fmt.Sprintf("Threads: %d/%d\n", p.Current, len(p.Threads)))
 	} else {
@@ -404,7 +437,11 @@ func (n *Node) MarshalJSON() ([]byte, error) {
 }
 
 func (n *Node) GetJsonString() string {
-	bytes, err := lib.MarshalJSON(n.Process)
+	fields := n.Process.jsonFields()
+	if len(n.DisabledActions) > 0 {
+		fields["disabledActions"] = n.DisabledActions
+	}
+	bytes, err := json.Marshal(fields)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return ""
@@ -470,6 +507,9 @@ func (p *Process) HashCode() string {
 	}
 
 	h.Write([]byte(StringDictToJsonString(p.Returns)))
+	if p.Time > 0 {
+		h.Write([]byte(fmt.Sprintf("time=%d", p.Time)))
+	}
 
 	// hash the heap variables as well
 	heapHash := p.Heap.HashCode()
@@ -491,6 +531,68 @@ func (p *Process) removeCurrentThread() {
 	p.Current = 0
 }
 
+// cloneRoleFields returns a deep copy of the role's fields, resolving the
+// references to other roles in this process.
+func (p *Process) cloneRoleFields(fields *lib.Struct) *lib.Struct {
+	roleRefs := make(map[string]*lib.Role)
+	for i, r := range p.Roles {
+		roleRefs[r.RefString()] = p.Roles[i]
+	}
+	cloned, err := deepCloneStarlarkValue(fields, roleRefs)
+	PanicOnError(err)
+	return cloned.(*lib.Struct)
+}
+
+// crashRole simulates the crash of a role instance. All the threads executing
+// in the role instance are killed, including the threads of other roles calling
+// a function of the role. Every field not in durableFields is reset to the value
+// it had at the end of the Init action, and the fields first assigned after Init
+// are reset to None.
+func (p *Process) crashRole(role *lib.Role, durableFields []string) {
+	threads := make([]*Thread, 0, len(p.Threads))
+	for _, thread := range p.Threads {
+		if !thread.inRole(role) {
+			threads = append(threads, thread)
+		}
+	}
+	p.Threads = threads
+	p.Current = 0
+
+	current := starlark.StringDict{}
+	role.Fields.ToStringDict(current)
+	fields := starlark.StringDict{}
+	if role.InitFields != nil {
+		p.cloneRoleFields(role.InitFields).ToStringDict(fields)
+	}
+	for name := range current {
+		if _, ok := fields[name]; !ok {
+			fields[name] = starlark.None
+		}
+	}
+	for _, name := range durableFields {
+		if value, ok := current[name]; ok {
+			fields[name] = value
+		}
+	}
+	role.Fields = lib.FromStringDict(starlark.String("fields"), fields)
+	role.Crashed = true
+	for name := range role.Timers {
+		role.Timers[name] = lib.TimerDisarmed
+	}
+}
+
+// tick advances the time by one tick, and with it all the armed timers.
+func (p *Process) tick() {
+	p.Time++
+	for _, role := range p.Roles {
+		for name, remaining := range role.Timers {
+			if remaining > 0 {
+				role.Timers[name] = remaining - 1
+			}
+		}
+	}
+}
+
 // GetAllVariables returns all variables visible in the Current thread.
 // This includes state variables and variables from the Current thread's variables in the top call frame
 func (p *Process) GetAllVariables() starlark.StringDict {
@@ -520,7 +622,7 @@ func (p *Process) GetAllVariables() starlark.StringDict {
 	for _, file := range p.Files {
 		for _, role := range file.Roles {
 			symmetric := slices.Contains(role.Modifiers, "symmetric")
-			dict[role.Name] = lib.CreateRoleBuiltin(role.Name, symmetric, &p.Roles)
+			dict[role.Name] = lib.CreateRoleBuiltin(role.Name, symmetric, &p.Roles, p.roleRefs)
 		}
 	}
 	return dict
@@ -547,7 +649,29 @@ func (p *Process) GetAllVariablesNocopy() starlark.StringDict {
 	for _, file := range p.Files {
 		for _, role := range file.Roles {
 			symmetric := slices.Contains(role.Modifiers, "symmetric")
-			dict[role.Name] = lib.CreateRoleBuiltin(role.Name, symmetric, &p.Roles)
+			dict[role.Name] = lib.CreateRoleBuiltin(role.Name, symmetric, &p.Roles, p.roleRefs)
+		}
+	}
+	return dict
+}
+
+// getGuardVariables returns the variables visible at the start of an action, without deep copying.
+// This includes the state variables and `self` for the role actions.
+func (p *Process) getGuardVariables(self *lib.Role) starlark.StringDict {
+	dict := maps.Clone(p.Heap.globals)
+
+	maps.Copy(dict, p.Heap.state)
+	if self != nil {
+		dict["self"] = self
+	}
+	maps.Copy(dict, lib.Builtins)
+	dict["deepcopy"] = starlark.NewBuiltin("deepcopy", DeepCopyBuiltIn)
+	maps.Copy(dict, p.Modules)
+
+	for _, file := range p.Files {
+		for _, role := range file.Roles {
+			symmetric := slices.Contains(role.Modifiers, "symmetric")
+			dict[role.Name] = lib.CreateRoleBuiltin(role.Name, symmetric, &p.Roles, p.roleRefs)
 		}
 	}
 	return dict
@@ -682,6 +806,10 @@ type Node struct {
 	stacktrace string
 
 	DuplicateOf *Node
+
+	// DisabledActions are the actions not scheduled from this node, because
+	// their guards evaluated to false. These are only reported in the graph.
+	DisabledActions []string
 }
 
 type Link struct {
@@ -692,6 +820,8 @@ type Link struct {
 	Fairness ast.FairnessLevel
 	Messages []*ast.Message
 	ReqId    int
+	// FailedInvariants are the transition assertions violated by the transition, by the file index.
+	FailedInvariants map[int][]int
 }
 
 func NewNode(process *Process) *Node {
@@ -709,17 +839,7 @@ func (n *Node) Duplicate(other *Node, yield bool) {
 	if yield && !n.Enabled {
 		return
 	}
-	parent := n.Inbound[0].Node
-	other.Inbound = append(other.Inbound, n.Inbound[0])
-	parent.Outbound = append(parent.Outbound, &Link{
-		Node:     other,
-		Type: 	  n.Inbound[0].Type,
-		Name:     n.Inbound[0].Name,
-		Labels:   n.Inbound[0].Labels,
-		Fairness: n.Inbound[0].Fairness,
-		Messages: n.Inbound[0].Messages,
-		ReqId:    n.Inbound[0].ReqId,
-	})
+	n.linkTo(other)
 
 	n.Process = nil
 	n.Inbound = nil
@@ -727,6 +847,31 @@ func (n *Node) Duplicate(other *Node, yield bool) {
 	n.DuplicateOf = other
 }
 
+// linkTo adds the inbound transition of the node from its parent to the other node.
+func (n *Node) linkTo(other *Node) {
+	parent := n.Inbound[0].Node
+	other.Inbound = append(other.Inbound, n.Inbound[0])
+	parent.Outbound = append(parent.Outbound, &Link{
+		Node:             other,
+		Type:             n.Inbound[0].Type,
+		Name:             n.Inbound[0].Name,
+		Labels:           n.Inbound[0].Labels,
+		Fairness:         n.Inbound[0].Fairness,
+		Messages:         n.Inbound[0].Messages,
+		ReqId:            n.Inbound[0].ReqId,
+		FailedInvariants: n.Inbound[0].FailedInvariants,
+	})
+}
+
+// failTransitionTo links the transition violating the transition assertions to the
+// already visited node, so the successors are not explored again. The node is not
+// part of the graph, but it keeps the process and the path to report the failure.
+func (n *Node) failTransitionTo(other *Node) bool {
+	n.linkTo(other)
+	n.Process.FailedInvariants = n.Inbound[0].FailedInvariants
+	n.Name = "yield"
+	return true
+}
 
 func (n *Node) Attach() {
 	if len(n.Inbound) == 0 {
@@ -734,13 +879,14 @@ func (n *Node) Attach() {
 	}
 	parent := n.Inbound[0].Node
 	parent.Outbound = append(parent.Outbound, &Link{
-		Node:     n,
-		Type: 	  n.Inbound[0].Type,
-		Name:     n.Inbound[0].Name,
-		Labels:   n.Inbound[0].Labels,
-		Fairness: n.Inbound[0].Fairness,
-		Messages: n.Inbound[0].Messages,
-		ReqId:    n.Inbound[0].ReqId,
+		Node:             n,
+		Type:             n.Inbound[0].Type,
+		Name:             n.Inbound[0].Name,
+		Labels:           n.Inbound[0].Labels,
+		Fairness:         n.Inbound[0].Fairness,
+		Messages:         n.Inbound[0].Messages,
+		ReqId:            n.Inbound[0].ReqId,
+		FailedInvariants: n.Inbound[0].FailedInvariants,
 	})
 }
 
@@ -771,6 +917,16 @@ func (n *Node) ForkForAction(process *Process, role *lib.Role, action *ast.Actio
 	return forkNode
 }
 
+// isInjectedFault returns true if the node was created by a scheduler injected fault
+// like a role crash, a message loss or a time tick, that has no thread to execute.
+func (n *Node) isInjectedFault() bool {
+	if len(n.Inbound) == 0 {
+		return false
+	}
+	return n.Inbound[0].Type == CrashActionName || n.Inbound[0].Type == ChannelFaultLinkType ||
+		n.Inbound[0].Type == TickActionName
+}
+
 func (n *Node) ForkForAlternatePaths(process *Process, name string) *Node {
 
 	forkNode := &Node{
@@ -797,6 +953,41 @@ type Processor struct {
 	simulation          bool
 	random rand.Rand
 	Seed   int64
+
+	// failures is the first node failing each invariant. With BFS, this is the
+	// node with the shortest path.
+	failures map[InvariantPosition]*Node
+
+	// coverage records the statements, branches and actions exercised in the run.
+	coverage *Coverage
+	// roleRefs numbers the role instances, so the concurrent runs number them independently.
+	roleRefs *lib.RoleRefs
+	// lassoFailure is the lasso violating a liveness property found by the simulation or the dfs.
+	lassoFailure *LassoFailure
+	// deferred are the yield points whose actions were not scheduled because of max_actions,
+	// with the forked processes to schedule them from. Only recorded by the dfs.
+	deferred map[*Node][]*Process
+
+	// guide biases the simulation, nil for the uniformly random walks.
+	guide *SimulationGuide
+	// replay are the choices the guided simulation replays before picking on its own.
+	replay []int
+	// choices are the choices made by the guided simulation.
+	choices []int
+	// walkEnd is the last node processed by the simulation.
+	walkEnd *Node
+	// revisit makes the simulation walk through the states already visited in the walk,
+	// instead of ending it there, so the walk follows the probabilities around the loops.
+	// The walk is stopped after maxRevisitSteps steps.
+	revisit bool
+	// walkSteps is the number of nodes processed by the simulation.
+	walkSteps int
+}
+
+// InvariantFailure is the first node failing an invariant.
+type InvariantFailure struct {
+	Position *InvariantPosition
+	Node     *Node
 }
 
 func NewProcessor(files []*ast.File, options *ast.StateSpaceOptions, simulation bool, seed int64, dirPath string) *Processor {
@@ -816,7 +1007,7 @@ func NewProcessor(files []*ast.File, options *ast.StateSpaceOptions, simulation
 	}
 	lib.ClearRoleRefs()
 	return &Processor{
-		Files:   files,
+		Files:   markPredicates(files, options),
 		queue:   collection,
 		visited: make(map[string]*Node),
 		config:  proto.Clone(options).(*ast.StateSpaceOptions),
@@ -826,9 +1017,44 @@ func NewProcessor(files []*ast.File, options *ast.StateSpaceOptions, simulation
 		simulation:          simulation,
 		random:              random,
 		Seed:                seed,
+		failures:            make(map[InvariantPosition]*Node),
+		coverage:            NewCoverage(),
+		roleRefs:            lib.NewRoleRefs(),
 	}
 }
 
+// recordFailure records the node for each invariant it fails, unless
+// another node already failed the invariant.
+func (p *Processor) recordFailure(node *Node) {
+	for i, failed := range node.FailedInvariants {
+		for _, j := range failed {
+			position := InvariantPosition{FileIndex: i, InvariantIndex: j}
+			if _, ok := p.failures[position]; !ok {
+				p.failures[position] = node
+			}
+		}
+	}
+}
+
+// Failures returns the first node failing each invariant, ordered by the invariant position.
+// With continue_on_invariant_failures, this includes every invariant violated in the run.
+func (p *Processor) Failures() []*InvariantFailure {
+	failures := make([]*InvariantFailure, 0, len(p.failures))
+	for position, node := range p.failures {
+		failures = append(failures, &InvariantFailure{Position: NewInvariantPosition(position.FileIndex, position.InvariantIndex), Node: node})
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		a, b := failures[i].Position, failures[j].Position
+		return a.FileIndex < b.FileIndex || (a.FileIndex == b.FileIndex && a.InvariantIndex < b.InvariantIndex)
+	})
+	return failures
+}
+
+// Coverage returns the statements, branches and actions exercised in the run so far.
+func (p *Processor) Coverage() *Coverage {
+	return p.coverage
+}
+
 func (p *Processor) GetVisitedNodesCount() int {
 	return len(p.visited)
 }
@@ -836,6 +1062,8 @@ func (p *Processor) GetVisitedNodesCount() int {
 
 func (p *Processor) InitializeNode() (*Node, *Node, error) {
 	process := NewProcess("init", p.Files, nil)
+	process.coverage = p.coverage
+	process.roleRefs = p.roleRefs
 
 	modules := make(map[string]starlark.Value)
 	if p.dirPath != "" {
@@ -881,6 +1109,12 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 	if p.simulation {
 		return p.StartSimulation()
 	}
+	switch p.config.GetExploration() {
+	case ExplorationDfs:
+		return p.startDfs()
+	case ExplorationIterativeDeepening:
+		return p.startIterativeDeepening()
+	}
 	if p.Init != nil {
 		panic("processor already started")
 	}
@@ -889,6 +1123,9 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 	if err != nil {
 		return init, failedNode, err
 	}
+	if failedNode != nil {
+		p.recordFailure(failedNode)
+	}
 
 	p.queue.Add(p.Init)
 	prevCount := 0
@@ -925,6 +1162,9 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 		if invariantFailure && failedNode == nil {
 			failedNode = node
 		}
+		if invariantFailure {
+			p.recordFailure(node)
+		}
 		if invariantFailure && !p.config.ContinueOnInvariantFailures {
 			break
 		}
@@ -941,92 +1181,60 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 	if err != nil || failedNode != nil {
 		return init, failedNode, err
 	}
-	livenessEnabled := false
-	livenessNode := failedNode
-	if p.config.GetLiveness() == "" || p.config.GetLiveness() == "strict" {
-		for _, file := range p.Files {
-			for _, invariant := range file.Invariants {
-				if invariant.Eventually || slices.Contains(invariant.TemporalOperators, "eventually")  {
-					livenessEnabled = true
-					break
-				}
-			}
-		}
-	}
-	maxActions := p.config.Options.MaxActions
-	crashOnYield := p.config.Options.CrashOnYield
-	randMaxActions := maxActions
-	//fmt.Println("Options", p.config.Options)
-	if livenessEnabled {
-		randMaxActions = p.random.Int63n(maxActions)
-		p.config.Options.MaxActions = randMaxActions
-		defer func() {
-			p.config.Options.MaxActions = maxActions
-			p.config.Options.CrashOnYield = crashOnYield
-		}()
+	// With liveness properties, the visited states are kept for the whole walk,
+	// so revisiting a state closes a lasso that is checked for the properties.
+	properties, err := p.simulationProperties()
+	if err != nil {
+		return init, nil, err
 	}
-
-	//fmt.Println("MaxActions:", p.config.Options.MaxActions, "Seed:", p.Seed)
+	livenessEnabled := len(properties) > 0 && !p.revisit
+	var lastYield *Node
+	var loop []*Link
 
 	p.queue.Add(p.Init)
-	liveness := false
 	for p.queue.Len() != 0 && !p.stopped {
 		node, found := p.queue.Remove()
 		if !found {
 			panic("queue should not be empty")
 		}
 
-		if livenessEnabled && !liveness && node.actionDepth > int(p.config.Options.MaxActions - 1)  {
-			//fmt.Println("Max actions reached, switching to liveness", p.config.Options.MaxActions)
-			liveness = true
-			p.config.Options.MaxActions = 2*maxActions
-			*p.config.Options.CrashOnYield = false
-		} else if (liveness || !livenessEnabled) && node.actionDepth > int(p.config.Options.MaxActions) {
+		if node.actionDepth > int(p.config.Options.MaxActions) {
 			//fmt.Println("Max actions reached", p.config.Options.MaxActions)
 			continue
 		}
-		if liveness && node.actionDepth > 0  && node.actionDepth > int(randMaxActions) {
-			if node.currentThread().Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_UNFAIR ||
-				node.currentThread().Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_UNKNOWN {
-				livenessNode = node
-				continue
-			}
-		}
 
 		invariantFailure := false
 		symmetryFound := false
 		prevLen := p.queue.Len()
-		if !liveness || node.actionDepth <= int(maxActions) {
+		if !livenessEnabled {
 			p.visited = make(map[string]*Node)
 		}
 		for true {
 			inCrashPath := false
 			if len(node.Inbound) > 0 {
 				if node.Inbound[0].Node.Name == "crash" {
-					if liveness && node.actionDepth > int(randMaxActions) {
-						var nonCrashNode *Node
-						for p.queue.Len() != 0 {
-							nonCrashNode, _ = p.queue.Remove()
-							if nonCrashNode.Inbound[0].Node.Name == "crash" {
-								continue
-							}
-							break
-						}
-						if nonCrashNode != nil {
-							node = nonCrashNode
-							continue
-						} else {
-							break
-						}
-
-					}
 					inCrashPath = true
 				}
 			}
+			if p.revisit {
+				p.visited = make(map[string]*Node)
+			}
 			invariantFailure, symmetryFound = p.processNode(node)
+			p.walkEnd = node
+			p.walkSteps++
+			if p.revisit && p.walkSteps >= maxRevisitSteps {
+				// The walk can loop forever, when the loop has no way out.
+				p.stopped = true
+				break
+			}
 			if invariantFailure {
 				break
 			}
+			if livenessEnabled && node.Process == nil {
+				if loop = lassoLoop(node); loop != nil {
+					break
+				}
+			}
 
 			if node.Process != nil && (node.Name == "yield" || node.Name == "crash") && p.simulation && (!inCrashPath || node.Enabled){
 				p.intermediate_states.ClearAll()
@@ -1037,6 +1245,11 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 					break
 				}
 				node, _ = p.intermediate_states.Remove()
+				if p.revisit {
+					// The siblings of the earlier steps are not successors of this node,
+					// so keeping them would skew the probabilities of the next picks.
+					p.intermediate_states.ClearAll()
+				}
 			} else {
 				has_another_crash_action := false
 				var anotherCrashNode *Node
@@ -1061,6 +1274,11 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 		}
 		p.intermediate_states.ClearAll()
 
+		if loop != nil {
+			// The walk cannot continue past the revisited state.
+			lastYield = loop[len(loop)-1].Node
+			break
+		}
 		if symmetryFound {
 			continue
 		}
@@ -1070,56 +1288,49 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 		if invariantFailure {
 			break
 		}
-		if node.Process == nil && liveness {
-			failedInvPos, failed, ok := p.checkLiveness(node.DuplicateOf)
-			if !ok {
-				failedNode = failed
-				failedNode.FailedInvariants = make(map[int][]int)
-				failedNode.FailedInvariants[failedInvPos.FileIndex] = []int{failedInvPos.InvariantIndex}
-				break
-			}
-
-		}
 		if p.simulation && node.Process != nil && node.Name == "yield" && node.Enabled {
 			p.queue.Clear(prevLen)
+			lastYield = node
 		}
 
 		if node.Process != nil && !node.Process.Enabled && prevLen == 0 && len(node.Inbound[0].Node.Outbound) == 0 {
-			if !liveness && p.config.GetDeadlockDetection() {
+			if p.config.GetDeadlockDetection() {
 				failedNode = node.Inbound[0].Node
 				break
-			} else if liveness && p.config.GetDeadlockDetection() {
-				// The if condition shouldn't have been required, but there is a small edge case not handled so far.
-				// This condition will prevent stuttering errors if deadlock detection is disabled.
-				// Ideally, when checking liveness with deadlock detection disabled, we must try non-fair actions,
-				// to distinquishe between stuttering and deadlock.
-
-				// During liveness check since we are skipping non-fair nodes, we may end up with no next steps
-				// if this state matches all the required predicates, then it is a valid state. Otherwise, mark it as
-				// stutter state.
-				livenessNode = node
 			}
-
 		}
 	}
-	if liveness && livenessNode != nil {
-		for i, file := range p.Files {
-			for j, invariant := range file.Invariants {
-				hasEventually := slices.Contains(invariant.TemporalOperators, "eventually") || invariant.Eventually
-				if hasEventually {
-						if !livenessNode.Inbound[0].Node.Process.Witness[i][j] {
-							failedNode = livenessNode.Inbound[0].Node
-							break
-						}
-
-				}
-			}
-
+	if livenessEnabled && failedNode == nil && lastYield != nil && !p.stopped {
+		p.lassoFailure, err = p.checkWalk(lastYield, loop, properties)
+		if err != nil {
+			return p.Init, nil, err
 		}
 	}
+	if p.lassoFailure != nil {
+		failedNode = p.lassoFailure.Path[len(p.lassoFailure.Path)-1].Node
+	}
+	if p.guide != nil {
+		p.guide.record(p)
+	}
 	return p.Init, failedNode, err
 }
 
+// WalkPath returns the path taken by the simulation, from the init node to the last node processed.
+func (p *Processor) WalkPath() []*Link {
+	end := p.walkEnd
+	if end == nil {
+		end = p.Init
+	}
+	// The last node can be merged into the state it duplicates.
+	for end != nil && end.DuplicateOf != nil {
+		end = end.DuplicateOf
+	}
+	if end == nil {
+		return nil
+	}
+	return pathToInit([]*Node{p.Init}, end)
+}
+
 func processPreInit(init *Node, stmts []*ast.Statement) {
 	thread := init.NewThread()
 	thread.currentFrame().pc = fmt.Sprintf("Stmts[%d]", 0)
@@ -1140,17 +1351,28 @@ func processPreInit(init *Node, stmts []*ast.Statement) {
 }
 
 func (p *Processor) processNode(node *Node) (bool, bool) {
-	if node.Process.currentThread().currentPc() == "" && node.Name == "init" {
+	// The injected faults are applied when scheduling, there is nothing to execute.
+	injected := node.isInjectedFault()
+	if !injected && node.Process.currentThread().currentPc() == "" && node.Name == "init" {
 		if node.Process.Files[0].Actions[0].Name != "Init" {
 			return p.processInit(node), false
 		}
 
 	}
 	node.CachedHashCode = ""
-	forks, yield := node.currentThread().Execute()
+	var forks []*Process
+	yield := true
+	startedAction := ""
+	if !injected && len(node.Inbound) > 0 && node.Inbound[0].Type == "action" {
+		startedAction = node.currentThread().Stack.RawArray()[0].Name
+	}
+	if !injected {
+		forks, yield = node.currentThread().Execute()
+	}
 	if len(forks) == 0 && !node.Enabled {
 		return false, false
 	}
+	p.coverage.recordAction(startedAction)
 	// Add the labels from the process to the inbound links
 	// This must be done even for duplicate nodes
 	// The labels for the outbound links are added when the node is merged/attached
@@ -1160,6 +1382,18 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 		node.Inbound[0].Messages = append(node.Inbound[0].Messages, node.Process.Messages...)
 	}
 
+	// The transition assertions are checked before merging the nodes, as a new
+	// transition to an already visited state can still violate them.
+	var failedTransitions map[int][]int
+	if prev := node.PreviousYield(); yield && prev != nil {
+		failedTransitions = CheckTransitionInvariants(prev.Process, node.Process)
+	}
+	transitionFailed := len(failedTransitions[0]) > 0
+	if transitionFailed {
+		// The failure belongs to the transition, the state is deduplicated as usual.
+		node.Inbound[0].FailedInvariants = failedTransitions
+	}
+
 	// If the node is already visited, merge the nodes and return
 	// In this case, we are skipping checking invariants as well.
 	// Reevaluate if this is the right thing to do. Invariants are checked only
@@ -1174,6 +1408,9 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 		// We will keep the enabled state in the node, during execution but have to be
 		// copied to the link/transition when attaching/merging similar to Fairness.
 		if other.Enabled || !node.Enabled {
+			if transitionFailed {
+				return node.failTransitionTo(other), false
+			}
 			node.Duplicate(other, yield)
 			return false, false
 		} else {
@@ -1186,6 +1423,9 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 		for _, hash := range hashes {
 			if other, ok := p.visited[hash]; ok {
 				if other.Enabled || !node.Enabled {
+					if transitionFailed {
+						return node.failTransitionTo(other), false
+					}
 					node.Duplicate(other, yield)
 					return false, true
 				}
@@ -1199,6 +1439,9 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 	var failedInvariants map[int][]int
 	if yield {
 		failedInvariants = CheckInvariants(node.Process)
+		for i, failed := range failedTransitions {
+			failedInvariants[i] = append(failedInvariants[i], failed...)
+		}
 	}
 	if len(failedInvariants[0]) > 0 {
 		//panic(fmt.Sprintf("Invariant failed: %v", failedInvariants))
@@ -1226,7 +1469,7 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 			p.YieldNode(node)
 		}
 		node.Name = "yield"
-		if len(node.Process.Threads) == 0 || !*p.config.Options.CrashOnYield {
+		if injected || len(node.Process.Threads) == 0 || !*p.config.Options.CrashOnYield {
 			return false, false
 		}
 		frameName := node.Process.currentThread().Stack.RawArray()[0].Name
@@ -1333,12 +1576,17 @@ func (p *Processor) processInit(node *Node) bool {
 	node.Process.removeCurrentThread()
 	// This is init node, generate a fork for each action in the file
 	for i, action := range p.Files[0].Actions {
+		if len(action.Params) > 0 || action.GetGuard() != nil {
+			p.scheduleAction(node, nil, nil, 0, action, i)
+			continue
+		}
 		newNode := node.ForkForAction(nil, nil, action)
 		//newNode.Process.removeCurrentThread()
 		thread := newNode.Process.NewThread()
 		//thread := newNode.currentThread()
 		thread.currentFrame().pc = fmt.Sprintf("Actions[%d]", i)
 		thread.currentFrame().Name = action.Name
+		newNode.Inbound[0].ReqId = thread.Id
 		p.queue.Add(newNode)
 	}
 	return false
@@ -1358,18 +1606,35 @@ func (p *Processor) YieldNode(node *Node) {
 		p.queue.Add(newNode)
 	}
 
-	if node.actionDepth >= int(p.config.Options.MaxActions) ||
-		len(node.Threads) >= int(p.config.Options.MaxConcurrentActions) {
+	if len(node.Threads) >= int(p.config.Options.MaxConcurrentActions) {
+		return
+	}
+	if node.actionDepth >= int(p.config.Options.MaxActions) {
+		p.deferActions(node, nil)
 		return
 	}
+	p.scheduleActions(node, nil)
+}
 
+// scheduleActions schedules the actions, the role crashes, the channel faults and
+// the time tick from the yield point.
+func (p *Processor) scheduleActions(node *Node, process *Process) {
 	for i, action := range p.Files[0].Actions {
-		p.scheduleAction(node, nil, nil, 0, action, i)
+		p.scheduleAction(node, process, nil, 0, action, i)
 	}
 	if len(node.Roles) > 0 {
-		p.scheduleRoleActions(node, nil)
+		p.scheduleRoleActions(node, process)
 	}
+	p.scheduleChannelFaults(node, process)
+	p.scheduleTick(node, process)
+}
 
+// deferActions records the yield point whose actions are not scheduled because of max_actions.
+// The dfs schedules them if the node is reached again through a shorter path.
+func (p *Processor) deferActions(node *Node, process *Process) {
+	if p.deferred != nil {
+		p.deferred[node] = append(p.deferred[node], process)
+	}
 }
 
 func (p *Processor) scheduleRoleActions(node *Node, process *Process) {
@@ -1383,12 +1648,122 @@ func (p *Processor) scheduleRoleActions(node *Node, process *Process) {
 		}
 		index := roleMap[role.Name]
 		roleAst := p.Files[0].Roles[index]
+		statRole := role
+		if process != nil {
+			if r := findRole(process.Roles, role); r != nil {
+				statRole = r
+			}
+		}
+		crashed := statRole.Crashed
 		for i, action := range roleAst.Actions {
+			// A crashed role instance can only Recover, and Recover is only
+			// scheduled after a crash.
+			if crashed != (action.Name == RecoverActionName) {
+				continue
+			}
+			if !p.isTimerReady(statRole, action.Name) {
+				continue
+			}
 			p.scheduleAction(node, process, role, index, action, i)
 
 		}
+		if !crashed {
+			p.scheduleRoleCrash(node, process, role, roleAst)
+		}
+	}
+}
+
+// scheduleRoleCrash schedules the crash of the role instance, if crashes are
+// enabled for the role with the action options `Role#0.crash`, `Role#.crash` or `Role.crash`.
+// On crash, the threads executing in the role instance are killed and the ephemeral
+// fields are reset. If the role defines a Recover action, the role instance stays
+// crashed until Recover is executed, otherwise it restarts immediately.
+func (p *Processor) scheduleRoleCrash(node *Node, process *Process, role *lib.Role, roleAst *ast.Role) {
+	statProcess := process
+	if process == nil {
+		statProcess = node.Process
+	}
+	crashAction := &ast.Action{Name: CrashActionName}
+	if !p.isCrashEnabled(role) || p.ExceedsActionCountLimits(crashAction, statProcess, role) {
+		return
+	}
+	newNode := node.ForkForAction(process, role, crashAction)
+	newNode.Inbound[0].Type = CrashActionName
+	crashedRole := findRole(newNode.Roles, role)
+	if crashedRole == nil {
+		return
+	}
+	newNode.Process.crashRole(crashedRole, roleAst.DurableFields)
+	if !slices.ContainsFunc(roleAst.Actions, func(action *ast.Action) bool {
+		return action.Name == RecoverActionName
+	}) {
+		crashedRole.Crashed = false
+	}
+	newNode.Process.Enable()
+	p.queue.Add(newNode)
+}
 
+func (p *Processor) isCrashEnabled(role *lib.Role) bool {
+	keys := []string{
+		role.RefStringShort() + "." + CrashActionName,
+		role.Name + "#." + CrashActionName,
+		role.Name + "." + CrashActionName,
+	}
+	for _, key := range keys {
+		if p.config.ActionOptions[key] != nil && p.config.ActionOptions[key].MaxActions > 0 {
+			return true
+		}
 	}
+	return false
+}
+
+// isTimerReady returns false if the action is guarded by a timer that is not
+// due yet. Without max_time, an armed timer is always due.
+func (p *Processor) isTimerReady(role *lib.Role, actionName string) bool {
+	if !role.IsTimerGated(actionName) {
+		return true
+	}
+	if role.Timers[actionName] == lib.TimerDisarmed {
+		return false
+	}
+	return p.config.Options.GetMaxTime() == 0 || role.IsTimerDue(actionName)
+}
+
+// scheduleTick schedules a transition that advances the time, if max_time is set
+// and there is at least one timer waiting for the time to elapse.
+func (p *Processor) scheduleTick(node *Node, process *Process) {
+	statProcess := process
+	if process == nil {
+		statProcess = node.Process
+	}
+	if int64(statProcess.Time) >= p.config.Options.GetMaxTime() {
+		return
+	}
+	waiting := slices.ContainsFunc(statProcess.Roles, func(role *lib.Role) bool {
+		for _, remaining := range role.Timers {
+			if remaining > 0 {
+				return true
+			}
+		}
+		return false
+	})
+	if !waiting {
+		return
+	}
+	newNode := node.ForkForAction(process, nil, &ast.Action{Name: TickActionName})
+	newNode.Inbound[0].Type = TickActionName
+	newNode.Process.tick()
+	newNode.Process.Enable()
+	p.queue.Add(newNode)
+}
+
+func findRole(roles []*lib.Role, role *lib.Role) *lib.Role {
+	for _, r := range roles {
+		if r.RefStringShort() == role.RefStringShort() {
+			return r
+		}
+	}
+	return nil
 }
 
 func (p *Processor) YieldFork(node *Node, process *Process) {
@@ -1403,18 +1778,14 @@ func (p *Processor) YieldFork(node *Node, process *Process) {
 
 		p.queue.Add(newNode)
 	}
-	if node.actionDepth >= int(p.config.Options.MaxActions) ||
-		len(process.Threads) >= int(p.config.Options.MaxConcurrentActions) {
-
+	if len(process.Threads) >= int(p.config.Options.MaxConcurrentActions) {
 		return
 	}
-	for i, action := range p.Files[0].Actions {
-		p.scheduleAction(node, process, nil, 0, action, i)
-	}
-
-	if len(node.Roles) > 0 {
-		p.scheduleRoleActions(node, process)
+	if node.actionDepth >= int(p.config.Options.MaxActions) {
+		p.deferActions(node, process)
+		return
 	}
+	p.scheduleActions(node, process)
 }
 
 func (p *Processor) scheduleAction(node *Node, process *Process, role *lib.Role, roleIndex int,
@@ -1430,6 +1801,26 @@ func (p *Processor) scheduleAction(node *Node, process *Process, role *lib.Role,
 	if p.ExceedsActionCountLimits(action, statProcess, role) {
 		return
 	}
+	if len(action.Params) == 0 {
+		p.forkAction(node, process, statProcess, role, roleIndex, action, actionIndex, nil)
+		return
+	}
+	for _, binding := range p.expandActionParams(statProcess, role, action) {
+		p.forkAction(node, process, statProcess, role, roleIndex, action, actionIndex, binding)
+	}
+}
+
+// forkAction starts the action in a new node, with the parameters bound to the values
+// in the binding for the parameterized actions.
+func (p *Processor) forkAction(node *Node, process *Process, statProcess *Process, role *lib.Role, roleIndex int,
+	action *ast.Action, actionIndex int, binding *actionBinding) {
+
+	if p.exceedsBindingLimits(statProcess, role, action, binding) {
+		return
+	}
+	if !p.isActionEnabled(node, statProcess, role, action, binding) {
+		return
+	}
 
 	newNode := node.ForkForAction(process, role, action)
 	thread := newNode.Process.NewThread()
@@ -1451,16 +1842,60 @@ func (p *Processor) scheduleAction(node *Node, process *Process, role *lib.Role,
 			// the old node's `roles` list. So, we filter it out here.
 			return
 		}
+		if action.Name == RecoverActionName {
+			frame.obj.Crashed = false
+		}
+		if frame.obj.IsTimerGated(action.Name) {
+			// Timers are one-shot, the action has to arm it again if needed.
+			frame.obj.Timers[action.Name] = lib.TimerDisarmed
+		}
 		frame.pc = fmt.Sprintf("Roles[%d].Actions[%d]", roleIndex, actionIndex)
 		frame.Name = role.Name + "." + action.Name
 	} else {
 		frame.pc = fmt.Sprintf("Actions[%d]", actionIndex)
 		frame.Name = action.Name
 	}
+	if binding != nil {
+		newNode.recordBinding(role, action, binding, frame)
+	}
 
 	p.queue.Add(newNode)
 }
 
+// isActionEnabled evaluates the guard of the action against the state, before
+// forking the process. The guard must not modify the state, as it is evaluated
+// without copying the variables. Disabled actions are recorded in the node.
+func (p *Processor) isActionEnabled(node *Node, statProcess *Process, role *lib.Role, action *ast.Action,
+	binding *actionBinding) bool {
+
+	if action.GetGuard().GetPyExpr() == "" {
+		return true
+	}
+	actionName := binding.labeledName(action.Name)
+	var self *lib.Role
+	if role != nil {
+		self = findRole(statProcess.Roles, role)
+		if self == nil {
+			// The role is no longer in the heap, scheduleAction filters it out.
+			return true
+		}
+		actionName = role.RefStringShort() + "." + actionName
+	}
+	vars := statProcess.getGuardVariables(self)
+	if binding != nil {
+		binding.addTo(vars)
+	}
+	cond, err := statProcess.Evaluator.EvalExpr(p.Files[0].GetSourceInfo().GetFileName(), action.Guard, vars)
+	statProcess.PanicOnError(action.Guard.GetSourceInfo(), fmt.Sprintf("Error checking guard: %s", action.Guard.PyExpr), err)
+	if cond.Truth() {
+		return true
+	}
+	if !slices.Contains(node.DisabledActions, actionName) {
+		node.DisabledActions = append(node.DisabledActions, actionName)
+	}
+	return false
+}
+
 func (p *Processor) ExceedsActionCountLimits(action *ast.Action, statProcess *Process, role *lib.Role) bool {
 	actionName := action.Name
 	if role != nil {
@@ -1537,113 +1972,6 @@ func (p *Processor) Stopped() bool {
 	return p.stopped
 }
 
-func (p *Processor) checkLiveness(node *Node) (*InvariantPosition, *Node, bool) {
-	// Iterate over all files and their invariants
-	for i, file := range p.Files {
-		for j, invariant := range file.Invariants {
-			// Check if the invariant contains the "eventually" operator
-			hasEventually := slices.Contains(invariant.TemporalOperators, "eventually") || invariant.Eventually
-			if !hasEventually {
-				// Skip if the invariant does not involve liveness
-				continue
-			}
-
-			// Determine if the invariant is "eventually always" or "always eventually"
-			eventuallyAlways := false
-			alwaysEventually := false
-
-			// Handle block-based or operator-based invariants
-			if invariant.Block == nil {
-				if invariant.Always && invariant.Eventually {
-					alwaysEventually = true
-				} else if invariant.Eventually && invariant.GetNested().GetAlways() {
-					eventuallyAlways = true
-				}
-			} else {
-				// Check the order of temporal operators to identify liveness type
-				if slices.Contains(invariant.TemporalOperators, "eventually") &&
-					invariant.TemporalOperators[0] == "eventually" && invariant.TemporalOperators[1] == "always" {
-					eventuallyAlways = true
-				} else if slices.Contains(invariant.TemporalOperators, "eventually") &&
-					invariant.TemporalOperators[0] == "always" && invariant.TemporalOperators[1] == "eventually" {
-					alwaysEventually = true
-				}
-			}
-
-			// Check Witness for "eventually always" or "always eventually"
-			if eventuallyAlways {
-				// Check if invariant eventually holds and remains true forever after some point
-				if failedNode, ok := p.checkEventuallyAlways(i, j, node); !ok {
-					return NewInvariantPosition(i, j), failedNode, false
-				}
-			} else if alwaysEventually {
-				// Check if the invariant holds infinitely often
-				if failedNode, ok := p.checkAlwaysEventually(i, j, node); !ok {
-					return NewInvariantPosition(i, j), failedNode, false
-				}
-			}
-		}
-	}
-
-	// If no invariant failed, return success
-	return nil, nil, true
-}
-
-// Helper to check "eventually always" (<>[]) property
-func (p *Processor) checkEventuallyAlways(fileIndex, invariantIndex int, node *Node) (*Node, bool) {
-	// Iterate through the outbound links of the cycle
-	currentNode := node
-	for {
-		// Check if the invariant becomes permanently true at some point
-		if !currentNode.Process.Witness[fileIndex][invariantIndex] {
-			// If the invariant is false at this node, the "eventually always" condition fails
-			return currentNode, false
-		}
-
-		// Move to the next node in the cycle
-		if len(currentNode.Outbound) == 0 {
-			break
-		}
-		nextNode := currentNode.Outbound[0].Node
-		// Break if we detect a cycle back to the initial node
-		if nextNode == node {
-			break
-		}
-		currentNode = nextNode
-	}
-
-	// If we completed the cycle and the invariant was true throughout, return success
-	return nil, true
-}
-
-// Helper to check "always eventually" ([]<>) property
-func (p *Processor) checkAlwaysEventually(fileIndex, invariantIndex int, node *Node) (*Node, bool) {
-	// Iterate through the outbound links of the cycle
-	currentNode := node
-	for {
-		// Check if the invariant is true at least once in this cycle (eventually reappears)
-		if currentNode.Process.Witness[fileIndex][invariantIndex] {
-			// The invariant was true at some point, so "always eventually" holds
-			return nil, true
-		}
-
-		// Move to the next node in the cycle
-		if len(currentNode.Outbound) == 0 {
-			break
-		}
-		nextNode := currentNode.Outbound[0].Node
-		// Break if we detect a cycle back to the initial node
-		if nextNode == node {
-			break
-		}
-		currentNode = nextNode
-	}
-
-	// If the invariant was never true in the cycle, it fails
-	return currentNode, false
-}
-
-
 func captureStackTrace() string {
 	if !enableCaptureStackTrace {
 		return ""
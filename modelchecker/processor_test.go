@@ -3,6 +3,7 @@ package modelchecker
 import (
 	ast "fizz/proto"
 	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/starlark"
@@ -11,6 +12,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -104,6 +107,483 @@ func TestProcessor_Start(t *testing.T) {
 	assert.Equal(t, 91, len(p1.visited))
 }
 
+func TestProcessor_RoleCrash(t *testing.T) {
+	file, err := parseAstFromString(RoleWithDurableFields)
+	require.Nil(t, err)
+	files := []*ast.File{file}
+	crashOnYield := false
+	p1 := NewProcessor(files, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           3,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+		ActionOptions: map[string]*ast.Options{
+			"Server.crash": {MaxActions: 1},
+		},
+	}, false, 0, "")
+	root, _, err := p1.Start()
+	require.Nil(t, err)
+	require.NotNil(t, root)
+
+	crashes := 0
+	recoveries := 0
+	for _, node := range p1.visited {
+		if node.Process == nil || len(node.Inbound) == 0 || len(node.Roles) == 0 {
+			continue
+		}
+		server := node.Roles[0]
+		log, err := server.Attr("log")
+		require.Nil(t, err)
+		cache, err := server.Attr("cache")
+		require.Nil(t, err)
+		switch node.Inbound[0].Name {
+		case "Server#0.crash":
+			crashes++
+			assert.True(t, server.Crashed)
+			parentLog, err := node.Inbound[0].Node.Roles[0].Attr("log")
+			require.Nil(t, err)
+			assert.Equal(t, parentLog, log)
+			assert.Equal(t, starlark.MakeInt(0), cache)
+		case "Server#0.Recover":
+			recoveries++
+			assert.False(t, server.Crashed)
+			assert.Equal(t, log, cache)
+		}
+	}
+	assert.Equal(t, 3, crashes)
+	assert.Equal(t, 1, recoveries)
+}
+
+func TestProcessor_RoleCrashDuringCall(t *testing.T) {
+	file, err := parseAstFromString(RoleCrashDuringCall)
+	require.Nil(t, err)
+	files := []*ast.File{file}
+	crashOnYield := false
+	p1 := NewProcessor(files, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           3,
+			MaxConcurrentActions: 2,
+			CrashOnYield:         &crashOnYield,
+		},
+		ActionOptions: map[string]*ast.Options{
+			"Server.crash": {MaxActions: 1},
+		},
+	}, false, 0, "")
+	root, _, err := p1.Start()
+	require.Nil(t, err)
+	require.NotNil(t, root)
+
+	crashesDuringCall := 0
+	crashesAfterCall := 0
+	for _, node := range p1.visited {
+		if node.Process == nil || len(node.Inbound) == 0 || node.Inbound[0].Name != "Server#0.crash" {
+			continue
+		}
+		server := findRole(node.Roles, node.Inbound[0].Node.Roles[0])
+		require.NotNil(t, server)
+		for _, thread := range node.Threads {
+			assert.False(t, thread.inRole(server))
+		}
+		for _, thread := range node.Inbound[0].Node.Threads {
+			if thread.inRole(server) {
+				crashesDuringCall++
+			}
+		}
+		if slices.Contains(server.Fields.AttrNames(), "pending") {
+			crashesAfterCall++
+			pending, err := server.Attr("pending")
+			require.Nil(t, err)
+			assert.Equal(t, starlark.None, pending)
+		}
+	}
+	assert.Greater(t, crashesDuringCall, 0)
+	assert.Greater(t, crashesAfterCall, 0)
+}
+
+func TestProcessor_ChannelFaults(t *testing.T) {
+	file, err := parseAstFromString(ChannelWithFaults)
+	require.Nil(t, err)
+	files := []*ast.File{file}
+	crashOnYield := false
+	p1 := NewProcessor(files, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           3,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+		ActionOptions: map[string]*ast.Options{
+			"net.duplicate": {MaxActions: 1},
+		},
+	}, false, 0, "")
+	root, _, err := p1.Start()
+	require.Nil(t, err)
+	require.NotNil(t, root)
+
+	faults := map[string]int{}
+	for _, node := range p1.visited {
+		if node.Process == nil {
+			continue
+		}
+		net := node.Heap.state["net"].(*lib.Channel)
+		for _, link := range node.Outbound {
+			if link.Type != ChannelFaultLinkType {
+				continue
+			}
+			faults[link.Name]++
+			nextNet := link.Node.Heap.state["net"].(*lib.Channel)
+			switch link.Name {
+			case "net.drop":
+				assert.Equal(t, []string{"drop(\"ping\")"}, link.Labels)
+				assert.Equal(t, net.Len()-1, nextNet.Len())
+			case "net.duplicate":
+				assert.Equal(t, []string{"duplicate(\"ping\")"}, link.Labels)
+				assert.Equal(t, net.Len()+1, nextNet.Len())
+			default:
+				assert.Fail(t, "unexpected fault", link.Name)
+			}
+		}
+	}
+	assert.Greater(t, faults["net.drop"], 0)
+	assert.Greater(t, faults["net.duplicate"], 0)
+
+	_, messages, _, _ := GetAllNodes(root, 3)
+	assert.Contains(t, messages, `{"name":"net","receiver":"net","sender":"","type":"message"}`)
+}
+
+func TestProcessor_Timers(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxTime       int64
+		expectedNodes int
+		minFireTime   int
+	}{
+		{
+			name:          "untimed",
+			expectedNodes: 2, // init and after the Timeout
+			minFireTime:   0,
+		},
+		{
+			name:          "timed",
+			maxTime:       5,
+			expectedNodes: 4, // init, 2 ticks and after the Timeout
+			minFireTime:   2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := parseAstFromString(RoleWithTimer)
+			require.Nil(t, err)
+			files := []*ast.File{file}
+			crashOnYield := false
+			p1 := NewProcessor(files, &ast.StateSpaceOptions{
+				Options: &ast.Options{
+					MaxActions:           5,
+					MaxConcurrentActions: 1,
+					CrashOnYield:         &crashOnYield,
+					MaxTime:              test.maxTime,
+				},
+			}, false, 0, "")
+			root, _, err := p1.Start()
+			require.Nil(t, err)
+			require.NotNil(t, root)
+			assert.Equal(t, test.expectedNodes, len(p1.visited))
+
+			for _, node := range p1.visited {
+				if node.Process == nil || len(node.Roles) == 0 {
+					continue
+				}
+				fired, err := node.Roles[0].Attr("fired")
+				if err != nil {
+					// Init is not completed yet
+					continue
+				}
+				if fired == starlark.MakeInt(1) {
+					assert.GreaterOrEqual(t, node.Time, test.minFireTime)
+					assert.Equal(t, lib.TimerDisarmed, node.Roles[0].Timers[lib.DefaultTimerName])
+				} else {
+					assert.Equal(t, starlark.MakeInt(0), fired)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessor_ActionGuards(t *testing.T) {
+	run := func(update func(action *ast.Action)) *Processor {
+		file, err := parseAstFromString(GuardedActions)
+		require.Nil(t, err)
+		for _, action := range file.Actions {
+			update(action)
+		}
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           5,
+				MaxConcurrentActions: 1,
+				CrashOnYield:         &crashOnYield,
+			},
+		}, false, 0, "")
+		root, _, err := p1.Start()
+		require.Nil(t, err)
+		require.NotNil(t, root)
+		return p1
+	}
+
+	unguarded := run(func(action *ast.Action) { action.Guard = nil })
+	guarded := run(func(action *ast.Action) {})
+	// The guards only skip the forks that would fail the require statements.
+	assert.Equal(t, len(unguarded.visited), len(guarded.visited))
+	assert.Equal(t, 3, len(guarded.visited))
+
+	checked := 0
+	for _, node := range guarded.visited {
+		if node.Process == nil || len(node.Threads) > 0 {
+			continue
+		}
+		checked++
+		x := node.Heap.state["x"]
+		switch x {
+		case starlark.MakeInt(2):
+			assert.Equal(t, []string{"Inc"}, node.DisabledActions)
+		default:
+			assert.Equal(t, []string{"Reset"}, node.DisabledActions)
+		}
+		assert.Contains(t, node.GetJsonString(), `"disabledActions"`)
+	}
+	assert.Equal(t, 3, checked)
+
+	// The guards can use the builtins, like deepcopy.
+	copied := run(func(action *ast.Action) {
+		action.Guard.PyExpr = strings.Replace(action.Guard.PyExpr, "x", "deepcopy(x)", 1)
+	})
+	assert.Equal(t, len(guarded.visited), len(copied.visited))
+}
+
+func TestProcessor_TransitionAssertions(t *testing.T) {
+	run := func(pyExpr string, continueOnFailures bool) (*Processor, *Node) {
+		file, err := parseAstFromString(GuardedActions)
+		require.Nil(t, err)
+		file.Invariants = append(file.Invariants, &ast.Invariant{
+			Name:              "NeverDecreases",
+			TemporalOperators: []string{"always"},
+			Transition:        true,
+			Block: &ast.Block{
+				Flow:  ast.Flow_FLOW_ATOMIC,
+				Stmts: []*ast.Statement{{ReturnStmt: &ast.ReturnStmt{PyExpr: pyExpr, Expr: &ast.Expr{PyExpr: pyExpr}}}},
+			},
+		})
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           5,
+				MaxConcurrentActions: 1,
+				CrashOnYield:         &crashOnYield,
+			},
+			ContinueOnInvariantFailures: continueOnFailures,
+		}, false, 0, "")
+		root, failedNode, err := p1.Start()
+		require.Nil(t, err)
+		require.NotNil(t, root)
+		return p1, failedNode
+	}
+
+	p1, failedNode := run("old.x <= new.x or new.x == 0", false)
+	assert.Nil(t, failedNode)
+	assert.Equal(t, 3, len(p1.visited))
+
+	// Reset leads to the already visited initial state, but the transition is still checked.
+	_, failedNode = run("old.x <= new.x", false)
+	require.NotNil(t, failedNode)
+	assert.Equal(t, []int{0}, failedNode.FailedInvariants[0])
+	assert.Equal(t, starlark.MakeInt(0), failedNode.Heap.state["x"])
+	transition := TransitionPath(failedNode)
+	require.Len(t, transition, 1)
+	assert.Equal(t, "Reset", transition[0].Name)
+	assert.Equal(t, starlark.MakeInt(2), failedNode.PreviousYield().Heap.state["x"])
+
+	// The state reached by the failing transition is stored as visited, so it is not explored again.
+	p1, failedNode = run("old.x <= new.x", true)
+	require.NotNil(t, failedNode)
+	assert.Equal(t, 3, len(p1.visited))
+	failed := 0
+	for _, node := range p1.visited {
+		for _, link := range node.Outbound {
+			if len(link.FailedInvariants[0]) > 0 {
+				failed++
+				assert.Equal(t, "Reset", link.Name)
+				assert.Equal(t, starlark.MakeInt(0), link.Node.Heap.state["x"])
+				assert.Contains(t, p1.visited, link.Node.HashCode())
+			}
+		}
+	}
+	assert.Equal(t, 1, failed)
+}
+
+func TestProcessor_MinimizeFailurePath(t *testing.T) {
+	file, err := parseAstFromString(CounterWithNoise)
+	require.Nil(t, err)
+	crashOnYield := false
+	// With this seed, the simulation interleaves the noise and fails only after a long path.
+	p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           10,
+			MaxConcurrentActions: 2,
+			CrashOnYield:         &crashOnYield,
+		},
+	}, true, 1, "")
+	_, failedNode, err := p1.Start()
+	require.Nil(t, err)
+	require.NotNil(t, failedNode)
+	original := pathToInit([]*Node{p1.Init}, failedNode)
+	require.Greater(t, len(original), 3)
+
+	minimized := p1.MinimizeFailurePath(failedNode, 0)
+	require.NotNil(t, minimized)
+	names := make([]string, len(minimized))
+	for i, link := range minimized {
+		names[i] = link.Name
+	}
+	assert.Equal(t, []string{"Init", "Inc", "Inc"}, names)
+	last := minimized[len(minimized)-1].Node
+	assert.Equal(t, starlark.MakeInt(2), last.Heap.state["x"])
+	assert.Equal(t, []int{0}, last.FailedInvariants[0])
+}
+
+func TestProcessor_Failures(t *testing.T) {
+	run := func(continueOnFailures bool) *Processor {
+		file, err := parseAstFromString(CounterWithNoise)
+		require.Nil(t, err)
+		file.Invariants = append(file.Invariants, &ast.Invariant{Always: true, PyExpr: "y < 1"})
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           5,
+				MaxConcurrentActions: 2,
+				CrashOnYield:         &crashOnYield,
+			},
+			ContinueOnInvariantFailures: continueOnFailures,
+		}, false, 0, "")
+		_, failedNode, err := p1.Start()
+		require.Nil(t, err)
+		require.NotNil(t, failedNode)
+		return p1
+	}
+
+	failures := run(false).Failures()
+	require.Len(t, failures, 1)
+
+	failures = run(true).Failures()
+	require.Len(t, failures, 2)
+	assert.Equal(t, NewInvariantPosition(0, 0), failures[0].Position)
+	assert.Equal(t, starlark.MakeInt(2), failures[0].Node.Heap.state["x"])
+	assert.Equal(t, NewInvariantPosition(0, 1), failures[1].Position)
+	assert.Equal(t, starlark.MakeInt(1), failures[1].Node.Heap.state["y"])
+	// The first failure is the shortest path to the violation.
+	assert.Len(t, pathToInit([]*Node{failures[1].Node.root()}, failures[1].Node), 2)
+}
+
+func TestProcessor_Coverage(t *testing.T) {
+	file, err := parseAstFromString(PartiallyCoveredSpec)
+	require.Nil(t, err)
+	crashOnYield := false
+	p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           5,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+	}, false, 0, "")
+	_, failedNode, err := p1.Start()
+	require.Nil(t, err)
+	require.Nil(t, failedNode)
+
+	report := p1.Coverage().Report(p1.Files)
+	assert.Equal(t, 6, report.Statements)
+	assert.Equal(t, 4, report.ExecutedStatements)
+	assert.Equal(t, []string{
+		"Actions[0].Block.Stmts[1].IfStmt.Branches[1].Block.Stmts[0]",
+		"Actions[1].Block.Stmts[1]",
+	}, report.UnexecutedStatements)
+	assert.Equal(t, 2, report.Branches)
+	assert.Equal(t, 1, report.TakenBranches)
+	assert.Equal(t, []string{"Actions[0].Block.Stmts[1].IfStmt.Branches[1]"}, report.UntakenBranches)
+	assert.Equal(t, []string{"Never"}, report.NeverEnabledActions)
+	assert.Equal(t, []string{"Implication"}, report.VacuousInvariants)
+}
+
+func TestProcessor_ParameterizedActions(t *testing.T) {
+	tests := []struct {
+		name          string
+		actionOptions map[string]*ast.Options
+		expectedNodes int
+	}{
+		{
+			name:          "unlimited",
+			expectedNodes: 6, // 2 after the first Send and 4 after the second
+		},
+		{
+			name: "per-argument limit",
+			actionOptions: map[string]*ast.Options{
+				"Send(a,*)": {MaxActions: 1},
+			},
+			expectedNodes: 5, // Send(a,b) cannot follow Send(a,b)
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := parseAstFromString(ParameterizedAction)
+			require.Nil(t, err)
+			crashOnYield := false
+			p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+				Options: &ast.Options{
+					MaxActions:           2,
+					MaxConcurrentActions: 1,
+					CrashOnYield:         &crashOnYield,
+				},
+				ActionOptions: test.actionOptions,
+			}, false, 0, "")
+			root, _, err := p1.Start()
+			require.Nil(t, err)
+			require.NotNil(t, root)
+			assert.Equal(t, test.expectedNodes, len(p1.visited))
+
+			names := make([]string, 0)
+			for _, link := range root.Outbound {
+				names = append(names, link.Name)
+			}
+			assert.ElementsMatch(t, []string{"Send(a,b)", "Send(b,a)"}, names)
+			assert.ElementsMatch(t, []string{"Send(a,a)", "Send(b,b)"}, root.DisabledActions)
+		})
+	}
+}
+
+func TestProcessor_SymmetricParameterizedActions(t *testing.T) {
+	file, err := parseAstFromString(SymmetricParameterizedAction)
+	require.Nil(t, err)
+	crashOnYield := false
+	p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           1,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+	}, false, 0, "")
+	root, _, err := p1.Start()
+	require.Nil(t, err)
+	require.NotNil(t, root)
+	// Ping(n0) and Ping(n1) are symmetric, including the node bound in the frame
+	// after the first statement, so only the states of one of them are explored.
+	assert.Equal(t, 2, len(p1.visited))
+	require.Len(t, root.Outbound, 2)
+	assert.Same(t, root.Outbound[0].Node, root.Outbound[1].Node)
+	for _, node := range p1.visited {
+		if len(node.Threads) == 0 {
+			assert.Equal(t, `{"pinged":"[n0, n0]"}`, strings.ReplaceAll(node.Heap.String(), lib.SymmetryPrefix, ""))
+		}
+	}
+}
+
 func printFileNames(rootDir string) error {
 	return filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -602,3 +1082,176 @@ func WriteFile(t *testing.T, tempDir string, filename string, content []byte) {
 		t.Fatalf("Failed to write file: %v", err)
 	}
 }
+
+func TestSwarm(t *testing.T) {
+	file, err := parseAstFromString(CounterWithNoise)
+	require.Nil(t, err)
+	crashOnYield := true
+	options := &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           5,
+			MaxConcurrentActions: 2,
+			CrashOnYield:         &crashOnYield,
+		},
+	}
+	swarm := NewSwarm([]*ast.File{file}, options, "", 4, 100, 1)
+	failure := swarm.Start()
+	require.NotNil(t, failure)
+	require.Nil(t, failure.Err)
+	require.NotNil(t, failure.FailedNode)
+	assert.True(t, failure.FailedNode.HasFailedInvariants())
+	assert.Equal(t, SwarmVariant(options, failure.Seed), failure.Options)
+	assert.GreaterOrEqual(t, swarm.Runs(), 1)
+	assert.Greater(t, swarm.DistinctStates(), 0)
+
+	// The seed alone reproduces the failure.
+	rerun := NewSwarm([]*ast.File{file}, options, "", 1, 1, failure.Seed).Start()
+	require.NotNil(t, rerun)
+	assert.Equal(t, failure.Seed, rerun.Seed)
+	assert.True(t, rerun.FailedNode.HasFailedInvariants())
+}
+
+func TestSwarm_NoFailure(t *testing.T) {
+	file, err := parseAstFromString(PartiallyCoveredSpec)
+	require.Nil(t, err)
+	crashOnYield := false
+	swarm := NewSwarm([]*ast.File{file}, &ast.StateSpaceOptions{
+		Options: &ast.Options{
+			MaxActions:           5,
+			MaxConcurrentActions: 1,
+			CrashOnYield:         &crashOnYield,
+		},
+	}, "", 4, 20, 1)
+	assert.Nil(t, swarm.Start())
+	assert.Equal(t, 20, swarm.Runs())
+	assert.Greater(t, swarm.DistinctStates(), 1)
+	assert.Equal(t, []string{"Never"}, swarm.Coverage().Report([]*ast.File{file}).NeverEnabledActions)
+}
+
+func TestSimulationGuide(t *testing.T) {
+	simulate := func(guide *SimulationGuide, seed int64) (*Processor, *Node) {
+		file, err := parseAstFromString(LabeledCoinToss)
+		require.Nil(t, err)
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           3,
+				MaxConcurrentActions: 1,
+				CrashOnYield:         &crashOnYield,
+			},
+		}, true, seed, "")
+		p1.SetSimulationGuide(guide)
+		_, failedNode, err := p1.Start()
+		require.Nil(t, err)
+		return p1, failedNode
+	}
+
+	// The tail never happens with the probability 0.
+	guide, err := NewSimulationGuide(SimulationWeighted, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{"Toss.head": {Probability: 1}},
+	})
+	require.Nil(t, err)
+	for seed := int64(1); seed <= 20; seed++ {
+		_, failedNode := simulate(guide, seed)
+		assert.Nil(t, failedNode)
+	}
+	guide, err = NewSimulationGuide(SimulationWeighted, &ast.PerformanceModel{
+		Configs: map[string]*ast.TransitionConfig{"Toss.head": {Probability: 0}, "Toss.tail": {Probability: 1}},
+	})
+	require.Nil(t, err)
+	_, failedNode := simulate(guide, 1)
+	assert.NotNil(t, failedNode)
+
+	// After a run with only heads, the novelty strategy prefers the tail never executed.
+	guide, err = NewSimulationGuide(SimulationNovelty, nil)
+	require.Nil(t, err)
+	guide.statements[coveragePc{file: 0, pc: "Actions[0].Block.Stmts[0]"}] = 100
+	guide.labels["Toss.head"] = 100
+	failures := 0
+	for seed := int64(1); seed <= 20; seed++ {
+		if _, failedNode := simulate(guide, seed); failedNode != nil {
+			failures++
+		}
+	}
+	assert.Equal(t, 20, failures)
+
+	// The fuzzing keeps the runs reaching new coverage, and replays their prefixes.
+	guide, err = NewSimulationGuide(SimulationFuzz, nil)
+	require.Nil(t, err)
+	p1, _ := simulate(guide, 1)
+	require.NotEmpty(t, p1.Choices())
+	assert.Equal(t, [][]int{p1.Choices()}, guide.corpus)
+	guide.corpus = [][]int{{1, 1, 1}}
+	for seed := int64(1); seed <= 5; seed++ {
+		p1, _ := simulate(guide, seed)
+		assert.LessOrEqual(t, len(p1.replay), 3)
+	}
+
+	_, err = NewSimulationGuide(SimulationWeighted, nil)
+	assert.NotNil(t, err)
+	_, err = NewSimulationGuide("unknown", nil)
+	assert.NotNil(t, err)
+}
+
+func TestProcessor_Exploration(t *testing.T) {
+	maxActions := int64(5)
+	start := func(spec string, exploration string, properties map[string]string) (*Processor, *Node) {
+		file, err := parseAstFromString(spec)
+		require.Nil(t, err)
+		crashOnYield := false
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{
+			Options: &ast.Options{
+				MaxActions:           maxActions,
+				MaxConcurrentActions: 2,
+				CrashOnYield:         &crashOnYield,
+			},
+			Exploration: exploration,
+			Properties:  properties,
+		}, false, 0, "")
+		_, failedNode, err := p1.Start()
+		require.Nil(t, err)
+		return p1, failedNode
+	}
+
+	_, bfsFailure := start(CounterWithNoise, ExplorationBfs, nil)
+	require.NotNil(t, bfsFailure)
+	_, dfsFailure := start(CounterWithNoise, ExplorationDfs, nil)
+	require.NotNil(t, dfsFailure)
+	assert.True(t, dfsFailure.HasFailedInvariants())
+	assert.GreaterOrEqual(t, dfsFailure.actionDepth, bfsFailure.actionDepth)
+	p1, idFailure := start(CounterWithNoise, ExplorationIterativeDeepening, nil)
+	require.NotNil(t, idFailure)
+	assert.Equal(t, bfsFailure.actionDepth, idFailure.actionDepth)
+	// The configured max_actions is restored after the search.
+	assert.Equal(t, int64(5), p1.config.Options.MaxActions)
+
+	// The dfs first reaches x == 3 with three actions, then with Inc and Jump. The states
+	// beyond are explored again from the shorter path, within max_actions.
+	maxActions = 4
+	_, bfsFailure = start(JumpCounter, ExplorationBfs, nil)
+	require.NotNil(t, bfsFailure)
+	assert.Equal(t, 3, bfsFailure.actionDepth)
+	_, dfsFailure = start(JumpCounter, ExplorationDfs, nil)
+	require.NotNil(t, dfsFailure)
+	_, idFailure = start(JumpCounter, ExplorationIterativeDeepening, nil)
+	require.NotNil(t, idFailure)
+	assert.Equal(t, bfsFailure.actionDepth, idFailure.actionDepth)
+	maxActions = 5
+
+	bfs, failedNode := start(PartiallyCoveredSpec, ExplorationBfs, nil)
+	require.Nil(t, failedNode)
+	for _, exploration := range []string{ExplorationDfs, ExplorationIterativeDeepening} {
+		p1, failedNode := start(PartiallyCoveredSpec, exploration, nil)
+		assert.Nil(t, failedNode)
+		assert.Equal(t, bfs.GetVisitedNodesCount(), p1.GetVisitedNodesCount(), exploration)
+	}
+
+	// The liveness properties are checked on the fly with dfs.
+	p1, failedNode = start(RequestReply, ExplorationDfs, map[string]string{"Property": "`requested` ~> `replied`"})
+	assert.Nil(t, failedNode)
+	assert.Nil(t, p1.LassoFailure())
+	p1, failedNode = start(RequestReply, ExplorationDfs, map[string]string{"Property": "<>[]`requested`"})
+	require.NotNil(t, p1.LassoFailure())
+	assert.Equal(t, "Property", p1.LassoFailure().Property.Name)
+	assert.Equal(t, p1.LassoFailure().Path[len(p1.LassoFailure().Path)-1].Node, failedNode)
+}
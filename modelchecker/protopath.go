@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var re = regexp.MustCompile(`Stmts\[\d+\]`)
@@ -15,10 +16,14 @@ var re = regexp.MustCompile(`Stmts\[\d+\]`)
 type ProtoPath struct {
 	// TODO(jayaprabhakar): A quick hack, fix this. It is safe because this field is immutable.
 	filesMap map[*ast.File]map[string]proto.Message
+	// lock guards the cache, as the swarm runs the model checkers concurrently.
+	lock sync.Mutex
 }
 var protoPathInstance = &ProtoPath{filesMap: make(map[*ast.File]map[string]proto.Message)}
 
 func GetProtoFieldByPath(file *ast.File, location string) proto.Message {
+	protoPathInstance.lock.Lock()
+	defer protoPathInstance.lock.Unlock()
 	if protoPathInstance.filesMap[file] == nil {
 		protoPathInstance.filesMap[file] = make(map[string]proto.Message)
 	} else if val, ok := protoPathInstance.filesMap[file][location]; ok {
@@ -0,0 +1,290 @@
+package modelchecker
+
+import (
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"math"
+	"slices"
+)
+
+// LassoFailure is a behavior found by a random walk that violates a liveness property.
+// The behavior is a lasso, a path from the init node to a loop repeated forever.
+type LassoFailure struct {
+	Property *TemporalProperty
+	// Instance is the instance violating a quantified property, like `c=Client#1`.
+	Instance string
+	// Path is the path from the init node followed by the loop. The last link points
+	// to the node the loop starts at, or is a stutter link at the last node.
+	Path []*Link
+}
+
+// simulationProperties returns the liveness properties checked on the lassos. The legacy
+// `always eventually` and `eventually always` assertions are checked as LTL formulas as well.
+func (p *Processor) simulationProperties() ([]*TemporalProperty, error) {
+	if p.config.GetLiveness() != "" && p.config.GetLiveness() != "strict" {
+		return nil, nil
+	}
+	properties := make([]*TemporalProperty, 0)
+	for i, file := range p.Files {
+		for j, invariant := range file.Invariants {
+			var formula *LtlFormula
+			if invariant.Block != nil {
+				atom := ltlAtomOf(invariant.Name)
+				if slices.Equal(invariant.TemporalOperators, []string{"always", "eventually"}) {
+					formula = ltlUnary(ltlAlways, ltlUnary(ltlEventually, atom))
+				} else if slices.Equal(invariant.TemporalOperators, []string{"eventually", "always"}) {
+					formula = ltlUnary(ltlEventually, ltlUnary(ltlAlways, atom))
+				}
+			} else if invariant.Always && invariant.Eventually {
+				formula = ltlUnary(ltlAlways, ltlUnary(ltlEventually, &LtlFormula{op: ltlAtom, atom: invariant.PyExpr, isExpr: true}))
+			} else if invariant.Eventually && invariant.GetNested().GetAlways() {
+				formula = ltlUnary(ltlEventually, ltlUnary(ltlAlways, &LtlFormula{op: ltlAtom, atom: invariant.Nested.PyExpr, isExpr: true}))
+			}
+			if formula != nil {
+				properties = append(properties, &TemporalProperty{
+					Name:     invariant.Name,
+					Formula:  formula,
+					Position: NewInvariantPosition(i, j),
+				})
+			}
+		}
+	}
+	general, err := TemporalProperties(p.Files, p.config)
+	if err != nil {
+		return nil, err
+	}
+	return append(properties, general...), nil
+}
+
+// lassoLoop returns the links of the loop closed by the node, a duplicate of a node
+// in the path of the walk. The first link closes the loop. Returns nil if the node
+// duplicates a node not in the path, like a sibling explored in the same step.
+func lassoLoop(node *Node) []*Link {
+	if node.DuplicateOf == nil {
+		return nil
+	}
+	closing := node.DuplicateOf.Inbound[len(node.DuplicateOf.Inbound)-1]
+	parent := closing.Node
+	path := pathToInit([]*Node{parent.root()}, parent)
+	for i, link := range path {
+		if link.Node == node.DuplicateOf {
+			loop := []*Link{closingLink(parent, node.DuplicateOf)}
+			return append(loop, path[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// closingLink returns the outbound link from the parent added by the duplicate node.
+func closingLink(parent *Node, to *Node) *Link {
+	for i := len(parent.Outbound) - 1; i >= 0; i-- {
+		if parent.Outbound[i].Node == to {
+			return parent.Outbound[i]
+		}
+	}
+	panic("closing link of the loop not found")
+}
+
+// expand processes every successor of the yield node, so the outbound links of the node
+// include all the enabled actions as isFairCycle and canStutter expect. The walk only
+// processes one of them. The successors are processed ignoring the max_actions limit,
+// as reaching the limit does not disable the actions in the infinite behavior.
+func (p *Processor) expand(node *Node) {
+	queue, intermediate := p.queue, p.intermediate_states
+	maxActions := p.config.Options.MaxActions
+	defer func() {
+		p.queue, p.intermediate_states = queue, intermediate
+		p.config.Options.MaxActions = maxActions
+	}()
+	p.queue, p.intermediate_states = lib.NewQueue[*Node](), lib.NewQueue[*Node]()
+	p.config.Options.MaxActions = math.MaxInt64
+
+	p.YieldNode(node)
+	children := make([]*Node, 0, p.queue.Len())
+	for p.queue.Len() > 0 {
+		child, _ := p.queue.Remove()
+		children = append(children, child)
+	}
+	for _, child := range children {
+		// Only the transitions from the node matter, the successors of the child are dropped.
+		p.processNode(child)
+		p.queue, p.intermediate_states = lib.NewQueue[*Node](), lib.NewQueue[*Node]()
+	}
+}
+
+// checkWalk checks the properties on the behaviors of the walk ending at the node. That is,
+// the lasso closed by the walk if any, and the behaviors stopping at the yield points
+// where the process is allowed to stutter.
+func (p *Processor) checkWalk(last *Node, loop []*Link, properties []*TemporalProperty) (*LassoFailure, error) {
+	path := pathToInit([]*Node{p.Init}, last)
+	for _, link := range path {
+		if link.Node.Name == "init" || link.Node.Name == "yield" {
+			p.expand(link.Node)
+		}
+	}
+	if loop != nil {
+		if failure, err := p.checkLasso(loop, properties); failure != nil || err != nil {
+			return failure, err
+		}
+	}
+	for i, link := range path {
+		if link.Node.Name != "init" && link.Node.Name != "yield" || !canStutter(link.Node) {
+			continue
+		}
+		stutter := append(slices.Clone(path[:i+1]), &Link{Node: link.Node, Name: "stutter"})
+		if failure, err := p.checkProperties(stutter, i, properties); failure != nil || err != nil {
+			return failure, err
+		}
+	}
+	return nil, nil
+}
+
+// checkLasso checks the properties on the lasso formed by the path to the start of
+// the loop followed by the loop repeated forever. The loop is ignored if it is unfair.
+func (p *Processor) checkLasso(loop []*Link, properties []*TemporalProperty) (*LassoFailure, error) {
+	if !isFairCycle(loop, false) {
+		return nil, nil
+	}
+	prefix := pathToInit([]*Node{p.Init}, loop[0].Node)
+	path := append(prefix, loop[1:]...)
+	path = append(path, loop[0])
+	return p.checkProperties(path, len(prefix)-1, properties)
+}
+
+// checkProperties evaluates the properties on the lasso. The last link of the path goes
+// back to the node at loopStart. It returns an error if an atom fails to evaluate.
+func (p *Processor) checkProperties(path []*Link, loopStart int, properties []*TemporalProperty) (*LassoFailure, error) {
+	nodes := make([]*Node, 0, len(path))
+	loop := -1
+	for i, link := range path[:len(path)-1] {
+		if i >= loopStart && loop < 0 {
+			loop = len(nodes)
+		}
+		// Like the LTL checker, the properties are evaluated at the root as well.
+		if i == 0 || isYieldPoint(link.Node) {
+			nodes = append(nodes, link.Node)
+		}
+	}
+	if loop < 0 || loop >= len(nodes) {
+		// The loop has no yield point to evaluate the properties at.
+		return nil, nil
+	}
+	for _, property := range properties {
+		bindings := []ltlBinding{nil}
+		if len(property.Quantifiers) > 0 {
+			var err error
+			bindings, err = ltlBindings(p.Init, property.Quantifiers)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", property.Name, err)
+			}
+		}
+		for _, binding := range bindings {
+			c := newLtlChecker(p.Init, property, binding)
+			valuations := make([]map[string]bool, len(nodes))
+			for i, node := range nodes {
+				valuation, err := c.valuation(node)
+				if err != nil {
+					return nil, fmt.Errorf("property %s: %w", property.Name, err)
+				}
+				valuations[i] = valuation
+			}
+			if !evalLasso(property.Formula, valuations, loop)[0] {
+				return &LassoFailure{Property: property, Instance: binding.String(), Path: path}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// evalLasso returns the truth of the formula at each position of the lasso, where the
+// positions from loop to the end repeat forever.
+func evalLasso(f *LtlFormula, valuations []map[string]bool, loop int) []bool {
+	n := len(valuations)
+	next := func(i int) int {
+		if i == n-1 {
+			return loop
+		}
+		return i + 1
+	}
+	values := make([]bool, n)
+	switch f.op {
+	case ltlTrue, ltlFalse:
+		for i := range values {
+			values[i] = f.op == ltlTrue
+		}
+	case ltlAtom:
+		for i := range values {
+			values[i] = valuations[i][f.String()]
+		}
+	case ltlNot:
+		left := evalLasso(f.left, valuations, loop)
+		for i := range values {
+			values[i] = !left[i]
+		}
+	case ltlAnd, ltlOr, ltlImplies:
+		left := evalLasso(f.left, valuations, loop)
+		right := evalLasso(f.right, valuations, loop)
+		for i := range values {
+			switch f.op {
+			case ltlAnd:
+				values[i] = left[i] && right[i]
+			case ltlOr:
+				values[i] = left[i] || right[i]
+			default:
+				values[i] = !left[i] || right[i]
+			}
+		}
+	case ltlNext:
+		left := evalLasso(f.left, valuations, loop)
+		for i := range values {
+			values[i] = left[next(i)]
+		}
+	case ltlUntil, ltlEventually:
+		// The least fixpoint of u[i] = right[i] || (left[i] && u[next(i)])
+		left, right := lassoOperands(f, valuations, loop)
+		for changed := true; changed; {
+			changed = false
+			for i := n - 1; i >= 0; i-- {
+				if !values[i] && (right[i] || (left[i] && values[next(i)])) {
+					values[i], changed = true, true
+				}
+			}
+		}
+	case ltlRelease, ltlAlways:
+		// The greatest fixpoint of r[i] = right[i] && (left[i] || r[next(i)])
+		left, right := lassoOperands(f, valuations, loop)
+		for i := range values {
+			values[i] = true
+		}
+		for changed := true; changed; {
+			changed = false
+			for i := n - 1; i >= 0; i-- {
+				if values[i] && !(right[i] && (left[i] || values[next(i)])) {
+					values[i], changed = false, true
+				}
+			}
+		}
+	case ltlLeadsTo:
+		// a ~> b is always (a -> eventually b)
+		return evalLasso(ltlUnary(ltlAlways, ltlBinary(ltlImplies, f.left, ltlUnary(ltlEventually, f.right))), valuations, loop)
+	}
+	return values
+}
+
+// lassoOperands returns the operands of until and release, with eventually as `true until f`
+// and always as `false release f`.
+func lassoOperands(f *LtlFormula, valuations []map[string]bool, loop int) ([]bool, []bool) {
+	switch f.op {
+	case ltlEventually:
+		return evalLasso(&LtlFormula{op: ltlTrue}, valuations, loop), evalLasso(f.left, valuations, loop)
+	case ltlAlways:
+		return evalLasso(&LtlFormula{op: ltlFalse}, valuations, loop), evalLasso(f.left, valuations, loop)
+	}
+	return evalLasso(f.left, valuations, loop), evalLasso(f.right, valuations, loop)
+}
+
+// LassoFailure returns the lasso violating a liveness property found by the simulation
+// or the dfs, if any.
+func (p *Processor) LassoFailure() *LassoFailure {
+	return p.lassoFailure
+}
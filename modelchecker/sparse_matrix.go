@@ -0,0 +1,230 @@
+package modelchecker
+
+import (
+	"sort"
+)
+
+// sparseMatrix is a square matrix in the compressed sparse row (CSR) format.
+// The transition matrices of the state space have a few non-zero entries per row,
+// so the memory and the cost of a multiplication are linear in the number of transitions.
+type sparseMatrix struct {
+	n int
+	// rowStart[i] is the index in cols and values of the first entry of row i,
+	// and rowStart[n] is the number of entries.
+	rowStart []int
+	// cols are the column indices of the entries, increasing within each row.
+	cols   []int
+	values []float64
+}
+
+func newSparseMatrix(n int) *sparseMatrix {
+	return &sparseMatrix{
+		n:        n,
+		rowStart: append(make([]int, 0, n+1), 0),
+		cols:     make([]int, 0, n),
+		values:   make([]float64, 0, n),
+	}
+}
+
+// appendRow adds the next row, from the column indices and the values of its entries.
+// The entries with the same column are added up.
+func (m *sparseMatrix) appendRow(cols []int, values []float64) {
+	if len(m.rowStart) > m.n {
+		panic("sparse matrix already has all the rows")
+	}
+	order := make([]int, len(cols))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return cols[order[a]] < cols[order[b]] })
+	start := len(m.cols)
+	for _, i := range order {
+		if len(m.cols) > start && m.cols[len(m.cols)-1] == cols[i] {
+			m.values[len(m.values)-1] += values[i]
+			continue
+		}
+		m.cols = append(m.cols, cols[i])
+		m.values = append(m.values, values[i])
+	}
+	m.rowStart = append(m.rowStart, len(m.cols))
+}
+
+// row returns the column indices and the values of the entries of the row.
+func (m *sparseMatrix) row(i int) ([]int, []float64) {
+	return m.cols[m.rowStart[i]:m.rowStart[i+1]], m.values[m.rowStart[i]:m.rowStart[i+1]]
+}
+
+func (m *sparseMatrix) get(i, j int) float64 {
+	cols, values := m.row(i)
+	k := sort.SearchInts(cols, j)
+	if k < len(cols) && cols[k] == j {
+		return values[k]
+	}
+	return 0
+}
+
+// transpose returns the transposed matrix, so the entries of a column can be iterated.
+func (m *sparseMatrix) transpose() *sparseMatrix {
+	counts := make([]int, m.n+1)
+	for _, j := range m.cols {
+		counts[j+1]++
+	}
+	for j := 0; j < m.n; j++ {
+		counts[j+1] += counts[j]
+	}
+	t := &sparseMatrix{
+		n:        m.n,
+		rowStart: counts,
+		cols:     make([]int, len(m.cols)),
+		values:   make([]float64, len(m.values)),
+	}
+	next := make([]int, m.n)
+	copy(next, counts[:m.n])
+	for i := 0; i < m.n; i++ {
+		cols, values := m.row(i)
+		for k, j := range cols {
+			t.cols[next[j]] = i
+			t.values[next[j]] = values[k]
+			next[j]++
+		}
+	}
+	return t
+}
+
+// leftMultiply returns the row vector x multiplied by the matrix. With a transition matrix,
+// it is the distribution after one step from the distribution x.
+func (m *sparseMatrix) leftMultiply(x []float64) []float64 {
+	result := make([]float64, m.n)
+	for i := 0; i < m.n; i++ {
+		if x[i] == 0 {
+			continue
+		}
+		cols, values := m.row(i)
+		for k, j := range cols {
+			result[j] += x[i] * values[k]
+		}
+	}
+	return result
+}
+
+// normalizeRows scales the rows to add up to 1. The rows adding up to 0 are unchanged.
+func (m *sparseMatrix) normalizeRows() {
+	for i := 0; i < m.n; i++ {
+		_, values := m.row(i)
+		rowSum := sum(values)
+		if rowSum == 0 {
+			continue
+		}
+		for k := range values {
+			values[k] /= rowSum
+		}
+	}
+}
+
+// rowProducts returns the sum of the entrywise product of each row with the same row of the other matrix.
+// With a transition matrix and a counter matrix, it is the expected counter increment of a step from each state.
+func (m *sparseMatrix) rowProducts(other *sparseMatrix) []float64 {
+	result := make([]float64, m.n)
+	for i := 0; i < m.n; i++ {
+		cols, values := m.row(i)
+		otherCols, otherValues := other.row(i)
+		for a, b := 0, 0; a < len(cols) && b < len(otherCols); {
+			switch {
+			case cols[a] < otherCols[b]:
+				a++
+			case cols[a] > otherCols[b]:
+				b++
+			default:
+				result[i] += values[a] * otherValues[b]
+				a++
+				b++
+			}
+		}
+	}
+	return result
+}
+
+// bottomComponents returns the strongly connected component of each state, and for each component,
+// whether it is a bottom component, that is, no transition leaves it. In a Markov chain, the states
+// in the bottom components are recurrent, and every other state is transient.
+func (m *sparseMatrix) bottomComponents() ([]int, []bool) {
+	// Iterative Tarjan's algorithm, as the state space can be too deep for the recursion.
+	const unvisited = -1
+	index := make([]int, m.n)
+	lowLink := make([]int, m.n)
+	onStack := make([]bool, m.n)
+	component := make([]int, m.n)
+	for i := range index {
+		index[i] = unvisited
+	}
+	stack := make([]int, 0)
+	bottom := make([]bool, 0)
+	type frame struct {
+		node int
+		next int
+	}
+	counter := 0
+	for start := 0; start < m.n; start++ {
+		if index[start] != unvisited {
+			continue
+		}
+		frames := []frame{{node: start}}
+		index[start], lowLink[start] = counter, counter
+		counter++
+		stack = append(stack, start)
+		onStack[start] = true
+		for len(frames) > 0 {
+			top := &frames[len(frames)-1]
+			cols, values := m.row(top.node)
+			if top.next < len(cols) {
+				j := cols[top.next]
+				top.next++
+				if values[top.next-1] == 0 {
+					continue
+				}
+				if index[j] == unvisited {
+					index[j], lowLink[j] = counter, counter
+					counter++
+					stack = append(stack, j)
+					onStack[j] = true
+					frames = append(frames, frame{node: j})
+				} else if onStack[j] {
+					lowLink[top.node] = min(lowLink[top.node], index[j])
+				}
+				continue
+			}
+			node := top.node
+			frames = frames[:len(frames)-1]
+			if len(frames) > 0 {
+				parent := frames[len(frames)-1].node
+				lowLink[parent] = min(lowLink[parent], lowLink[node])
+			}
+			if lowLink[node] != index[node] {
+				continue
+			}
+			id := len(bottom)
+			members := make([]int, 0)
+			for {
+				member := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[member] = false
+				component[member] = id
+				members = append(members, member)
+				if member == node {
+					break
+				}
+			}
+			isBottom := true
+			for _, member := range members {
+				cols, values := m.row(member)
+				for k, j := range cols {
+					if values[k] != 0 && component[j] != id {
+						isBottom = false
+					}
+				}
+			}
+			bottom = append(bottom, isBottom)
+		}
+	}
+	return component, bottom
+}
@@ -0,0 +1,179 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"google.golang.org/protobuf/proto"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SwarmVariant returns the options for the swarm run with the seed. Each run explores with
+// a random max_actions and max_concurrent_actions up to the configured limits, and with the
+// crash on yield randomly turned off, so the runs favor different parts of the state space.
+// The variant depends only on the seed, so the run can be reproduced with the seed.
+func SwarmVariant(options *ast.StateSpaceOptions, seed int64) *ast.StateSpaceOptions {
+	random := rand.New(rand.NewSource(seed))
+	variant := proto.Clone(options).(*ast.StateSpaceOptions)
+	if variant.Options == nil {
+		variant.Options = &ast.Options{}
+	}
+	if maxActions := variant.Options.MaxActions; maxActions > 1 {
+		variant.Options.MaxActions = 1 + random.Int63n(maxActions)
+	}
+	if maxConcurrentActions := variant.Options.MaxConcurrentActions; maxConcurrentActions > 1 {
+		variant.Options.MaxConcurrentActions = 1 + random.Int63n(maxConcurrentActions)
+	}
+	if variant.Options.GetCrashOnYield() {
+		crashOnYield := random.Intn(2) == 0
+		variant.Options.CrashOnYield = &crashOnYield
+	}
+	return variant
+}
+
+// SwarmFailure is the first failure found by the swarm, with the seed reproducing it.
+type SwarmFailure struct {
+	Seed int64
+	// Options are the options of the variant that failed.
+	Options    *ast.StateSpaceOptions
+	Processor  *Processor
+	Root       *Node
+	FailedNode *Node
+	Err        error
+}
+
+// Swarm runs many independent simulations concurrently, each with a different seed
+// and options variant, and aggregates their results.
+type Swarm struct {
+	files   []*ast.File
+	options *ast.StateSpaceOptions
+	dirPath string
+	workers int
+	// maxRuns is the number of runs, 0 for unlimited.
+	maxRuns int
+	// seed is the seed of the first run, the run i uses seed+i.
+	seed int64
+
+	nextRun atomic.Int64
+	stopped atomic.Bool
+	// guide biases the simulations, shared by all the runs.
+	guide *SimulationGuide
+
+	// lock guards the aggregated results below.
+	lock     sync.Mutex
+	runs     int
+	states   map[string]bool
+	coverage *Coverage
+	failure  *SwarmFailure
+}
+
+func NewSwarm(files []*ast.File, options *ast.StateSpaceOptions, dirPath string, workers int, maxRuns int, seed int64) *Swarm {
+	if workers <= 0 {
+		workers = 1
+	}
+	if seed == 0 {
+		seed = time.Now().UnixMicro()
+	}
+	return &Swarm{
+		files:    files,
+		options:  options,
+		dirPath:  dirPath,
+		workers:  workers,
+		maxRuns:  maxRuns,
+		seed:     seed,
+		states:   make(map[string]bool),
+		coverage: NewCoverage(),
+	}
+}
+
+// Start runs the simulations until maxRuns are completed, the swarm is stopped, or a run
+// fails. Returns the first failure, or nil if no run failed. The runs already in progress
+// when a run fails are completed, but their results are discarded.
+func (s *Swarm) Start() *SwarmFailure {
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !s.stopped.Load() {
+				i := s.nextRun.Add(1) - 1
+				if s.maxRuns > 0 && i >= int64(s.maxRuns) {
+					return
+				}
+				s.run(s.seed + i)
+			}
+		}()
+	}
+	wg.Wait()
+	return s.failure
+}
+
+func (s *Swarm) run(seed int64) {
+	options := SwarmVariant(s.options, seed)
+	p := NewProcessor(s.files, options, true, seed, s.dirPath)
+	p.SetSimulationGuide(s.guide)
+	root, failedNode, err := p.Start()
+	states := distinctStates(root)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failure != nil {
+		return
+	}
+	s.runs++
+	s.coverage.Merge(p.Coverage())
+	for state := range states {
+		s.states[state] = true
+	}
+	if failedNode != nil || err != nil {
+		s.failure = &SwarmFailure{Seed: seed, Options: options, Processor: p, Root: root, FailedNode: failedNode, Err: err}
+		s.stopped.Store(true)
+	}
+}
+
+// distinctStates returns the hashes of the states at the yield points reached from the root.
+func distinctStates(root *Node) map[string]bool {
+	states := make(map[string]bool)
+	add := func(node *Node) {
+		if node.Process != nil && (node.Name == "init" || node.Name == "yield") {
+			states[node.Process.HashCode()] = true
+		}
+	}
+	if root != nil {
+		add(root)
+	}
+	walkLinks(root, func(link *Link) {
+		add(link.Node)
+	})
+	return states
+}
+
+// SetSimulationGuide makes all the runs pick the successors with the guide.
+func (s *Swarm) SetSimulationGuide(guide *SimulationGuide) {
+	s.guide = guide
+}
+
+// Stop stops the swarm from starting new runs.
+func (s *Swarm) Stop() {
+	s.stopped.Store(true)
+}
+
+// Runs returns the number of runs completed.
+func (s *Swarm) Runs() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.runs
+}
+
+// DistinctStates returns the number of distinct states reached by all the runs.
+func (s *Swarm) DistinctStates() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.states)
+}
+
+// Coverage returns the coverage aggregated over all the runs.
+func (s *Swarm) Coverage() *Coverage {
+	return s.coverage
+}
@@ -189,5 +189,887 @@ const (
     }
   ]
 }
+`
+
+	RoleWithDurableFields = `
+{
+  "roles": [
+    {
+      "name": "Server",
+      "durableFields": ["log"],
+      "ephemeralFields": ["cache"],
+      "actions": [
+        {
+          "name": "Init",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.log = 0"
+                }
+              },
+              {
+                "pyStmt": {
+                  "code": "self.cache = 0"
+                }
+              }
+            ]
+          }
+        },
+        {
+          "name": "Write",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.log = self.log + 1"
+                }
+              },
+              {
+                "pyStmt": {
+                  "code": "self.cache = self.cache + 1"
+                }
+              }
+            ]
+          }
+        },
+        {
+          "name": "Recover",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.cache = self.log"
+                }
+              }
+            ]
+          }
+        }
+      ]
+    }
+  ],
+  "actions": [
+    {
+      "name": "Init",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "server = Server(ID=0)"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	ChannelWithFaults = `
+{
+  "actions": [
+    {
+      "name": "Init",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "net = channel(lossy=True, duplicating=True)"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Send",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "net.send('ping')"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Receive",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "msg = net.recv() if net else None"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	RoleWithTimer = `
+{
+  "roles": [
+    {
+      "name": "Node",
+      "actions": [
+        {
+          "name": "Init",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.fired = 0"
+                }
+              },
+              {
+                "pyStmt": {
+                  "code": "self.arm_timer(delay=2)"
+                }
+              }
+            ]
+          }
+        },
+        {
+          "name": "Timeout",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.fired = self.fired + 1"
+                }
+              }
+            ]
+          }
+        }
+      ]
+    }
+  ],
+  "actions": [
+    {
+      "name": "Init",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "node = Node()"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	GuardedActions = `
+{
+  "states": {
+    "code": "x = 0"
+  },
+  "actions": [
+    {
+      "name": "Inc",
+      "guard": {
+        "pyExpr": "x < 2"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "x < 2",
+              "conditionExpr": {
+                "pyExpr": "x < 2"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "x = x + 1"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Reset",
+      "guard": {
+        "pyExpr": "x == 2"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "x == 2",
+              "conditionExpr": {
+                "pyExpr": "x == 2"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "x = 0"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	ParameterizedAction = `
+{
+  "states": {
+    "code": "NODES = ['a', 'b']\nlog = []"
+  },
+  "actions": [
+    {
+      "name": "Send",
+      "params": [
+        {
+          "name": "src",
+          "domainExpr": {
+            "pyExpr": "NODES"
+          }
+        },
+        {
+          "name": "dst",
+          "domainExpr": {
+            "pyExpr": "NODES"
+          }
+        }
+      ],
+      "guard": {
+        "pyExpr": "src != dst"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "src != dst",
+              "conditionExpr": {
+                "pyExpr": "src != dst"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "log = log + [src + dst]"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	SymmetricParameterizedAction = `
+{
+  "states": {
+    "code": "pinged = []"
+  },
+  "stmts": [
+    {
+      "pyStmt": {
+        "code": "NODES = symmetric_values('n', 2)"
+      }
+    }
+  ],
+  "actions": [
+    {
+      "name": "Ping",
+      "params": [
+        {
+          "name": "node",
+          "domainExpr": {
+            "pyExpr": "NODES"
+          }
+        }
+      ],
+      "block": {
+        "flow": "FLOW_SERIAL",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "pinged = pinged + [node]"
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "pinged = pinged + [node]"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	RequestReply = `
+{
+  "states": {
+    "code": "requested = False\nreplied = False"
+  },
+  "actions": [
+    {
+      "name": "Request",
+      "fairness": {
+        "level": "FAIRNESS_LEVEL_WEAK"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "not requested",
+              "conditionExpr": {
+                "pyExpr": "not requested"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "requested = True\nreplied = False"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Reply",
+      "fairness": {
+        "level": "FAIRNESS_LEVEL_WEAK"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "requested",
+              "conditionExpr": {
+                "pyExpr": "requested"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "requested = False\nreplied = True"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	ClientsWithUnfairServer = `
+{
+  "roles": [
+    {
+      "name": "Client",
+      "actions": [
+        {
+          "name": "Init",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.pending = False\nself.done = False"
+                }
+              }
+            ]
+          }
+        },
+        {
+          "name": "Request",
+          "fairness": {
+            "level": "FAIRNESS_LEVEL_WEAK"
+          },
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "requireStmt": {
+                  "condition": "not self.pending",
+                  "conditionExpr": {
+                    "pyExpr": "not self.pending"
+                  }
+                }
+              },
+              {
+                "pyStmt": {
+                  "code": "self.pending = True\nself.done = False"
+                }
+              }
+            ]
+          }
+        }
+      ]
+    }
+  ],
+  "actions": [
+    {
+      "name": "Init",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "c0 = Client()"
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "c1 = Client()"
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "clients = [c0, c1]"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Serve",
+      "fairness": {
+        "level": "FAIRNESS_LEVEL_WEAK"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "clients[0].pending",
+              "conditionExpr": {
+                "pyExpr": "clients[0].pending"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "clients[0].pending = False\nclients[0].done = True"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	CounterWithNoise = `
+{
+  "states": {
+    "code": "x = 0\ny = 0"
+  },
+  "invariants": [
+    {
+      "always": true,
+      "pyExpr": "x < 2"
+    }
+  ],
+  "actions": [
+    {
+      "name": "Inc",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "x = x + 1"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Noise",
+      "block": {
+        "flow": "FLOW_SERIAL",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "y = y + 1"
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "y = y - 1"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	PartiallyCoveredSpec = `
+{
+  "states": {
+    "code": "x = 0"
+  },
+  "invariants": [
+    {
+      "name": "Bounded",
+      "always": true,
+      "pyExpr": "x <= 3"
+    },
+    {
+      "name": "Implication",
+      "always": true,
+      "pyExpr": "not (x > 5) or x < 10"
+    }
+  ],
+  "actions": [
+    {
+      "name": "Inc",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "x < 3",
+              "conditionExpr": {
+                "pyExpr": "x < 3"
+              }
+            }
+          },
+          {
+            "ifStmt": {
+              "branches": [
+                {
+                  "condition": "x < 3",
+                  "conditionExpr": {
+                    "pyExpr": "x < 3"
+                  },
+                  "block": {
+                    "flow": "FLOW_ATOMIC",
+                    "stmts": [
+                      {
+                        "pyStmt": {
+                          "code": "x = x + 1"
+                        }
+                      }
+                    ]
+                  }
+                },
+                {
+                  "condition": "x > 10",
+                  "conditionExpr": {
+                    "pyExpr": "x > 10"
+                  },
+                  "block": {
+                    "flow": "FLOW_ATOMIC",
+                    "stmts": [
+                      {
+                        "pyStmt": {
+                          "code": "x = 0"
+                        }
+                      }
+                    ]
+                  }
+                }
+              ]
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Never",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "x > 10",
+              "conditionExpr": {
+                "pyExpr": "x > 10"
+              }
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "x = 0"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	LabeledCoinToss = `
+{
+  "states": {
+    "code": "heads = 0\ntails = 0"
+  },
+  "invariants": [
+    {
+      "always": true,
+      "pyExpr": "tails == 0"
+    }
+  ],
+  "actions": [
+    {
+      "name": "Toss",
+      "block": {
+        "flow": "FLOW_ONEOF",
+        "stmts": [
+          {
+            "label": "head",
+            "pyStmt": {
+              "code": "heads = heads + 1"
+            }
+          },
+          {
+            "label": "tail",
+            "pyStmt": {
+              "code": "tails = tails + 1"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+
+	LeaderElection = `
+{
+  "states": {
+    "code": "leader = 0"
+  },
+  "actions": [
+    {
+      "name": "Elect",
+      "guard": {
+        "pyExpr": "leader == 0"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "leader == 0",
+              "conditionExpr": {
+                "pyExpr": "leader == 0"
+              }
+            }
+          },
+          {
+            "block": {
+              "flow": "FLOW_ONEOF",
+              "stmts": [
+                {
+                  "label": "n1",
+                  "pyStmt": {
+                    "code": "leader = 1"
+                  }
+                },
+                {
+                  "label": "n2",
+                  "pyStmt": {
+                    "code": "leader = 2"
+                  }
+                }
+              ]
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Lead",
+      "guard": {
+        "pyExpr": "leader != 0"
+      },
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "requireStmt": {
+              "condition": "leader != 0",
+              "conditionExpr": {
+                "pyExpr": "leader != 0"
+              }
+            }
+          },
+          {
+            "block": {
+              "flow": "FLOW_ONEOF",
+              "stmts": [
+                {
+                  "label": "crash",
+                  "pyStmt": {
+                    "code": "leader = 0"
+                  }
+                },
+                {
+                  "label": "handoff",
+                  "pyStmt": {
+                    "code": "leader = 3 - leader"
+                  }
+                }
+              ]
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+	// JumpCounter reaches x == 3 with a single Jump, after the dfs first reached it with three Inc.
+	JumpCounter = `
+{
+  "states": {
+    "code": "x = 0"
+  },
+  "invariants": [
+    {
+      "always": true,
+      "pyExpr": "x < 5"
+    }
+  ],
+  "actions": [
+    {
+      "name": "Inc",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "x = x + 1"
+            }
+          }
+        ]
+      }
+    },
+    {
+      "name": "Jump",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "x = 3"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
+`
+	// RoleCrashDuringCall crashes the Server while the Client is executing
+	// the Put function of the Server, which also sets a field not set by Init.
+	RoleCrashDuringCall = `
+{
+  "roles": [
+    {
+      "name": "Server",
+      "durableFields": ["log"],
+      "actions": [
+        {
+          "name": "Init",
+          "block": {
+            "flow": "FLOW_ATOMIC",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.log = 0"
+                }
+              }
+            ]
+          }
+        }
+      ],
+      "functions": [
+        {
+          "name": "Put",
+          "flow": "FLOW_SERIAL",
+          "block": {
+            "flow": "FLOW_SERIAL",
+            "stmts": [
+              {
+                "pyStmt": {
+                  "code": "self.log = self.log + 1"
+                }
+              },
+              {
+                "pyStmt": {
+                  "code": "self.pending = True"
+                }
+              }
+            ]
+          }
+        }
+      ]
+    },
+    {
+      "name": "Client",
+      "actions": [
+        {
+          "name": "Call",
+          "block": {
+            "flow": "FLOW_SERIAL",
+            "stmts": [
+              {
+                "callStmt": {
+                  "name": "Put",
+                  "receiver": "server"
+                }
+              }
+            ]
+          }
+        }
+      ]
+    }
+  ],
+  "actions": [
+    {
+      "name": "Init",
+      "block": {
+        "flow": "FLOW_ATOMIC",
+        "stmts": [
+          {
+            "pyStmt": {
+              "code": "server = Server(ID=0)"
+            }
+          },
+          {
+            "pyStmt": {
+              "code": "client = Client(ID=0)"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}
 `
 )
@@ -318,6 +318,8 @@ type CallFrame struct {
 
 	callerAssignVarNames []string
 	obj                  *lib.Role
+	// params is set for the root frame of a parameterized action, where vars are the bound parameters.
+	params bool
 }
 
 func (c *CallFrame) MarshalJSON() ([]byte, error) {
@@ -337,6 +339,14 @@ func (c *CallFrame) HashCode() string {
 	// if program counter is at different stmts.
 	h := c.scope.Hash()
 	h.Write([]byte(c.pc))
+	if c.params {
+		// The bound parameters distinguish the transitions of a parameterized action.
+		vars, err := StringDictToJson(c.vars)
+		if err != nil {
+			panic(err)
+		}
+		h.Write(vars)
+	}
 	if c.obj != nil {
 		h.Write([]byte(c.obj.RefString()))
 	}
@@ -351,9 +361,17 @@ func NewCallStack() *CallStack {
 	return &CallStack{lib.NewStack[*CallFrame]()}
 }
 
-func (s *CallStack) Clone(map[lib.SymmetricValue][]lib.SymmetricValue, int) *CallStack {
+func (s *CallStack) Clone(refs map[string]*lib.Role, permutations map[lib.SymmetricValue][]lib.SymmetricValue, alt int) *CallStack {
 	// TODO: handle symmetry in stack.Clone()
-	return &CallStack{s.Stack.Clone()}
+	other := &CallStack{s.Stack.Clone()}
+	// The bound parameters are hashed, so they are translated with the state for the symmetry reduction.
+	cloned := other.RawArray()
+	for i, frame := range s.RawArray() {
+		if frame.params {
+			cloned[i].vars = CloneDict(frame.vars, refs, permutations, alt)
+		}
+	}
+	return other
 }
 
 func (s *CallStack) HashCode() string {
@@ -425,6 +443,16 @@ func (t *Thread) currentFileAst() *ast.File {
 	return t.Files[frame.FileIndex]
 }
 
+// inRole returns true if any frame on the stack executes in the role instance.
+func (t *Thread) inRole(role *lib.Role) bool {
+	for _, frame := range t.Stack.RawArray() {
+		if frame.obj != nil && frame.obj.RefStringShort() == role.RefStringShort() {
+			return true
+		}
+	}
+	return false
+}
+
 func PanicIfFalse(ok bool, msg string) {
 	if !ok {
 		panic(msg)
@@ -447,9 +475,8 @@ func (t *Thread) popFrame() *CallFrame {
 	return frame
 }
 
-func (t *Thread) Clone(permutations map[lib.SymmetricValue][]lib.SymmetricValue, alt int) *Thread {
-	// TODO: handle symmetry in stack.Clone()
-	return &Thread{Id: t.Id, Process: t.Process, Files: t.Files, Stack: t.Stack.Clone(permutations, alt), Fairness: t.Fairness}
+func (t *Thread) Clone(refs map[string]*lib.Role, permutations map[lib.SymmetricValue][]lib.SymmetricValue, alt int) *Thread {
+	return &Thread{Id: t.Id, Process: t.Process, Files: t.Files, Stack: t.Stack.Clone(refs, permutations, alt), Fairness: t.Fairness}
 }
 
 func (t *Thread) Execute() ([]*Process, bool) {
@@ -491,6 +518,7 @@ func (t *Thread) Execute() ([]*Process, bool) {
 				return []*Process{fork}, false
 			}
 			t.Process.EnableCheckpoint = true
+			t.Process.coverage.recordStatement(frame.FileIndex, frame.pc)
 			forks, yield = t.executeStatement()
 		case *ast.ForStmt:
 			forks, yield = t.executeForStatement()
@@ -583,6 +611,7 @@ func (t *Thread) executeStatement() ([]*Process, bool) {
 		_, err := t.Process.Evaluator.ExecPyStmt(t.getFileName(), stmt.PyStmt, vars)
 		t.Process.PanicOnError(stmt.PyStmt.GetSourceInfo(), fmt.Sprintf("Error executing statement: %s", stmt.PyStmt.GetCode()), err)
 		t.Process.updateAllVariablesInScope(vars)
+		t.Process.recordChannelMessages(t.currentFrame())
 		t.Process.Enable()
 	} else if stmt.Block != nil {
 		currentFrame.pc = currentFrame.pc + ".Block"
@@ -600,6 +629,7 @@ func (t *Thread) executeStatement() ([]*Process, bool) {
 			t.Process.PanicOnError(conditionExpr.GetSourceInfo(), fmt.Sprintf("Error checking condition: %s", branch.Condition), err)
 			t.Process.updateAllVariablesInScope(vars)
 			if cond.Truth() {
+				t.Process.coverage.recordBranch(currentFrame.FileIndex, currentFrame.pc, i)
 				currentFrame.pc = fmt.Sprintf("%s.IfStmt.Branches[%d].Block", currentFrame.pc, i)
 				return nil, false
 			}
@@ -1155,6 +1185,9 @@ func (t *Thread) executeEndOfBlock() bool {
 						isInitAction = true
 					}
 				}
+				if isRole && isInitAction && oldFrame.obj != nil {
+					oldFrame.obj.InitFields = t.Process.cloneRoleFields(oldFrame.obj.Fields)
+				}
 				if isFunction || (isRole && isInitAction) {
 					if len(oldFrame.callerAssignVarNames) > 1 {
 						panic("Multiple return values not supported yet")
@@ -14,6 +14,8 @@ class BuildAstVisitor(FizzParserVisitor):
         self.file_path = file_path
         self.file_name = os.path.basename(file_path)
         self.input_stream = input_stream
+        # Durability annotations of the fields of the role being visited.
+        self.field_annotations = None
 
     def aggregateResult(self, aggregate, nextResult):
         if nextResult and aggregate:
@@ -86,6 +88,7 @@ class BuildAstVisitor(FizzParserVisitor):
         print("visitRoledef children count",ctx.getChildCount())
 
         role = ast.Role(source_info=get_source_info(ctx))
+        self.field_annotations = {}
 
         for i, child in enumerate(ctx.getChildren()):
             print()
@@ -128,6 +131,12 @@ class BuildAstVisitor(FizzParserVisitor):
                 print("visitRoledef child (unknown) type",child.__class__.__name__, dir(child))
                 raise Exception("visitRoledef child (unknown) type")
 
+        for field, annotation in self.field_annotations.items():
+            if annotation == "durable":
+                role.durable_fields.append(field)
+            else:
+                role.ephemeral_fields.append(field)
+        self.field_annotations = None
         print("role", role)
         return role
 
@@ -174,6 +183,11 @@ class BuildAstVisitor(FizzParserVisitor):
                 if isinstance(child, FizzParser.NameContext):
                     action.name = child.getText()
                     continue
+                if isinstance(child, FizzParser.TestContext):
+                    # The guard, like `action Inc if x < 2:`
+                    action.guard.py_expr = self.get_py_str(child)
+                    action.guard.source_info.CopyFrom(get_source_info(child))
+                    continue
 
                 self.log_childtree(child)
                 childProto = self.visit(child)
@@ -181,12 +195,17 @@ class BuildAstVisitor(FizzParserVisitor):
                     action.block.CopyFrom(childProto)
                 if isinstance(childProto, ast.Fairness):
                     action.fairness.CopyFrom(childProto)
+                if isinstance(childProto, list):
+                    action.params.extend(childProto)
 
                 print("visitActiondef childProto",childProto)
             elif hasattr(child, 'getSymbol'):
 
                 if (child.getSymbol().type == FizzParser.LINE_BREAK
                         or child.getSymbol().type == FizzParser.ACTION
+                        or child.getSymbol().type == FizzParser.OPEN_PAREN
+                        or child.getSymbol().type == FizzParser.CLOSE_PAREN
+                        or child.getSymbol().type == FizzParser.IF
                         or child.getSymbol().type == FizzParser.COLON
                 ):
                     continue
@@ -229,6 +248,42 @@ class BuildAstVisitor(FizzParserVisitor):
         print("action", action)
         return action
 
+    # Visit a parse tree produced by FizzParser#action_params.
+    def visitAction_params(self, ctx:FizzParser.Action_paramsContext):
+        params = []
+        for i, child in enumerate(ctx.getChildren()):
+            print()
+            print("visitAction_params child index",i,child.getText())
+            if hasattr(child, 'toStringTree'):
+                self.log_childtree(child)
+                childProto = self.visit(child)
+                if isinstance(childProto, ast.Parameter):
+                    params.append(childProto)
+                    continue
+                print("visitAction_params childProto",childProto)
+            elif hasattr(child, 'getSymbol'):
+                if child.getSymbol().type == FizzParser.COMMA:
+                    continue
+                self.log_symbol(child)
+            else:
+                print("visitAction_params child (unknown) type",child.__class__.__name__, dir(child))
+                raise Exception("visitAction_params child (unknown) type")
+
+        print("visitAction_params params", params)
+        return params
+
+    # Visit a parse tree produced by FizzParser#action_param.
+    def visitAction_param(self, ctx:FizzParser.Action_paramContext):
+        print("\n\nvisitAction_param",ctx.__class__.__name__)
+        print("visitAction_param full text\n", self.get_py_str(ctx))
+
+        param = ast.Parameter(source_info=get_source_info(ctx))
+        param.name = ctx.name().getText()
+        param.domain_expr.py_expr = self.get_py_str(ctx.test())
+        param.domain_expr.source_info.CopyFrom(get_source_info(ctx.test()))
+        print("param", param)
+        return param
+
     # Visit a parse tree produced by FizzParser#fairness.
     def visitFairness(self, ctx:FizzParser.FairnessContext):
         fairness = ast.Fairness(source_info=get_source_info(ctx))
@@ -303,6 +358,12 @@ class BuildAstVisitor(FizzParserVisitor):
                 if child.getSymbol().type in [FizzParser.EVENTUALLY, FizzParser.ALWAYS, FizzParser.EXISTS]:
                     invariant.temporal_operators.append(child.getText())
                     continue
+                if child.getSymbol().type == FizzParser.TRANSITION:
+                    # A transition assertion is checked on every transition, with `old`
+                    # bound to the state before and `new` to the state after.
+                    invariant.transition = True
+                    invariant.temporal_operators.append("always")
+                    continue
 
                 self.log_symbol(child)
             else:
@@ -553,9 +614,27 @@ class BuildAstVisitor(FizzParserVisitor):
     def visitExpr_stmt(self, ctx:FizzParser.Expr_stmtContext):
         py_str = self.get_py_str(ctx)
         print("visitExpr_stmt full text\n",py_str)
+        assign_part = ctx.assign_part()
+        if assign_part is not None and assign_part.COLON() is not None:
+            py_str = self.strip_field_annotation(ctx, assign_part)
         py_str = BuildAstVisitor.transform_code(py_str)
         return ast.PyStmt(code=py_str, source_info=get_source_info(ctx))
 
+    # Role fields can be annotated as durable or ephemeral, like `self.log: durable = []`.
+    # The annotation is recorded for the enclosing role, and the statement is
+    # converted to a plain assignment, as starlark does not support annotations.
+    def strip_field_annotation(self, ctx, assign_part):
+        target = self.get_py_str(ctx.testlist_star_expr())
+        annotation = assign_part.test().getText()
+        if self.field_annotations is None or not target.startswith("self."):
+            raise Exception(f"Error: Line: {ctx.start.line}: Annotations are only supported for role fields")
+        if annotation not in ("durable", "ephemeral"):
+            raise Exception(f"Error: Line: {ctx.start.line}: Unknown annotation {annotation}, must be durable or ephemeral")
+        self.field_annotations[target[len("self."):]] = annotation
+        if assign_part.testlist() is None:
+            return "pass"
+        return target + " = " + self.get_py_str(assign_part.testlist())
+
     # Visit a parse tree produced by FizzParser#flow_stmt.
     def visitFlow_stmt(self, ctx:FizzParser.Flow_stmtContext):
         print("\n\nvisitFlow_stmt",ctx.__class__.__name__)
@@ -102,6 +102,7 @@ ROLE     : 'role';
 SYMMETRIC : 'symmetric';
 
 ASSERTION      : 'assertion';
+TRANSITION     : 'transition';
 INVARIANTS     : 'invariants';
 ALWAYS         : 'always';
 EVENTUALLY     : 'eventually';
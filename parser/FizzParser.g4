@@ -145,7 +145,16 @@ funcdef
 
 // Fizz specific
 actiondef
-    : (ATOMIC | PARALLEL | SERIAL | ONEOF)? fairness? ACTION name COLON suite
+    : (ATOMIC | PARALLEL | SERIAL | ONEOF)? fairness? ACTION name (OPEN_PAREN action_params CLOSE_PAREN)? (IF test)? COLON suite
+    ;
+
+// The parameters of an action with their domains, like `action Send(src in NODES, dst in NODES)`
+action_params
+    : action_param (COMMA action_param)* COMMA?
+    ;
+
+action_param
+    : name IN test
     ;
 
 fairness
@@ -158,6 +167,7 @@ functiondef
 
 assertiondef
     : (EXISTS | ALWAYS | EVENTUALLY)+ ASSERTION name COLON suite
+    | TRANSITION ASSERTION name COLON suite
     ;
 
 // python 3 paramters
@@ -388,6 +398,7 @@ name
     | ANY
     | TRUE
     | FALSE
+    | TRANSITION
     ;
 
 number